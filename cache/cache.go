@@ -13,21 +13,49 @@ import (
 
 const defaultBypass = time.Second * 10
 
-// UpdateCacheFile - update a cache file
+// DefaultDataDirMode is the permission mode used by UpdateCacheFile to create a missing data directory
+const DefaultDataDirMode os.FileMode = 0755
+
+// UpdateCacheFile - update a cache file, creating the data directory with DefaultDataDirMode if it does not exist
 func UpdateCacheFile(dataDir string, fileName string, value []byte) error {
+	return UpdateCacheFileWithMode(dataDir, fileName, value, DefaultDataDirMode)
+}
+
+// UpdateCacheFileWithMode - update a cache file, creating the data directory with dirMode if it does not exist
+func UpdateCacheFileWithMode(dataDir string, fileName string, value []byte, dirMode os.FileMode) error {
 	cacheFileName := path.Join(dataDir, fileName)
-	f, err := os.OpenFile(cacheFileName, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
+	if err := os.MkdirAll(path.Dir(cacheFileName), dirMode); err != nil {
 		return err
 	}
-	defer f.Close()
-	writer := bufio.NewWriter(f)
-	_, err = writer.Write(value)
+	return WriteFileAtomic(cacheFileName, value, 0644)
+}
+
+// WriteFileAtomic writes data to a temporary file in the directory of name and renames it over name,
+// so readers never see a partially written file nor the trailing bytes of a longer previous content
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(path.Dir(name), "."+path.Base(name)+".*.tmp")
 	if err != nil {
 		return err
 	}
+	tmpName := f.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpName)
+		}
+	}()
 
-	return writer.Flush()
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpName, perm); err != nil {
+		return err
+	}
+	err = os.Rename(tmpName, name)
+	return err
 }
 
 // LoadCacheFile - load a cache file
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"errors"
+	"os"
+	"path"
 	"sync"
 	"testing"
 	"time"
@@ -144,3 +146,33 @@ func TestCache_Clean(t *testing.T) {
 	_, ok = cache.cacheMap.Load("key3")
 	require.True(t, ok)
 }
+
+func TestUpdateCacheFile_CreatesDataDir(t *testing.T) {
+	dataDir := path.Join(t.TempDir(), "nested", "datadir")
+
+	require.NoError(t, UpdateCacheFile(dataDir, "cache.json", []byte("value")))
+
+	data, err := LoadCacheFile(dataDir, "cache.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), data)
+
+	info, err := os.Stat(dataDir)
+	require.NoError(t, err)
+	require.Equal(t, DefaultDataDirMode, info.Mode().Perm())
+}
+
+func TestUpdateCacheFile_ShorterValue(t *testing.T) {
+	dataDir := t.TempDir()
+
+	require.NoError(t, UpdateCacheFile(dataDir, "cache.json", []byte(`[{"ip":"1.1.1.1"},{"ip":"2.2.2.2"}]`)))
+	require.NoError(t, UpdateCacheFile(dataDir, "cache.json", []byte(`[{"ip":"1.1.1.1"}]`)))
+
+	data, err := LoadCacheFile(dataDir, "cache.json")
+	require.NoError(t, err)
+	require.Equal(t, []byte(`[{"ip":"1.1.1.1"}]`), data)
+
+	// the temporary file was renamed over the cache file
+	entries, err := os.ReadDir(dataDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
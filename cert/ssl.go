@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
 
 	"github.com/bloXroute-Labs/bxcommon-go/types"
 )
@@ -176,6 +177,13 @@ func (s SSLCerts) NeedsPrivateCert() bool {
 	return s.privateCert == nil
 }
 
+// ClearPrivateCert discards the private certificate, e.g. after it was revoked, so NeedsPrivateCert returns true
+// until a new one is saved with SavePrivateCert. The private key is kept to request the new certificate.
+func (s *SSLCerts) ClearPrivateCert() {
+	s.privateCert = nil
+	s.privateKeyPair = nil
+}
+
 // CreateCSR returns a PEM encoded x509.CertificateRequest, generated using the registration only cert template
 // and signed with the private key
 func (s SSLCerts) CreateCSR() ([]byte, error) {
@@ -191,6 +199,18 @@ func (s SSLCerts) CreateCSR() ([]byte, error) {
 	return serializedCR, nil
 }
 
+// CertExpiry returns the expiry time of the certificate used to register the node with bxapi:
+// the private certificate once loaded, the registration only certificate otherwise
+func (s SSLCerts) CertExpiry() (time.Time, error) {
+	if s.privateCert != nil {
+		return s.privateCert.NotAfter, nil
+	}
+	if s.registrationOnlyCert.Raw == nil {
+		return time.Time{}, errors.New("registration only certificate has not been loaded")
+	}
+	return s.registrationOnlyCert.NotAfter, nil
+}
+
 // SerializeRegistrationCert returns the PEM encoded registration x509.Certificate
 func (s SSLCerts) SerializeRegistrationCert() ([]byte, error) {
 	return s.registrationOnlyCertBlock, nil
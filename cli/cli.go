@@ -2,36 +2,156 @@ package cli
 
 import (
 	"strings"
+	"unicode"
 )
 
-func ExtractArgsToMap(argsString string) map[string]string {
-	args := strings.Split(argsString, "--")
+// ArgsOption configures how ExtractArgsToMap and ExtractArgsToMultiMap parse the args
+type ArgsOption func(*argsOptions)
+
+type argsOptions struct {
+	shortFlags bool
+	// listKeys are the keys whose values are split on commas, nil if none and empty if all
+	listKeys map[string]bool
+}
+
+// WithShortFlags recognizes single-dash short flags besides the double-dash flags, e.g. "-r 1.1.1.1" or "-v".
+// Combined short flags such as "-vq" are separate flags, the value following them belonging to the last one.
+// Negative numbers like "-1" are values, not flags.
+func WithShortFlags() ArgsOption {
+	return func(o *argsOptions) {
+		o.shortFlags = true
+	}
+}
+
+// WithCommaLists splits the values of keys on commas with SplitList, e.g. "--relays 1.1.1.1, 2.2.2.2"
+// to the values "1.1.1.1" and "2.2.2.2". The values of all the keys are split if no keys are given.
+// ExtractArgsToMap keeps the last element of a split value.
+func WithCommaLists(keys ...string) ArgsOption {
+	return func(o *argsOptions) {
+		o.listKeys = make(map[string]bool, len(keys))
+		for _, key := range keys {
+			o.listKeys[key] = true
+		}
+	}
+}
+
+// isList returns whether the value of key is split on commas
+func (o argsOptions) isList(key string) bool {
+	return o.listKeys != nil && (len(o.listKeys) == 0 || o.listKeys[key])
+}
+
+func ExtractArgsToMap(argsString string, opts ...ArgsOption) map[string]string {
 	argsMap := make(map[string]string)
+	extractArgs(argsString, opts, func(key, value string) {
+		argsMap[key] = value
+	})
+	return argsMap
+}
 
+// ExtractArgsToMultiMap is like ExtractArgsToMap but keeps the values of all the occurrences of a key in order,
+// e.g. both relays of "--relay 1.1.1.1 --relay 2.2.2.2"
+func ExtractArgsToMultiMap(argsString string, opts ...ArgsOption) map[string][]string {
+	argsMap := make(map[string][]string)
+	extractArgs(argsString, opts, func(key, value string) {
+		argsMap[key] = append(argsMap[key], value)
+	})
+	return argsMap
+}
+
+// SplitList splits a comma separated list, trimming the spaces around its elements.
+// Empty elements are kept, so callers can reject an extra comma.
+func SplitList(value string) []string {
+	elements := strings.Split(value, ",")
+	for i, element := range elements {
+		elements[i] = strings.TrimSpace(element)
+	}
+	return elements
+}
+
+// extractArgs calls addArg with the key and value of every arg in argsString, in order
+func extractArgs(argsString string, opts []ArgsOption, addArg func(key, value string)) {
+	var options argsOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	addKeyValue := func(key, value string) {
+		if !options.isList(key) {
+			addArg(key, value)
+			return
+		}
+		for _, element := range SplitList(value) {
+			addArg(key, element)
+		}
+	}
+
+	args := strings.Split(argsString, "--")
 	for _, arg := range args {
 		arg = strings.TrimSpace(arg)
 		if arg == "" {
 			continue
 		}
-		switch {
-		case strings.Contains(arg, " "):
-			// arg key value are seperated by space
-			parts := strings.SplitN(arg, " ", 2)
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			argsMap[key] = value
-		case strings.Contains(arg, "="):
-			// arg key value are seperated by equals
-			parts := strings.SplitN(arg, "=", 2)
-			key := strings.TrimSpace(parts[0])
-			value := strings.TrimSpace(parts[1])
-			argsMap[key] = value
-		default:
-			// arg has only key
-			key := strings.TrimSpace(arg)
-			argsMap[key] = ""
+		if !options.shortFlags {
+			extractArg(arg, addKeyValue)
+			continue
+		}
+		for _, shortArg := range splitShortFlags(arg) {
+			extractArg(shortArg, addKeyValue)
 		}
 	}
+}
 
-	return argsMap
+// extractArg calls addArg with the key and value of a single arg without its dashes
+func extractArg(arg string, addArg func(key, value string)) {
+	switch {
+	case strings.Contains(arg, " "):
+		// arg key value are seperated by space
+		parts := strings.SplitN(arg, " ", 2)
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		addArg(key, value)
+	case strings.Contains(arg, "="):
+		// arg key value are seperated by equals
+		parts := strings.SplitN(arg, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+		addArg(key, value)
+	default:
+		// arg has only key
+		key := strings.TrimSpace(arg)
+		addArg(key, "")
+	}
+}
+
+// splitShortFlags splits arg before each short flag it contains, returning the args without their dash.
+// Combined short flags are returned as separate args, the words following them belonging to the last one.
+func splitShortFlags(arg string) []string {
+	var args []string
+	var words []string
+	for _, word := range strings.Fields(arg) {
+		if !isShortFlag(word) {
+			words = append(words, word)
+			continue
+		}
+		if len(words) > 0 {
+			args = append(args, strings.Join(words, " "))
+		}
+		flags, value, hasValue := strings.Cut(word[1:], "=")
+		shortFlags := []rune(flags)
+		for _, flag := range shortFlags[:len(shortFlags)-1] {
+			args = append(args, string(flag))
+		}
+		words = []string{string(shortFlags[len(shortFlags)-1])}
+		if hasValue {
+			words[0] += "=" + value
+		}
+	}
+	if len(words) > 0 {
+		args = append(args, strings.Join(words, " "))
+	}
+	return args
+}
+
+// isShortFlag returns whether word is a single-dash short flag such as "-v", but not a negative number
+func isShortFlag(word string) bool {
+	return len(word) > 1 && word[0] == '-' && unicode.IsLetter(rune(word[1]))
 }
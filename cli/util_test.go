@@ -30,3 +30,50 @@ func TestExtractArgsToMap(t *testing.T) {
 	assert.True(t, ok)
 	assert.Equal(t, value4, "")
 }
+
+func TestExtractArgsToMultiMap(t *testing.T) {
+	testArgString := "dummyCommand --relay 1.1.1.1 --key1 value1 --relay=2.2.2.2 --key2 --relay 3.3.3.3:1809"
+	argsMap := ExtractArgsToMultiMap(testArgString)
+
+	assert.Equal(t, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3:1809"}, argsMap["relay"])
+	assert.Equal(t, []string{"value1"}, argsMap["key1"])
+	assert.Equal(t, []string{""}, argsMap["key2"])
+
+	// the single value variant keeps the last value
+	assert.Equal(t, "3.3.3.3:1809", ExtractArgsToMap(testArgString)["relay"])
+}
+
+func TestExtractArgsToMultiMap_ShortFlags(t *testing.T) {
+	testArgString := "dummyCommand -r 1.1.1.1 --key1 value1 -vq -n=-1 --key2 -x value2 value2"
+	argsMap := ExtractArgsToMultiMap(testArgString, WithShortFlags())
+
+	assert.Equal(t, []string{"1.1.1.1"}, argsMap["r"])
+	assert.Equal(t, []string{"value1"}, argsMap["key1"])
+	// combined short flags
+	assert.Equal(t, []string{""}, argsMap["v"])
+	assert.Equal(t, []string{""}, argsMap["q"])
+	// a negative number is a value
+	assert.Equal(t, []string{"-1"}, argsMap["n"])
+	assert.Equal(t, []string{""}, argsMap["key2"])
+	assert.Equal(t, []string{"value2 value2"}, argsMap["x"])
+
+	// short flags are not recognized by default
+	assert.Equal(t, "1.1.1.1 -r 2.2.2.2", ExtractArgsToMap("--relay 1.1.1.1 -r 2.2.2.2")["relay"])
+}
+
+func TestExtractArgsToMultiMap_CommaLists(t *testing.T) {
+	testArgString := "--relays 1.1.1.1, 2.2.2.2:1809 --relays auto --name a,b"
+	argsMap := ExtractArgsToMultiMap(testArgString, WithCommaLists("relays"))
+	assert.Equal(t, []string{"1.1.1.1", "2.2.2.2:1809", "auto"}, argsMap["relays"])
+	assert.Equal(t, []string{"a,b"}, argsMap["name"])
+
+	argsMap = ExtractArgsToMultiMap(testArgString, WithCommaLists())
+	assert.Equal(t, []string{"a", "b"}, argsMap["name"])
+
+	assert.Equal(t, "b", ExtractArgsToMap(testArgString, WithCommaLists())["name"])
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Equal(t, []string{"1.1.1.1", "2.2.2.2", ""}, SplitList(" 1.1.1.1 ,2.2.2.2,"))
+	assert.Equal(t, []string{""}, SplitList(""))
+}
@@ -0,0 +1,49 @@
+package sdnsdk
+
+import (
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/bloXroute-Labs/bxcommon-go/cache"
+)
+
+// CacheFS is the storage of the SDN cache files. Names are slash separated paths.
+type CacheFS interface {
+	fs.FS
+	// WriteFile writes data to the named file, creating its directory with dirMode if it does not exist
+	WriteFile(name string, data []byte, dirMode fs.FileMode) error
+}
+
+// OSCacheFS stores the cache files in the OS filesystem. Unlike os.DirFS, names may be absolute paths.
+var OSCacheFS CacheFS = osCacheFS{}
+
+type osCacheFS struct{}
+
+// Open opens the named file of the OS filesystem
+func (osCacheFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// WriteFile replaces the named file of the OS filesystem with data, writing it to a temporary file first
+func (osCacheFS) WriteFile(name string, data []byte, dirMode fs.FileMode) error {
+	if err := os.MkdirAll(path.Dir(name), dirMode); err != nil {
+		return err
+	}
+	return cache.WriteFileAtomic(name, data, 0644)
+}
+
+// ReadOnlyCacheFS serves the cache files from fsys, e.g. a baseline cache in an embed.FS.
+// Writing the cache files fails with fs.ErrPermission.
+func ReadOnlyCacheFS(fsys fs.FS) CacheFS {
+	return readOnlyCacheFS{FS: fsys}
+}
+
+type readOnlyCacheFS struct {
+	fs.FS
+}
+
+// WriteFile fails as the filesystem is read-only
+func (readOnlyCacheFS) WriteFile(name string, _ []byte, _ fs.FileMode) error {
+	return &fs.PathError{Op: "write", Path: name, Err: fs.ErrPermission}
+}
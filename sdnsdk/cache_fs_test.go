@@ -0,0 +1,236 @@
+package sdnsdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/bloXroute-Labs/bxcommon-go/cert"
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memCacheFS is an in-memory CacheFS
+type memCacheFS struct {
+	mu    sync.Mutex
+	files fstest.MapFS
+	// writes is the number of files written
+	writes int
+}
+
+func newMemCacheFS() *memCacheFS {
+	return &memCacheFS{files: fstest.MapFS{}}
+}
+
+func (m *memCacheFS) Open(name string) (fs.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.files.Open(name)
+}
+
+func (m *memCacheFS) WriteFile(name string, data []byte, _ fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = &fstest.MapFile{Data: append([]byte(nil), data...), Mode: 0644}
+	m.writes++
+	return nil
+}
+
+func TestSDNHTTP_CacheFS(t *testing.T) {
+	available := true
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"message": "503 Service Unavailable" }`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`))
+	}
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler}})
+	defer server.Close()
+
+	cacheFS := newMemCacheFS()
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "datadir", WithCacheFS(cacheFS)).(*realSDNHTTP)
+
+	resp, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	require.NoError(t, err)
+	cached, err := LoadCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName)
+	require.NoError(t, err)
+	assert.Equal(t, resp, cached)
+	assert.Empty(t, sdn.ResponsesFromCache())
+
+	available = false
+	cachedResp, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	require.NoError(t, err)
+	assert.Equal(t, resp, cachedResp)
+	assert.Equal(t, []string{blockchainNetworkCacheFileName}, sdn.ResponsesFromCache())
+
+	available = true
+	_, err = sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	require.NoError(t, err)
+	assert.Empty(t, sdn.ResponsesFromCache())
+
+	// nothing is written to the working directory
+	_, err = LoadCacheFile("datadir", blockchainNetworkCacheFileName)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSDNHTTP_ReadOnlyCacheFS(t *testing.T) {
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks/{networkNum}",
+		handler: mockServiceError(t, http.StatusServiceUnavailable, `{"message": "503 Service Unavailable" }`)}})
+	defer server.Close()
+
+	baseline := fstest.MapFS{
+		"cache/" + blockchainNetworkCacheFileName: &fstest.MapFile{Data: []byte(`{"version":1,"saved_at":"2024-03-01T12:00:00Z","payload":{"network":"Mainnet","network_num":5}}`)},
+	}
+	cacheFS := ReadOnlyCacheFS(baseline)
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "cache", WithCacheFS(cacheFS)).(*realSDNHTTP)
+
+	resp, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"network":"Mainnet","network_num":5}`, string(resp))
+
+	err = UpdateCacheFileFS(cacheFS, "cache", blockchainNetworkCacheFileName, []byte(`{}`), DefaultDataDirMode)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
+
+func TestSDNHTTP_CachePolicy(t *testing.T) {
+	available := true
+	respond := func(body string) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !available {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}
+	}
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: respond(`{"network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`)},
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: respond(`[{"ip":"2.2.2.2", "port":1809}]`)},
+	})
+	defer server.Close()
+
+	cacheFS := newMemCacheFS()
+	sslCerts := cert.SSLCerts{}
+	nodeModel := message.NodeModel{ExternalIP: "172.0.0.1", NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", BlockchainNetworkNum: 5}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "datadir", WithCacheFS(cacheFS),
+		WithCachePolicy(map[CacheEndpoint]bool{CacheEndpointPotentialRelays: false})).(*realSDNHTTP)
+	sdn.SetNetworks(message.BlockchainNetworks{})
+
+	require.NoError(t, sdn.FetchBlockchainNetwork())
+	_, err := sdn.getRelays(nodeModel.NodeID, 5)
+	require.NoError(t, err)
+	_, err = LoadCacheFileFS(cacheFS, "datadir", networkCacheFileName(blockchainNetworkCacheFileName, 5))
+	assert.NoError(t, err)
+	_, err = LoadCacheFileFS(cacheFS, "datadir", networkCacheFileName(potentialRelaysFileName, 5))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// a potential relays cache file left by a previous run is not used either
+	require.NoError(t, cacheFS.WriteFile("datadir/"+networkCacheFileName(potentialRelaysFileName, 5), []byte(`[{"ip":"3.3.3.3", "port":1809}]`), 0))
+	available = false
+	require.NoError(t, sdn.FetchBlockchainNetwork())
+	_, err = sdn.getRelays(nodeModel.NodeID, 5)
+	assert.ErrorIs(t, err, ErrSDNUnavailable)
+	assert.Equal(t, []string{networkCacheFileName(blockchainNetworkCacheFileName, 5)}, sdn.ResponsesFromCache())
+}
+
+func TestSDNHTTP_CachePolicy_AccountsCachedSeparately(t *testing.T) {
+	available := true
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/{endpoint}/{accountID}", handler: func(w http.ResponseWriter, r *http.Request) {
+			if !available {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = fmt.Fprintf(w, `{"account_id":"%v","tier_name":"EnterpriseElite"}`, mux.Vars(r)["accountID"])
+		}},
+	})
+	defer server.Close()
+
+	cacheFS := newMemCacheFS()
+	sslCerts := cert.SSLCerts{}
+	nodeModel := message.NodeModel{ExternalIP: "172.0.0.1", AccountID: "node-account"}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "datadir", WithCacheFS(cacheFS),
+		WithCachePolicy(map[CacheEndpoint]bool{CacheEndpointAccounts: true})).(*realSDNHTTP)
+
+	_, err := sdn.fetchNodeAccountModel("node-account")
+	require.NoError(t, err)
+	_, err = sdn.FetchCustomerAccountModel("customer-account")
+	require.NoError(t, err)
+
+	// each account is served from its own cache file while the SDN is unavailable
+	available = false
+	account, err := sdn.fetchNodeAccountModel("node-account")
+	require.NoError(t, err)
+	assert.Equal(t, types.AccountID("node-account"), account.AccountID)
+	customerAccount, err := sdn.FetchCustomerAccountModel("customer-account")
+	require.NoError(t, err)
+	assert.Equal(t, types.AccountID("customer-account"), customerAccount.AccountID)
+	_, err = sdn.FetchCustomerAccountModel("node-account")
+	assert.ErrorContains(t, err, "can't load cache file "+accountCacheFileName(CacheEndpointAccounts, "node-account"))
+}
+
+func TestUpdateCacheFileFS_Envelope(t *testing.T) {
+	cacheFS := newMemCacheFS()
+	value := []byte(`{"network": "Mainnet", "network_num": 5}`)
+	require.NoError(t, UpdateCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName, value, DefaultDataDirMode))
+
+	data, err := fs.ReadFile(cacheFS, "datadir/"+blockchainNetworkCacheFileName)
+	require.NoError(t, err)
+	var envelope cacheFileEnvelope
+	require.NoError(t, json.Unmarshal(data, &envelope))
+	assert.Equal(t, CacheFileVersion, envelope.Version)
+	assert.False(t, envelope.SavedAt.IsZero())
+
+	// the payload is loaded byte for byte
+	payload, err := LoadCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName)
+	require.NoError(t, err)
+	assert.Equal(t, value, payload)
+
+	assert.Error(t, UpdateCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName, []byte(`{"network":`), DefaultDataDirMode))
+}
+
+func TestUpdateCacheFileFS_Unchanged(t *testing.T) {
+	cacheFS := newMemCacheFS()
+	value := []byte(`{"network": "Mainnet", "network_num": 5}`)
+	require.NoError(t, UpdateCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName, value, DefaultDataDirMode))
+	require.NoError(t, UpdateCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName, value, DefaultDataDirMode))
+	// the unchanged value is not written again
+	assert.Equal(t, 1, cacheFS.writes)
+
+	changed := []byte(`{"network": "Mainnet", "network_num": 5, "min_tx_age_seconds": 2}`)
+	require.NoError(t, UpdateCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName, changed, DefaultDataDirMode))
+	assert.Equal(t, 2, cacheFS.writes)
+	payload, err := LoadCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName)
+	require.NoError(t, err)
+	assert.Equal(t, changed, payload)
+
+	// a corrupt cache file is rewritten
+	require.NoError(t, cacheFS.WriteFile("datadir/"+blockchainNetworkCacheFileName, []byte(`{"version":1,"payl`), DefaultDataDirMode))
+	require.NoError(t, UpdateCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName, changed, DefaultDataDirMode))
+	assert.Equal(t, 4, cacheFS.writes)
+	payload, err = LoadCacheFileFS(cacheFS, "datadir", blockchainNetworkCacheFileName)
+	require.NoError(t, err)
+	assert.Equal(t, changed, payload)
+}
+
+func TestUpdateCacheFile_ShorterPayload(t *testing.T) {
+	dataDir := t.TempDir()
+	require.NoError(t, UpdateCacheFile(dataDir, potentialRelaysFileName, []byte(`[{"ip":"1.1.1.1","port":1809},{"ip":"2.2.2.2","port":1809}]`)))
+	require.NoError(t, UpdateCacheFile(dataDir, potentialRelaysFileName, []byte(`[{"ip":"1.1.1.1","port":1809}]`)))
+
+	// the shorter payload replaces the previous one entirely
+	payload, err := LoadCacheFile(dataDir, potentialRelaysFileName)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`[{"ip":"1.1.1.1","port":1809}]`), payload)
+}
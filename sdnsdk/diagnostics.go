@@ -0,0 +1,44 @@
+package sdnsdk
+
+import (
+	"encoding/json"
+
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+)
+
+// diagnosticSnapshot is the JSON document returned by DiagnosticSnapshot
+type diagnosticSnapshot struct {
+	NodeModel           *message.NodeModel         `json:"node_model"`
+	AccountModel        *message.Account           `json:"account_model"`
+	Networks            message.BlockchainNetworks `json:"networks"`
+	ConnectedAutoRelays []RelayStatus              `json:"connected_auto_relays"`
+}
+
+// DiagnosticSnapshot returns a JSON document with the node model, the account model, the blockchain networks
+// and the connected auto relays of the client, e.g. to attach to a support ticket. The account secret hash and
+// the certificate material are redacted. The account model is null until it is loaded, and the connected
+// auto relays are empty until DirectRelayConnectionsContext is called.
+func (s *realSDNHTTP) DiagnosticSnapshot() ([]byte, error) {
+	snapshot := diagnosticSnapshot{
+		Networks:            s.SnapshotNetworks(),
+		ConnectedAutoRelays: []RelayStatus{},
+	}
+	if nodeModel := s.NodeModel(); nodeModel != nil {
+		redactedNodeModel := *nodeModel
+		redactedNodeModel.Cert = message.RedactSecret(redactedNodeModel.Cert)
+		redactedNodeModel.Csr = message.RedactSecret(redactedNodeModel.Csr)
+		snapshot.NodeModel = &redactedNodeModel
+	}
+	if s.AccountModelLoaded() {
+		accountModel := s.AccountModel().Redacted()
+		snapshot.AccountModel = &accountModel
+	}
+
+	s.mu.RLock()
+	relayConnections := s.relayConnections
+	s.mu.RUnlock()
+	if relayConnections != nil {
+		snapshot.ConnectedAutoRelays = s.relayTracker(relayConnections).ConnectedAutoRelays()
+	}
+	return json.Marshal(snapshot)
+}
@@ -0,0 +1,60 @@
+package sdnsdk
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bloXroute-Labs/bxcommon-go/cert"
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/syncmap"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSDNHTTP_DiagnosticSnapshot(t *testing.T) {
+	sslCerts := cert.SSLCerts{}
+	nodeModel := message.NodeModel{NodeID: "node", ExternalIP: "172.0.0.1", Cert: "-----BEGIN CERTIFICATE-----", BlockchainNetworkNum: 5}
+	sdn := NewSDNHTTP(&sslCerts, "", nodeModel, "").(*realSDNHTTP)
+
+	// the account model and the relays are not loaded yet
+	data, err := sdn.DiagnosticSnapshot()
+	require.NoError(t, err)
+	var snapshot map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.JSONEq(t, `null`, string(snapshot["account_model"]))
+	assert.JSONEq(t, `[]`, string(snapshot["connected_auto_relays"]))
+
+	sdn.accountModel = &message.Account{AccountInfo: message.AccountInfo{AccountID: "account"}, SecretHash: "1234"}
+	sdn.SetNetworks(message.BlockchainNetworks{5: {Network: "Mainnet", NetworkNum: 5}})
+	relayConnections := syncmap.NewStringMapOf[types.RelayInfo]()
+	tracker := NewRelayConnectionTracker(relayConnections)
+	tracker.MarkAutoConnected("1.1.1.1", 1809)
+	tracker.MarkConnected("2.2.2.2", 1809, true)
+	sdn.relayConnections = relayConnections
+
+	data, err = sdn.DiagnosticSnapshot()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "1234")
+	assert.NotContains(t, string(data), "BEGIN CERTIFICATE")
+
+	var decoded struct {
+		NodeModel           message.NodeModel          `json:"node_model"`
+		AccountModel        message.Account            `json:"account_model"`
+		Networks            message.BlockchainNetworks `json:"networks"`
+		ConnectedAutoRelays []RelayStatus              `json:"connected_auto_relays"`
+	}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, types.NodeID("node"), decoded.NodeModel.NodeID)
+	assert.Equal(t, message.Redacted, decoded.NodeModel.Cert)
+	assert.Empty(t, decoded.NodeModel.Csr)
+	assert.Equal(t, types.AccountID("account"), decoded.AccountModel.AccountID)
+	assert.Equal(t, message.Redacted, decoded.AccountModel.SecretHash)
+	assert.Contains(t, decoded.Networks, types.NetworkNum(5))
+	require.Len(t, decoded.ConnectedAutoRelays, 1)
+	assert.Equal(t, "1.1.1.1", decoded.ConnectedAutoRelays[0].IP)
+
+	// the client state is not modified
+	assert.Equal(t, "1234", sdn.AccountModel().SecretHash)
+	assert.Equal(t, "-----BEGIN CERTIFICATE-----", sdn.NodeModel().Cert)
+}
@@ -1,11 +1,14 @@
 package message
 
 import (
+	"cmp"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bloXroute-Labs/bxcommon-go/types"
@@ -57,9 +60,46 @@ func (at AccountTier) GetRequestPriority() int {
 	return priority
 }
 
-// IsAtLeast indicates whether the account tier is higher or equal to minimumTier
+// accountTierOrder lists the account tiers from lowest to highest
+var accountTierOrder = []AccountTier{
+	ATierIntroductory,
+	ATierDeveloper,
+	ATierProfessional,
+	ATierEnterprise,
+	ATierElite,
+	ATierUltra,
+}
+
+// ParseAccountTier returns the account tier with the given name, ignoring case
+func ParseAccountTier(name string) (AccountTier, error) {
+	for _, tier := range accountTierOrder {
+		if strings.EqualFold(name, string(tier)) {
+			return tier, nil
+		}
+	}
+	return "", fmt.Errorf("unrecognized account tier: %v", name)
+}
+
+// Rank returns the position of the account tier in the canonical ordering
+// Introductory < Developer < Professional < Enterprise < EnterpriseElite < Ultra, starting at 1.
+// Unknown tiers have rank 0 and are ordered below all known tiers.
+func (at AccountTier) Rank() int {
+	for i, tier := range accountTierOrder {
+		if at == tier {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or +1 depending on whether the account tier is lower, equal or higher than other
+func (at AccountTier) Compare(other AccountTier) int {
+	return cmp.Compare(at.Rank(), other.Rank())
+}
+
+// IsAtLeast indicates whether the account tier is higher or equal to minimumTier in the canonical ordering
 func (at AccountTier) IsAtLeast(minimumTier AccountTier) bool {
-	return at.GetRequestPriority() >= minimumTier.GetRequestPriority()
+	return at.Compare(minimumTier) >= 0
 }
 
 // IsUltra indicates whether the account tier is ultra
@@ -314,6 +354,49 @@ type AccountInfo struct {
 // IsTrusted indicates whether the account is trusted
 func (a *Account) IsTrusted() bool { return !a.Untrusted || a.Miner }
 
+// Redacted replaces the non-empty secrets in logs and diagnostics
+const Redacted = "[REDACTED]"
+
+// accountFields has the fields of Account without its String and GoString methods
+type accountFields Account
+
+// Redacted returns a copy of the account whose secret hash and certificate are replaced with Redacted,
+// e.g. to log it or dump it for diagnostics
+func (a Account) Redacted() Account {
+	a.SecretHash = RedactSecret(a.SecretHash)
+	a.Certificate = RedactSecret(a.Certificate)
+	return a
+}
+
+// String formats the account like %+v with the secrets redacted, so printing an account never leaks them
+func (a Account) String() string {
+	return fmt.Sprintf("%+v", accountFields(a.Redacted()))
+}
+
+// GoString formats the account like %#v with the secrets redacted
+func (a Account) GoString() string {
+	return "message.Account" + strings.TrimPrefix(fmt.Sprintf("%#v", accountFields(a.Redacted())), "message.accountFields")
+}
+
+// accountSecretsJSON matches the non-empty secret hash and certificate of an account,
+// and the certificate and CSR of a node model, in JSON
+var accountSecretsJSON = regexp.MustCompile(`("(?:secret_hash|certificate|cert|csr)"\s*:\s*)"(?:[^"\\]|\\.)+"`)
+
+// RedactAccountJSON returns data, e.g. an SDN response which could not be decoded into an Account,
+// with the non-empty secret hash and certificate values replaced with Redacted so it can be logged.
+// The cert and csr values of a node model are replaced too.
+func RedactAccountJSON(data []byte) []byte {
+	return accountSecretsJSON.ReplaceAll(data, []byte(`${1}"`+Redacted+`"`))
+}
+
+// RedactSecret returns Redacted for a non-empty secret, keeping an empty one empty
+func RedactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return Redacted
+}
+
 // GetDefaultEliteAccount get a default elite account by current time
 func GetDefaultEliteAccount(now time.Time) Account {
 	return Account{
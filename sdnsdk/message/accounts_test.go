@@ -0,0 +1,89 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccountTierOrdering(t *testing.T) {
+	for i, tier := range accountTierOrder {
+		require.NoError(t, tier.IsValid())
+		for j, other := range accountTierOrder {
+			assert.Equal(t, i >= j, tier.IsAtLeast(other), "%v.IsAtLeast(%v)", tier, other)
+		}
+	}
+
+	assert.True(t, ATierUltra.IsAtLeast(ATierElite))
+	assert.True(t, ATierElite.IsAtLeast(ATierEnterprise))
+	assert.True(t, ATierProfessional.IsAtLeast(ATierDeveloper))
+	assert.False(t, ATierDeveloper.IsAtLeast(ATierProfessional))
+	assert.Equal(t, -1, ATierDeveloper.Compare(ATierProfessional))
+	assert.Equal(t, 0, ATierEnterprise.Compare(ATierEnterprise))
+	assert.Equal(t, 1, ATierElite.Compare(ATierEnterprise))
+}
+
+func TestAccountTierOrdering_UnknownTier(t *testing.T) {
+	unknown := AccountTier("Unknown")
+
+	assert.Equal(t, 0, unknown.Rank())
+	assert.False(t, unknown.IsAtLeast(ATierIntroductory))
+	assert.True(t, ATierIntroductory.IsAtLeast(unknown))
+	assert.True(t, unknown.IsAtLeast(AccountTier("")))
+	assert.Equal(t, -1, unknown.Compare(ATierIntroductory))
+}
+
+func TestParseAccountTier(t *testing.T) {
+	tier, err := ParseAccountTier("Enterprise")
+	require.NoError(t, err)
+	assert.Equal(t, ATierEnterprise, tier)
+
+	tier, err = ParseAccountTier("enterpriseelite")
+	require.NoError(t, err)
+	assert.Equal(t, ATierElite, tier)
+
+	tier, err = ParseAccountTier("ULTRA")
+	require.NoError(t, err)
+	assert.Equal(t, ATierUltra, tier)
+
+	_, err = ParseAccountTier("Platinum")
+	require.Error(t, err)
+
+	_, err = ParseAccountTier("")
+	require.Error(t, err)
+}
+
+func TestAccount_RedactedFormatting(t *testing.T) {
+	account := Account{AccountInfo: AccountInfo{AccountID: "account", Certificate: "-----BEGIN CERTIFICATE-----"}, SecretHash: "1234"}
+
+	for _, formatted := range []string{
+		fmt.Sprint(account),
+		fmt.Sprintf("%v", &account),
+		fmt.Sprintf("%+v", account),
+		fmt.Sprintf("%#v", account),
+		fmt.Sprintf("%s", account),
+	} {
+		assert.NotContains(t, formatted, "1234")
+		assert.NotContains(t, formatted, "BEGIN CERTIFICATE")
+		assert.Contains(t, formatted, Redacted)
+		assert.Contains(t, formatted, "account")
+	}
+	assert.True(t, strings.HasPrefix(fmt.Sprintf("%#v", account), "message.Account{"))
+	assert.Equal(t, "", RedactSecret(""))
+	assert.Equal(t, Redacted, RedactSecret("1234"))
+	// the account is not modified and its JSON still holds the secrets, e.g. for the cache files
+	assert.Equal(t, "1234", account.SecretHash)
+	data, err := json.Marshal(account)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"secret_hash":"1234"`)
+
+	redactedJSON := RedactAccountJSON([]byte(`{"account_id":"account","secret_hash": "12\"34","certificate":"cert","tier_name":`))
+	assert.Equal(t, `{"account_id":"account","secret_hash": "[REDACTED]","certificate":"[REDACTED]","tier_name":`, string(redactedJSON))
+	// the node model certificate and CSR are redacted too, empty values are kept
+	redactedJSON = RedactAccountJSON([]byte(`{"node_id":"node","cert":"pem","csr":"","certificate_expiry":"2025"}`))
+	assert.Equal(t, `{"node_id":"node","cert":"[REDACTED]","csr":"","certificate_expiry":"2025"}`, string(redactedJSON))
+}
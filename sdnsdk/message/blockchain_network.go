@@ -2,6 +2,11 @@ package message
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/bloXroute-Labs/bxcommon-go/types"
 )
@@ -26,6 +31,13 @@ type BlockchainAttributes struct {
 	ETHShanghaiMergeTimeUnix int64 `json:"eth_shanghai_merge_time_unix"`
 }
 
+// PostMergeTerminalTotalDifficulty returns the terminal total difficulty set on Ethereum networks
+// which the SDN reports with a zero terminal total difficulty. The value is math.MaxInt64
+// on every platform, so the difficulty is never reached regardless of the word size.
+func PostMergeTerminalTotalDifficulty() *big.Int {
+	return big.NewInt(math.MaxInt64)
+}
+
 // BlockchainNetwork represents network config for a given blockchain network being routed by bloxroute
 type BlockchainNetwork struct {
 	AllowTimeReuseSenderNonce              float64              `json:"allowed_time_reuse_sender_nonce"`
@@ -71,6 +83,51 @@ type BlockchainNetwork struct {
 	DeliverToNodePercent                   uint64               `json:"deliver_to_node_percent"`
 }
 
+// ApplyDefaults fills the attributes missing from the SDN response with their protocol defaults, i.e. the
+// PostMergeTerminalTotalDifficulty of Ethereum networks reported with a zero terminal total difficulty,
+// and checks that the attributes are in range
+func (bcn *BlockchainNetwork) ApplyDefaults() error {
+	if bcn.Protocol == types.EthereumProtocol && isZeroDifficulty(bcn.DefaultAttributes.TerminalTotalDifficulty) {
+		bcn.DefaultAttributes.TerminalTotalDifficulty = PostMergeTerminalTotalDifficulty()
+	}
+
+	if bcn.MinTxAgeSeconds < 0 || math.IsNaN(bcn.MinTxAgeSeconds) || math.IsInf(bcn.MinTxAgeSeconds, 0) {
+		return fmt.Errorf("min tx age %v seconds is out of range", bcn.MinTxAgeSeconds)
+	}
+	if bcn.MaxTxAgeSeconds < 0 {
+		return fmt.Errorf("max tx age %v seconds is negative", bcn.MaxTxAgeSeconds)
+	}
+	if bcn.MaxBlockSizeBytes < 0 || bcn.MaxTxSizeBytes < 0 {
+		return fmt.Errorf("max block size %v bytes or max tx size %v bytes is negative", bcn.MaxBlockSizeBytes, bcn.MaxTxSizeBytes)
+	}
+	if bcn.BlockConfirmationsCount < 0 {
+		return fmt.Errorf("block confirmations count %v is negative", bcn.BlockConfirmationsCount)
+	}
+	for _, percent := range []float64{bcn.TxPercentToLogByHash, bcn.TxPercentToLogBySid} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("tx percent to log %v is out of range", percent)
+		}
+	}
+	if bcn.DeliverToNodePercent > 100 {
+		return fmt.Errorf("deliver to node percent %v is out of range", bcn.DeliverToNodePercent)
+	}
+	return nil
+}
+
+// isZeroDifficulty returns whether a difficulty decoded from the SDN response is zero
+func isZeroDifficulty(difficulty interface{}) bool {
+	switch d := difficulty.(type) {
+	case float64:
+		return d == 0
+	case int:
+		return d == 0
+	case *big.Int:
+		return d != nil && d.Sign() == 0
+	default:
+		return false
+	}
+}
+
 // BlockchainNetworks represents the full message returned from bxapi
 type BlockchainNetworks map[types.NetworkNum]*BlockchainNetwork
 
@@ -83,6 +140,65 @@ func (bcn *BlockchainNetwork) UpdateFrom(network *BlockchainNetwork) {
 	bcn.EnableCheckSenderNonce = network.EnableCheckSenderNonce
 }
 
+// ChangedFields returns the JSON names of the fields which differ between the blockchain network and other
+func (bcn BlockchainNetwork) ChangedFields(other BlockchainNetwork) []string {
+	var changed []string
+	before := reflect.ValueOf(bcn)
+	after := reflect.ValueOf(other)
+	for i := 0; i < before.NumField(); i++ {
+		if reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(before.Type().Field(i).Tag.Get("json"), ",")
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// BlockchainNetworksDiff describes the changes between two sets of blockchain networks
+type BlockchainNetworksDiff struct {
+	// Added and Removed are sorted by network number
+	Added   []types.NetworkNum
+	Removed []types.NetworkNum
+	// Changed holds the JSON names of the changed fields by network number
+	Changed map[types.NetworkNum][]string
+}
+
+// IsEmpty returns whether the networks did not change
+func (d BlockchainNetworksDiff) IsEmpty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff returns the networks added, removed and changed in updated compared to the networks
+func (bcns BlockchainNetworks) Diff(updated BlockchainNetworks) BlockchainNetworksDiff {
+	diff := BlockchainNetworksDiff{Changed: make(map[types.NetworkNum][]string)}
+	for networkNum, network := range updated {
+		previous, exists := bcns[networkNum]
+		if !exists {
+			diff.Added = append(diff.Added, networkNum)
+			continue
+		}
+		var before, after BlockchainNetwork
+		if previous != nil {
+			before = *previous
+		}
+		if network != nil {
+			after = *network
+		}
+		if changedFields := before.ChangedFields(after); len(changedFields) > 0 {
+			diff.Changed[networkNum] = changedFields
+		}
+	}
+	for networkNum := range bcns {
+		if _, exists := updated[networkNum]; !exists {
+			diff.Removed = append(diff.Removed, networkNum)
+		}
+	}
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	return diff
+}
+
 // FindNetwork finds a BlockchainNetwork instance by its number and allow update
 func (bcns *BlockchainNetworks) FindNetwork(networkNum types.NetworkNum) (*BlockchainNetwork, error) {
 	if network, exists := (*bcns)[networkNum]; exists {
@@ -91,6 +207,53 @@ func (bcns *BlockchainNetworks) FindNetwork(networkNum types.NetworkNum) (*Block
 	return nil, fmt.Errorf("can't find blockchain network with network number %v", networkNum)
 }
 
+// FindNetworkByName finds a BlockchainNetwork instance by its network name (e.g. "BSC-Mainnet"), ignoring case.
+// A network whose name matches exactly is preferred, and if several networks match the same way,
+// the one with the lowest network number is returned.
+func (bcns *BlockchainNetworks) FindNetworkByName(name string) (*BlockchainNetwork, error) {
+	var found *BlockchainNetwork
+	for _, network := range *bcns {
+		if network == nil || !strings.EqualFold(network.Network, name) {
+			continue
+		}
+		if found == nil {
+			found = network
+			continue
+		}
+		exact, foundExact := network.Network == name, found.Network == name
+		if exact != foundExact {
+			if exact {
+				found = network
+			}
+			continue
+		}
+		if network.NetworkNum < found.NetworkNum {
+			found = network
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("can't find blockchain network with name %v", name)
+	}
+	return found, nil
+}
+
+// SortedNums returns the network numbers in ascending order
+func (bcns BlockchainNetworks) SortedNums() []types.NetworkNum {
+	nums := make([]types.NetworkNum, 0, len(bcns))
+	for networkNum := range bcns {
+		nums = append(nums, networkNum)
+	}
+	slices.Sort(nums)
+	return nums
+}
+
+// Each calls f with every network in ascending network number order, so the iteration order is deterministic
+func (bcns BlockchainNetworks) Each(f func(num types.NetworkNum, net *BlockchainNetwork)) {
+	for _, networkNum := range bcns.SortedNums() {
+		f(networkNum, bcns[networkNum])
+	}
+}
+
 // IsAllowedTier check if tier is allowed in blockchain network
 func (bcn *BlockchainNetwork) IsAllowedTier(clientTier AccountTier) bool {
 	switch bcn.AllowedFromTier {
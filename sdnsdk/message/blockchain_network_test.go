@@ -0,0 +1,98 @@
+package message
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlockchainNetwork_ApplyDefaults(t *testing.T) {
+	network := BlockchainNetwork{Protocol: types.EthereumProtocol, DefaultAttributes: BlockchainAttributes{TerminalTotalDifficulty: 0.0}}
+	require.NoError(t, network.ApplyDefaults())
+	assert.Equal(t, PostMergeTerminalTotalDifficulty(), network.DefaultAttributes.TerminalTotalDifficulty)
+
+	// a non zero difficulty and the difficulty of other protocols are kept
+	network = BlockchainNetwork{Protocol: types.EthereumProtocol, DefaultAttributes: BlockchainAttributes{TerminalTotalDifficulty: big.NewInt(100)}}
+	require.NoError(t, network.ApplyDefaults())
+	assert.Equal(t, big.NewInt(100), network.DefaultAttributes.TerminalTotalDifficulty)
+	network = BlockchainNetwork{Protocol: "Solana", DefaultAttributes: BlockchainAttributes{TerminalTotalDifficulty: 0.0}}
+	require.NoError(t, network.ApplyDefaults())
+	assert.Equal(t, 0.0, network.DefaultAttributes.TerminalTotalDifficulty)
+}
+
+func TestBlockchainNetwork_ApplyDefaults_OutOfRange(t *testing.T) {
+	for name, network := range map[string]BlockchainNetwork{
+		"negative min tx age":         {MinTxAgeSeconds: -1},
+		"NaN min tx age":              {MinTxAgeSeconds: math.NaN()},
+		"negative max tx age":         {MaxTxAgeSeconds: -1},
+		"negative max block size":     {MaxBlockSizeBytes: -1},
+		"negative confirmations":      {BlockConfirmationsCount: -1},
+		"tx percent to log over 100":  {TxPercentToLogByHash: 101},
+		"deliver to node percent 101": {DeliverToNodePercent: 101},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, network.ApplyDefaults())
+		})
+	}
+
+	network := BlockchainNetwork{MinTxAgeSeconds: 0.5, TxPercentToLogBySid: 100, DeliverToNodePercent: 100}
+	assert.NoError(t, network.ApplyDefaults())
+}
+
+func TestBlockchainNetworks_Each(t *testing.T) {
+	networks := BlockchainNetworks{
+		33: {NetworkNum: 33, Network: "Polygon-Mainnet"},
+		5:  {NetworkNum: 5, Network: "Mainnet"},
+		10: {NetworkNum: 10, Network: "BSC-Mainnet"},
+	}
+	assert.Equal(t, []types.NetworkNum{5, 10, 33}, networks.SortedNums())
+
+	var names []string
+	networks.Each(func(num types.NetworkNum, net *BlockchainNetwork) {
+		assert.Equal(t, num, net.NetworkNum)
+		names = append(names, net.Network)
+	})
+	assert.Equal(t, []string{"Mainnet", "BSC-Mainnet", "Polygon-Mainnet"}, names)
+
+	assert.Empty(t, BlockchainNetworks{}.SortedNums())
+}
+
+func TestBlockchainNetworks_FindNetworkByName(t *testing.T) {
+	networks := BlockchainNetworks{
+		5:  {NetworkNum: 5, Network: "Mainnet"},
+		10: {NetworkNum: 10, Network: "BSC-Mainnet"},
+		33: {NetworkNum: 33, Network: "Polygon-Mainnet"},
+		36: {NetworkNum: 36, Network: "polygon-mainnet"},
+	}
+
+	testCases := []struct {
+		name       string
+		lookup     string
+		networkNum types.NetworkNum
+		err        bool
+	}{
+		{name: "exact match", lookup: "BSC-Mainnet", networkNum: 10},
+		{name: "case-insensitive", lookup: "bsc-MAINNET", networkNum: 10},
+		{name: "exact match preferred", lookup: "polygon-mainnet", networkNum: 36},
+		{name: "lowest network number", lookup: "POLYGON-MAINNET", networkNum: 33},
+		{name: "not found", lookup: "Holesky", err: true},
+		{name: "empty", lookup: "", err: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			network, err := networks.FindNetworkByName(testCase.lookup)
+			if testCase.err {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "can't find blockchain network")
+				assert.Nil(t, network)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testCase.networkNum, network.NetworkNum)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package message
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/bloXroute-Labs/bxcommon-go/types"
 )
@@ -22,6 +25,42 @@ const (
 	NeRemoveAccessibleGateway       NodeEventType = "REMOVE_ACCESSIBLE_GATEWAY"
 )
 
+// ErrUnknownNodeEventType is returned by ParseNodeEventType for a node event type the SDN does not know
+var ErrUnknownNodeEventType = errors.New("unknown node event type")
+
+// NodeEventTypes are the node event types known to the SDN
+var NodeEventTypes = []NodeEventType{
+	NeOnline,
+	NeOffline,
+	NePeerConnEstablished,
+	NePeerConnClosed,
+	NePeerConnDisabled,
+	NeBlockchainNodeConnEstablished,
+	NeBlockchainNodeConnError,
+	NeAddAccessibleGateway,
+	NeRemoveAccessibleGateway,
+}
+
+// ParseNodeEventType returns the node event type named eventType, ignoring case and surrounding spaces,
+// or ErrUnknownNodeEventType if the SDN does not know it
+func ParseNodeEventType(eventType string) (NodeEventType, error) {
+	normalized := NodeEventType(strings.ToUpper(strings.TrimSpace(eventType)))
+	if !normalized.Valid() {
+		return "", fmt.Errorf("%w %q", ErrUnknownNodeEventType, eventType)
+	}
+	return normalized, nil
+}
+
+// Valid returns whether the node event type is known to the SDN
+func (t NodeEventType) Valid() bool {
+	for _, eventType := range NodeEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
 // NodeEvent represents a node event and its context being reported to the SDN
 // In most cases, NodeID refers to the peer
 type NodeEvent struct {
@@ -40,7 +79,7 @@ type NodeEvent struct {
 func NewNodeConnectionEvent(peerID types.NodeID, networkNum types.NetworkNum) NodeEvent {
 	return NodeEvent{
 		NodeID:    peerID,
-		Payload:   fmt.Sprint(networkNum),
+		Payload:   strconv.FormatUint(uint64(networkNum), 10),
 		EventType: NePeerConnEstablished,
 	}
 }
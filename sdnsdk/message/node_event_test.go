@@ -0,0 +1,24 @@
+package message
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNodeEventType(t *testing.T) {
+	for _, eventType := range NodeEventTypes {
+		parsed, err := ParseNodeEventType(string(eventType))
+		require.NoError(t, err)
+		assert.Equal(t, eventType, parsed)
+	}
+
+	parsed, err := ParseNodeEventType(" peer_conn_closed ")
+	require.NoError(t, err)
+	assert.Equal(t, NePeerConnClosed, parsed)
+
+	_, err = ParseNodeEventType("PEER_CONN_CLOSE")
+	assert.ErrorIs(t, err, ErrUnknownNodeEventType)
+	assert.False(t, NodeEventType("PEER_CONN_CLOSE").Valid())
+}
@@ -3,14 +3,22 @@ package message
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"strings"
 
 	log "github.com/bloXroute-Labs/bxcommon-go/logger"
 	"github.com/bloXroute-Labs/bxcommon-go/types"
 )
 
-// NodeModel represents metadata on a given node in the bloxroute network
+// NodeModel represents metadata on a given node in the bloxroute network.
+// It is decoded leniently from JSON, see UnmarshalJSON.
 type NodeModel struct {
+	// NodeType is the name of a types.NodeType, e.g. "EXTERNAL_GATEWAY", parsed by types.FromStringToNodeType.
+	// It is kept as a string, unlike the JSON encoding of types.NodeType, so node types unknown to this version are kept.
 	NodeType                  string           `json:"node_type"`
 	ExternalPort              int64            `json:"external_port"`
 	NonSSLPort                int              `json:"non_ssl_port"`
@@ -67,6 +75,69 @@ type NodeModel struct {
 	BlockchainRPCEnabled      bool             `json:"blockchain_rpc_enabled"`
 }
 
+// nodeModelJSON has the fields of NodeModel without its UnmarshalJSON method
+type nodeModelJSON NodeModel
+
+// strictNodeModelFields are the JSON names of the NodeModel fields identifying the node,
+// which UnmarshalJSON fails to decode if their value has an unexpected type
+var strictNodeModelFields = map[string]bool{
+	"node_id":                true,
+	"node_type":              true,
+	"external_ip":            true,
+	"external_port":          true,
+	"blockchain_network_num": true,
+	"account_id":             true,
+}
+
+// UnmarshalJSON decodes a node model leniently, so a field whose type changed in the SDN does not fail
+// the registration. The fields identifying the node, node_id, node_type, external_ip, external_port,
+// blockchain_network_num and account_id, must have the expected type. Any other field with an unexpected
+// type is logged and skipped, keeping its previous value.
+func (nm *NodeModel) UnmarshalJSON(data []byte) error {
+	err := json.Unmarshal(data, (*nodeModelJSON)(nm))
+	if err == nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return err
+	}
+
+	model := reflect.ValueOf(nm).Elem()
+	for i := 0; i < model.NumField(); i++ {
+		name, _, _ := strings.Cut(model.Type().Field(i).Tag.Get("json"), ",")
+		raw, ok := fields[name]
+		if !ok {
+			continue
+		}
+		value := reflect.New(model.Type().Field(i).Type)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			if strictNodeModelFields[name] {
+				return fmt.Errorf("could not deserialize node model field %v: %v", name, err)
+			}
+			log.Warnf("skipping node model field %v with unexpected value %s: %v", name, raw, err)
+			continue
+		}
+		model.Field(i).Set(value.Elem())
+	}
+	return nil
+}
+
+// ChangedFields returns the JSON names of the fields which differ between the node model and other
+func (nm NodeModel) ChangedFields(other NodeModel) []string {
+	var changed []string
+	before := reflect.ValueOf(nm)
+	after := reflect.ValueOf(other)
+	for i := 0; i < before.NumField(); i++ {
+		if reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			continue
+		}
+		name, _, _ := strings.Cut(before.Type().Field(i).Tag.Get("json"), ",")
+		changed = append(changed, name)
+	}
+	return changed
+}
+
 // Pack serializes a NodeModel into a buffer for sending
 func (nm NodeModel) Pack() []byte {
 	buf := new(bytes.Buffer)
@@ -77,3 +148,116 @@ func (nm NodeModel) Pack() []byte {
 	}
 	return buf.Bytes()
 }
+
+// DefaultSourceVersion is the source version of a NodeModel created by NewNodeModel unless overridden
+const DefaultSourceVersion = "0.0.0"
+
+// NodeModelOption configures a NodeModel created by NewNodeModel
+type NodeModelOption func(*NodeModel)
+
+// WithNodeType sets the node type of the model (EXTERNAL_GATEWAY by default)
+func WithNodeType(nodeType types.NodeType) NodeModelOption {
+	return func(nm *NodeModel) {
+		nm.NodeType = nodeType.String()
+	}
+}
+
+// WithSourceVersion sets the source version of the model
+func WithSourceVersion(sourceVersion string) NodeModelOption {
+	return func(nm *NodeModel) {
+		nm.SourceVersion = sourceVersion
+	}
+}
+
+// WithExternalAddress sets the external IP and port of the model
+func WithExternalAddress(ip string, port int64) NodeModelOption {
+	return func(nm *NodeModel) {
+		nm.ExternalIP = ip
+		nm.ExternalPort = port
+	}
+}
+
+// WithNodeID sets the node ID of the model
+func WithNodeID(nodeID types.NodeID) NodeModelOption {
+	return func(nm *NodeModel) {
+		nm.NodeID = nodeID
+	}
+}
+
+// WithBlockchainAddress sets the blockchain IP and port of the model
+func WithBlockchainAddress(ip string, port int) NodeModelOption {
+	return func(nm *NodeModel) {
+		nm.BlockchainIP = ip
+		nm.BlockchainPort = port
+	}
+}
+
+// NewNodeModel creates a NodeModel for the protocol and network, applying defaults for
+// the node type and source version, and validates it can be registered with the SDN
+func NewNodeModel(protocol, network string, opts ...NodeModelOption) (*NodeModel, error) {
+	nm := &NodeModel{
+		Protocol:      strings.TrimSpace(protocol),
+		Network:       strings.TrimSpace(network),
+		NodeType:      types.ExternalGateway.String(),
+		SourceVersion: DefaultSourceVersion,
+	}
+	for _, opt := range opts {
+		opt(nm)
+	}
+	if err := nm.Validate(); err != nil {
+		return nil, err
+	}
+	return nm, nil
+}
+
+// Validate checks the fields required to register the node model with the SDN
+func (nm NodeModel) Validate() error {
+	if nm.Protocol == "" {
+		return fmt.Errorf("node model protocol is required")
+	}
+	if nm.Network == "" {
+		return fmt.Errorf("node model network is required")
+	}
+	if _, err := types.FromStringToNodeType(nm.NodeType); err != nil {
+		return fmt.Errorf("node model has invalid node type: %v", err)
+	}
+	if nm.SourceVersion == "" {
+		return fmt.Errorf("node model source version is required")
+	}
+	if nm.ExternalPort < 0 || nm.ExternalPort > math.MaxUint16 {
+		return fmt.Errorf("node model external port %v is out of range", nm.ExternalPort)
+	}
+	return nil
+}
+
+// ErrExternalPortConflict is returned by CheckExternalPortConflicts when another node uses the same external address
+var ErrExternalPortConflict = errors.New("external address is already used by another node")
+
+// CheckExternalPortConflicts returns ErrExternalPortConflict if one of the local node models, e.g. the other
+// gateways running on the host, has the same external IP and port as the node model. Node models with the
+// same node ID, i.e. earlier registrations of the node, and node models without an external port are ignored.
+func (nm NodeModel) CheckExternalPortConflicts(localNodeModels []NodeModel) error {
+	if nm.ExternalPort == 0 {
+		return nil
+	}
+	for _, other := range localNodeModels {
+		if other.ExternalPort != nm.ExternalPort || !sameIP(other.ExternalIP, nm.ExternalIP) {
+			continue
+		}
+		if nm.NodeID != "" && other.NodeID == nm.NodeID {
+			continue
+		}
+		return fmt.Errorf("%w: %v:%v of the %v node is used by the %v node %v, configure a different external port",
+			ErrExternalPortConflict, nm.ExternalIP, nm.ExternalPort, nm.NodeType, other.NodeType, other.NodeID)
+	}
+	return nil
+}
+
+// sameIP returns whether the IP addresses are equal, comparing parsed addresses so different notations match
+func sameIP(ip, other string) bool {
+	parsedIP, parsedOther := net.ParseIP(ip), net.ParseIP(other)
+	if parsedIP == nil || parsedOther == nil {
+		return strings.EqualFold(ip, other)
+	}
+	return parsedIP.Equal(parsedOther)
+}
@@ -0,0 +1,123 @@
+package message
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNodeModel(t *testing.T) {
+	nm, err := NewNodeModel(types.EthereumProtocol, "Mainnet")
+	require.NoError(t, err)
+	assert.Equal(t, types.EthereumProtocol, nm.Protocol)
+	assert.Equal(t, "Mainnet", nm.Network)
+	assert.Equal(t, "EXTERNAL_GATEWAY", nm.NodeType)
+	assert.Equal(t, DefaultSourceVersion, nm.SourceVersion)
+
+	var packed NodeModel
+	require.NoError(t, json.Unmarshal(nm.Pack(), &packed))
+	assert.Equal(t, *nm, packed)
+	assert.NoError(t, packed.Validate())
+}
+
+func TestNewNodeModel_Options(t *testing.T) {
+	nm, err := NewNodeModel(" Ethereum ", "Mainnet",
+		WithNodeType(types.InternalGateway),
+		WithSourceVersion("2.108.3.0"),
+		WithExternalAddress("11.113.164.111", 1801),
+		WithNodeID("35299c61-55ad-4565-85a3-0cd985953fac"),
+		WithBlockchainAddress("52.221.255.145", 30303),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "Ethereum", nm.Protocol)
+	assert.Equal(t, "INTERNAL_GATEWAY", nm.NodeType)
+	assert.Equal(t, "2.108.3.0", nm.SourceVersion)
+	assert.Equal(t, "11.113.164.111", nm.ExternalIP)
+	assert.Equal(t, int64(1801), nm.ExternalPort)
+	assert.Equal(t, types.NodeID("35299c61-55ad-4565-85a3-0cd985953fac"), nm.NodeID)
+	assert.Equal(t, "52.221.255.145", nm.BlockchainIP)
+	assert.Equal(t, 30303, nm.BlockchainPort)
+}
+
+func TestNewNodeModel_Invalid(t *testing.T) {
+	testTable := []struct {
+		name     string
+		protocol string
+		network  string
+		opts     []NodeModelOption
+	}{
+		{name: "missing protocol", network: "Mainnet"},
+		{name: "missing network", protocol: types.EthereumProtocol, network: " "},
+		{name: "unknown node type", protocol: types.EthereumProtocol, network: "Mainnet", opts: []NodeModelOption{WithNodeType(types.NodeType(0))}},
+		{name: "empty source version", protocol: types.EthereumProtocol, network: "Mainnet", opts: []NodeModelOption{WithSourceVersion("")}},
+		{name: "invalid port", protocol: types.EthereumProtocol, network: "Mainnet", opts: []NodeModelOption{WithExternalAddress("11.113.164.111", 70000)}},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			nm, err := NewNodeModel(testCase.protocol, testCase.network, testCase.opts...)
+			assert.Error(t, err)
+			assert.Nil(t, nm)
+		})
+	}
+}
+
+func TestNodeModel_ChangedFields(t *testing.T) {
+	before := NodeModel{Protocol: "Ethereum", Network: "Mainnet", SdnID: nil}
+	after := before
+	assert.Empty(t, before.ChangedFields(after))
+
+	after.NodeID = "35299c61-55ad-4565-85a3-0cd985953fac"
+	after.BlockchainNetworkNum = 5
+	after.SdnID = "1e5c6fda-f775-49d4-bd11-287526c07f0f"
+	assert.Equal(t, []string{"node_id", "blockchain_network_num", "sdn_id"}, before.ChangedFields(after))
+}
+
+func TestNodeModel_UnmarshalJSON_Lenient(t *testing.T) {
+	var nm NodeModel
+	require.NoError(t, json.Unmarshal([]byte(`{"node_id":"35299c61-55ad-4565-85a3-0cd985953fac","node_type":"EXTERNAL_GATEWAY",
+		"blockchain_network_num":5,"sid_expire_time":"soon","continent":"NA","split_relays":1,"idx":"7"}`), &nm))
+	assert.Equal(t, types.NodeID("35299c61-55ad-4565-85a3-0cd985953fac"), nm.NodeID)
+	assert.Equal(t, "EXTERNAL_GATEWAY", nm.NodeType)
+	assert.Equal(t, types.NetworkNum(5), nm.BlockchainNetworkNum)
+	assert.Equal(t, "NA", nm.Continent)
+	// the fields with an unexpected type are skipped
+	assert.Zero(t, nm.SidExpireTime)
+	assert.False(t, nm.SplitRelays)
+	assert.Zero(t, nm.Idx)
+
+	// the fields identifying the node must have the expected type
+	err := json.Unmarshal([]byte(`{"node_id":"35299c61-55ad-4565-85a3-0cd985953fac","blockchain_network_num":"5"}`), &nm)
+	assert.ErrorContains(t, err, "blockchain_network_num")
+
+	var syntaxErr *json.SyntaxError
+	assert.ErrorAs(t, json.Unmarshal([]byte(`{"node_id":`), &nm), &syntaxErr)
+}
+
+func TestNodeModel_CheckExternalPortConflicts(t *testing.T) {
+	nodeModel := NodeModel{NodeType: "EXTERNAL_GATEWAY", NodeID: "gateway-1", ExternalIP: "10.0.0.1", ExternalPort: 1801}
+	localNodeModels := []NodeModel{
+		{NodeID: "gateway-1", ExternalIP: "10.0.0.1", ExternalPort: 1801},
+		{NodeID: "gateway-2", ExternalIP: "10.0.0.1", ExternalPort: 1802},
+		{NodeID: "gateway-3", ExternalIP: "10.0.0.2", ExternalPort: 1801},
+	}
+	// an earlier registration of the node and other external addresses do not conflict
+	require.NoError(t, nodeModel.CheckExternalPortConflicts(localNodeModels))
+
+	localNodeModels = append(localNodeModels, NodeModel{NodeType: "EXTERNAL_GATEWAY", NodeID: "gateway-4", ExternalIP: "::ffff:10.0.0.1", ExternalPort: 1801})
+	err := nodeModel.CheckExternalPortConflicts(localNodeModels)
+	require.ErrorIs(t, err, ErrExternalPortConflict)
+	require.ErrorContains(t, err, "10.0.0.1:1801")
+	require.ErrorContains(t, err, "gateway-4")
+
+	// the node without a node ID yet conflicts with its earlier registration
+	nodeModel.NodeID = ""
+	require.ErrorContains(t, nodeModel.CheckExternalPortConflicts(localNodeModels[:1]), "gateway-1")
+
+	// without an external port there is nothing to conflict with
+	nodeModel.ExternalPort = 0
+	require.NoError(t, nodeModel.CheckExternalPortConflicts(localNodeModels))
+}
@@ -6,7 +6,8 @@ import (
 	"github.com/bloXroute-Labs/bxcommon-go/types"
 )
 
-// Peer represents a peer returned by the SDN for a node to connect to
+// Peer represents a peer returned by the SDN for a node to connect to.
+// NodeType is the name of a types.NodeType, kept as a string like NodeModel.NodeType.
 type Peer struct {
 	AssigningShortIds bool         `json:"assigning_short_ids"`
 	Attributes        Attributes   `json:"attributes"`
@@ -0,0 +1,195 @@
+package sdnsdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/bloXroute-Labs/bxcommon-go/logger"
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+)
+
+const (
+	// defaultNodeEventFlushInterval is how often the node events queued by SendNodeEvents are posted by default
+	defaultNodeEventFlushInterval = time.Second
+	// nodeEventFlushTimeout bounds how long the queued node events are posted by each flush, including the one of Close
+	nodeEventFlushTimeout = 10 * time.Second
+)
+
+// nodeEventQueue buffers the node events queued by SendNodeEvents until they are flushed
+type nodeEventQueue struct {
+	mu     sync.Mutex
+	events map[types.NodeID][]message.NodeEvent
+	// order is the order in which the node IDs were first queued, so the batches are posted in that order
+	order []types.NodeID
+	// loopStarted is set once the loop posting the queued events was started by the first SendNodeEvents call
+	loopStarted bool
+	// loop is done when the loop posting the queued events exited
+	loop sync.WaitGroup
+	// closed is set by Close, the events sent afterward are dropped
+	closed bool
+	// batchUnsupported is set once the SDN rejected the batch endpoint, so the events are posted one by one
+	batchUnsupported bool
+}
+
+// push queues events of the node id unless the queue is closed. It returns whether the events were queued
+// and whether the flush loop must be started.
+func (q *nodeEventQueue) push(events []message.NodeEvent, id types.NodeID) (queued bool, startLoop bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false, false
+	}
+	if !q.loopStarted {
+		q.loopStarted = true
+		q.loop.Add(1)
+		startLoop = true
+	}
+	if q.events == nil {
+		q.events = make(map[types.NodeID][]message.NodeEvent)
+	}
+	if _, ok := q.events[id]; !ok {
+		q.order = append(q.order, id)
+	}
+	q.events[id] = append(q.events[id], events...)
+	return true, startLoop
+}
+
+// close stops queuing events, the flush loop is not started afterward
+func (q *nodeEventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+}
+
+// drain removes and returns the queued events by node ID, in the order the node IDs were queued
+func (q *nodeEventQueue) drain() ([]types.NodeID, map[types.NodeID][]message.NodeEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	order, events := q.order, q.events
+	q.order, q.events = nil, nil
+	return order, events
+}
+
+// SendNodeEvents queues events to be sent to the SDN in a single request with the other events queued
+// within the node event flush interval. It does not block, errors are logged. The queued events are
+// flushed by Close, the events sent after Close are dropped. If the SDN does not support batches
+// the events are sent one by one.
+func (s *realSDNHTTP) SendNodeEvents(events []message.NodeEvent, id types.NodeID) {
+	if len(events) == 0 {
+		return
+	}
+	for _, event := range events {
+		warnUnknownNodeEventType(event)
+	}
+	queued, startLoop := s.nodeEvents.push(events, id)
+	if !queued {
+		log.Warnf("dropping %v node events of %v sent after the SDN client was closed", len(events), id)
+		return
+	}
+	if startLoop {
+		go func() {
+			defer s.nodeEvents.loop.Done()
+			s.flushNodeEventsLoop(s.clientContext())
+		}()
+	}
+}
+
+// flushNodeEventsLoop posts the queued node events every node event flush interval until ctx is done.
+// A flush in flight when ctx is done completes, bounded by nodeEventFlushTimeout, so its events are not lost.
+func (s *realSDNHTTP) flushNodeEventsLoop(ctx context.Context) {
+	interval := s.nodeEventFlushInterval
+	if interval <= 0 {
+		interval = defaultNodeEventFlushInterval
+	}
+	ticker := s.timeSource().Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Alert():
+		}
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), nodeEventFlushTimeout)
+		err := s.flushNodeEvents(flushCtx)
+		cancel()
+		if err != nil {
+			log.Errorf("could not send node events to SDN: %v", err)
+		}
+	}
+}
+
+// flushNodeEvents posts the queued node events, one request per node ID
+func (s *realSDNHTTP) flushNodeEvents(ctx context.Context) error {
+	order, events := s.nodeEvents.drain()
+	var errs []error
+	for _, id := range order {
+		if err := s.postNodeEvents(ctx, events[id], id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postNodeEvents sends events of the node id to the SDN batch endpoint,
+// falling back to one request per event if the SDN does not support it
+func (s *realSDNHTTP) postNodeEvents(ctx context.Context, events []message.NodeEvent, id types.NodeID) error {
+	s.nodeEvents.mu.Lock()
+	batchUnsupported := s.nodeEvents.batchUnsupported
+	s.nodeEvents.mu.Unlock()
+
+	if !batchUnsupported {
+		url := fmt.Sprintf("%v/nodes/%v/events/batch", s.sdnURL, id)
+		eventsBytes, err := json.Marshal(events)
+		if err != nil {
+			return fmt.Errorf("could not serialize %v node events: %v", len(events), err)
+		}
+		resp, err := s.httpContext(ctx, url, http.MethodPost, bytes.NewBuffer(eventsBytes))
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) || !batchEndpointUnsupported(statusErr) {
+			if err != nil {
+				return err
+			}
+			log.Infof("%v node events sent to SDN, resp: %s", len(events), string(resp))
+			return nil
+		}
+		log.Infof("SDN does not support node event batches, sending the node events one by one")
+		s.nodeEvents.mu.Lock()
+		s.nodeEvents.batchUnsupported = true
+		s.nodeEvents.mu.Unlock()
+	}
+
+	var errs []error
+	for _, event := range events {
+		if err := s.postNodeEvent(ctx, event, id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warnUnknownNodeEventType logs a warning if the SDN does not know the type of event, as it may ignore the event
+func warnUnknownNodeEventType(event message.NodeEvent) {
+	if !event.EventType.Valid() {
+		log.Warnf("node event of %v has the unknown type %q, the SDN may ignore it", event.NodeID, event.EventType)
+	}
+}
+
+// batchEndpointUnsupported returns whether statusErr means the SDN does not provide a batch endpoint,
+// e.g. of the node events. A 404 returning SDN error details is about the node or account rather than the endpoint.
+func batchEndpointUnsupported(statusErr *StatusError) bool {
+	switch statusErr.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound:
+		return statusErr.Details == ""
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package sdnsdk
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloXroute-Labs/bxcommon-go/cert"
+	log "github.com/bloXroute-Labs/bxcommon-go/logger"
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSDNHTTP_SendNodeEvents(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]message.NodeEvent
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/nodes/{nodeID}/events/batch", handler: func(w http.ResponseWriter, r *http.Request) {
+			var events []message.NodeEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+			mu.Lock()
+			batches = append(batches, events)
+			mu.Unlock()
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithNodeEventFlushInterval(20*time.Millisecond)).(*realSDNHTTP)
+	defer sdn.Close()
+
+	sdn.SendNodeEvents([]message.NodeEvent{message.NewNodeConnectionEvent("peer1", 5), message.NewNodeDisconnectionEvent("peer2")}, "node")
+	sdn.SendNodeEvents([]message.NodeEvent{message.NewNodeDisabledEvent("peer3", "banned")}, "node")
+	sdn.SendNodeEvents(nil, "node")
+
+	// the events queued within the flush interval are sent in a single request
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches) == 1
+	}, time.Second, 5*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, batches[0], 3)
+	assert.Equal(t, message.NePeerConnEstablished, batches[0][0].EventType)
+	assert.Equal(t, message.NePeerConnClosed, batches[0][1].EventType)
+	assert.Equal(t, message.NePeerConnDisabled, batches[0][2].EventType)
+}
+
+func TestSDNHTTP_SendNodeEvents_BatchUnsupported(t *testing.T) {
+	var received []message.NodeEvent
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/nodes/{nodeID}/events", handler: func(w http.ResponseWriter, r *http.Request) {
+			var event message.NodeEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			received = append(received, event)
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithNodeEventFlushInterval(time.Hour)).(*realSDNHTTP)
+	sdn.SendNodeEvents([]message.NodeEvent{message.NewNodeConnectionEvent("peer1", 5), message.NewNodeDisconnectionEvent("peer2")}, "node")
+
+	// Close sends the queued events, one by one as the SDN does not support batches
+	require.NoError(t, sdn.Close())
+	require.Len(t, received, 2)
+	assert.Equal(t, types.NodeID("peer1"), received[0].NodeID)
+	assert.Equal(t, types.NodeID("peer2"), received[1].NodeID)
+	assert.True(t, sdn.nodeEvents.batchUnsupported)
+}
+
+func TestSDNHTTP_SendNodeEvent_UnknownType(t *testing.T) {
+	var received []message.NodeEvent
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/nodes/{nodeID}/events", handler: func(w http.ResponseWriter, r *http.Request) {
+			var event message.NodeEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			received = append(received, event)
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "").(*realSDNHTTP)
+	defer sdn.Close()
+
+	globalLogger := log.NewGlobal()
+	sdn.SendNodeEvent(message.NewNodeDisconnectionEvent("peer1"), "node")
+	for _, entry := range globalLogger.AllEntries() {
+		assert.NotContains(t, entry.Message, "unknown type")
+	}
+
+	// events of an unknown type are still sent, with a warning
+	globalLogger.Reset()
+	sdn.SendNodeEvent(message.NodeEvent{NodeID: "peer2", EventType: "PEER_CONN_CLOSE"}, "node")
+	require.Len(t, received, 2)
+	var warnings []string
+	for _, entry := range globalLogger.AllEntries() {
+		warnings = append(warnings, entry.Message)
+	}
+	assert.Contains(t, warnings, `node event of peer2 has the unknown type "PEER_CONN_CLOSE", the SDN may ignore it`)
+}
+
+func TestSDNHTTP_SendNodeEvents_NodeNotFound(t *testing.T) {
+	var received []message.NodeEvent
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/nodes/{nodeID}/events/batch", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"details": "node not found"}`))
+		}},
+		{method: "POST", pattern: "/nodes/{nodeID}/events", handler: func(w http.ResponseWriter, r *http.Request) {
+			var event message.NodeEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			received = append(received, event)
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithNodeEventFlushInterval(time.Hour)).(*realSDNHTTP)
+	sdn.SendNodeEvents([]message.NodeEvent{message.NewNodeConnectionEvent("peer1", 5)}, "node")
+
+	// a 404 of the node does not mean the SDN does not support batches
+	require.NoError(t, sdn.Close())
+	assert.Empty(t, received)
+	assert.False(t, sdn.nodeEvents.batchUnsupported)
+}
+
+func TestSDNHTTP_SendNodeEvents_AfterClose(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]message.NodeEvent
+	release := make(chan struct{})
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/nodes/{nodeID}/events/batch", handler: func(w http.ResponseWriter, r *http.Request) {
+			var events []message.NodeEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&events))
+			<-release
+			mu.Lock()
+			batches = append(batches, events)
+			mu.Unlock()
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithNodeEventFlushInterval(10*time.Millisecond)).(*realSDNHTTP)
+	sdn.SendNodeEvents([]message.NodeEvent{message.NewNodeConnectionEvent("peer1", 5)}, "node")
+
+	// the flush of the loop is in flight when Close cancels the client
+	globalLogger := log.NewGlobal()
+	closed := make(chan error)
+	go func() {
+		closed <- sdn.Close()
+	}()
+	require.Eventually(t, func() bool { return sdn.ctx.Err() != nil }, time.Second, time.Millisecond)
+	close(release)
+	require.NoError(t, <-closed)
+
+	mu.Lock()
+	require.Len(t, batches, 1)
+	assert.Len(t, batches[0], 1)
+	mu.Unlock()
+	for _, entry := range globalLogger.AllEntries() {
+		assert.NotContains(t, entry.Message, "could not send node events")
+	}
+
+	// the events sent after Close are dropped
+	globalLogger.Reset()
+	sdn.SendNodeEvents([]message.NodeEvent{message.NewNodeDisconnectionEvent("peer2")}, "node")
+	var warnings []string
+	for _, entry := range globalLogger.AllEntries() {
+		warnings = append(warnings, entry.Message)
+	}
+	assert.Contains(t, warnings, "dropping 1 node events of node sent after the SDN client was closed")
+	order, _ := sdn.nodeEvents.drain()
+	assert.Empty(t, order)
+}
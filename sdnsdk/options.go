@@ -0,0 +1,347 @@
+package sdnsdk
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bloXroute-Labs/bxcommon-go/clock"
+	log "github.com/bloXroute-Labs/bxcommon-go/logger"
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+)
+
+// Option configures optional behavior of the SDN client created by NewSDNHTTP
+type Option func(*realSDNHTTP)
+
+// WithSlowRelayDisconnect enables Disconnect instructions from FindFastestRelays for connected auto relays
+// whose latency (ms) exceeds maxLatency and that have no faster relay to switch to.
+// Static relays are never disconnected. A zero maxLatency disables the behavior (default).
+func WithSlowRelayDisconnect(maxLatency float64) Option {
+	return func(s *realSDNHTTP) {
+		s.slowRelayLatency = maxLatency
+	}
+}
+
+// WithRelaySelector sets the strategy which chooses the auto relays to connect among the potential relays,
+// e.g. a RegionDiversityRelaySelector to spread them across regions. Defaults to LatencyRelaySelector.
+func WithRelaySelector(selector RelaySelector) Option {
+	return func(s *realSDNHTTP) {
+		s.relaySelector = selector
+	}
+}
+
+// WithLatencyThreshold sets how much faster (ms) an available relay must be than a connected auto relay
+// before FindFastestRelays suggests switching to it. Defaults to 10 ms.
+func WithLatencyThreshold(threshold float64) Option {
+	return func(s *realSDNHTTP) {
+		s.latencyThreshold = threshold
+	}
+}
+
+// WithHighLatencyWarning sets the latency (ms) of the fastest selected auto relay above which a warning is logged,
+// e.g. raised for deployments in regions far from the relays. Defaults to 40 ms.
+func WithHighLatencyWarning(threshold float64) Option {
+	return func(s *realSDNHTTP) {
+		s.highLatencyWarning = threshold
+	}
+}
+
+// WithRelayPriorities prefers the relays with a priority, by IP, when choosing and switching auto relays.
+// Each priority level lets a relay win over relays up to margin ms faster, e.g. a relay with priority 1
+// and a 5 ms margin is chosen over a relay without priority which is 3 ms faster.
+// Relays without a priority have priority 0, so by default relays are ranked by latency only.
+func WithRelayPriorities(priorities map[string]int, margin float64) Option {
+	return func(s *realSDNHTTP) {
+		s.relayPriorities = priorities
+		s.relayPriorityMargin = margin
+	}
+}
+
+// WithRelayReevaluationInterval enables a loop, started by DirectRelayConnectionsContext, which re-fetches
+// and re-pings the potential relays every interval and emits Connect/Switch/Disconnect instructions
+// as the fastest relays change. The loop stops when the context is done. Zero disables the loop (default).
+// With WithRelayEventStream the loop runs alongside the relay event stream, catching latency changes the SDN
+// does not report as events.
+func WithRelayReevaluationInterval(interval time.Duration) Option {
+	return func(s *realSDNHTTP) {
+		s.relayReevaluationInterval = interval
+	}
+}
+
+// WithLatencySink sets a sink which receives the latency sample of every relay pinged,
+// e.g. to export relay latencies to a time-series system. Nil disables the export (default).
+func WithLatencySink(sink LatencySink) Option {
+	return func(s *realSDNHTTP) {
+		s.latencySink = sink
+	}
+}
+
+// WithRelayMonitorInterval sets how long FindNewRelay waits before retrying to connect to a new relay,
+// e.g. lowered for a faster failover or raised to reduce the SDN load. The interval doubles after each failed
+// attempt, up to 10 minutes, which also bounds a longer interval. Defaults to types.RelayMonitorInterval.
+func WithRelayMonitorInterval(interval time.Duration) Option {
+	return func(s *realSDNHTTP) {
+		s.findNewRelayBackoff = interval
+	}
+}
+
+// WithRelayShortfallHandler sets a handler which is called when fewer auto relays than requested could be connected,
+// by DirectRelayConnectionsContext, the auto relay re-evaluation and FindNewRelay. Nil disables the report (default).
+func WithRelayShortfallHandler(handler RelayShortfallHandler) Option {
+	return func(s *realSDNHTTP) {
+		s.relayShortfallHandler = handler
+	}
+}
+
+// WithMaxDecompressedSize limits the size in bytes of a decompressed gzip/deflate SDN response.
+// Larger responses fail with ErrResponseTooLarge. Zero uses the default of 64 MiB.
+func WithMaxDecompressedSize(maxSize int64) Option {
+	return func(s *realSDNHTTP) {
+		s.maxDecompressedSize = maxSize
+	}
+}
+
+// WithMaxResponseSize limits the size in bytes of an SDN response body as received, including error responses.
+// Larger responses fail with ErrResponseTooLarge. Zero uses the default of 8 MiB.
+func WithMaxResponseSize(maxSize int64) Option {
+	return func(s *realSDNHTTP) {
+		s.maxResponseSize = maxSize
+	}
+}
+
+// WithIPResolutionPolicy sets which address is used for relays whose host name resolves to multiple addresses.
+// Defaults to IPResolutionFirst.
+func WithIPResolutionPolicy(policy IPResolutionPolicy) Option {
+	return func(s *realSDNHTTP) {
+		s.ipResolutionPolicy = policy
+	}
+}
+
+// WithCacheFS stores the cache files in fsys instead of the OS filesystem,
+// e.g. a ReadOnlyCacheFS serving a baseline cache or an in-memory filesystem in tests
+func WithCacheFS(fsys CacheFS) Option {
+	return func(s *realSDNHTTP) {
+		s.cacheFS = fsys
+	}
+}
+
+// WithCachePolicy sets whether the responses of each endpoint in policy are cached and served from the cache files
+// when the SDN is unavailable, e.g. disabling CacheEndpointPotentialRelays so decommissioned relays are not connected
+// after an SDN outage. The endpoints missing from policy keep their default, all except CacheEndpointAccounts are cached.
+func WithCachePolicy(policy map[CacheEndpoint]bool) Option {
+	return func(s *realSDNHTTP) {
+		s.cachePolicy = policy
+	}
+}
+
+// WithRelayHostnameExpansion expands relay host names which resolve to multiple addresses to all their addresses,
+// each counting as one relay towards the relay limit, instead of connecting to a single address (default).
+// This spreads the relays across the backends of a load-balanced relay DNS name.
+func WithRelayHostnameExpansion() Option {
+	return func(s *realSDNHTTP) {
+		s.expandRelayHostnames = true
+	}
+}
+
+// WithDefaultRelayPorts sets the port of the --relays entries without a port by the protocol and network of the node,
+// e.g. {Protocol: "ethereum", Network: "mainnet"}. A key with an empty Network applies to all the networks of its protocol.
+// Protocols and networks are matched case-insensitively. Nodes without a configured port default to 1809.
+func WithDefaultRelayPorts(ports map[RelayPortKey]int64) Option {
+	return func(s *realSDNHTTP) {
+		s.defaultRelayPorts = make(map[RelayPortKey]int64, len(ports))
+		for key, port := range ports {
+			key = RelayPortKey{Protocol: strings.ToLower(key.Protocol), Network: strings.ToLower(key.Network)}
+			s.defaultRelayPorts[key] = port
+		}
+	}
+}
+
+// WithDataDirMode sets the permission mode used to create the data directory of the cache files
+// when it does not exist. Defaults to DefaultDataDirMode.
+func WithDataDirMode(mode os.FileMode) Option {
+	return func(s *realSDNHTTP) {
+		s.dataDirMode = mode
+	}
+}
+
+// WithRequestObserver sets an observer which is called after every SDN request with its outcome,
+// including failed requests and requests served from the cache files because the SDN was unavailable.
+// Nil disables the observation (default).
+func WithRequestObserver(observer RequestObserver) Option {
+	return func(s *realSDNHTTP) {
+		s.requestObserver = observer
+	}
+}
+
+// WithRootCAsPEM verifies the SDN server certificate against the system root certificates
+// and the PEM encoded rootCAs, e.g. the private CA of a proxy fronting the SDN.
+// The client certificates are still loaded from the SSL certs. By default the server certificate is not verified.
+func WithRootCAsPEM(rootCAs []byte) Option {
+	return func(s *realSDNHTTP) {
+		s.rootCAsPEM = rootCAs
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of the SDN server certificate, which is otherwise verified when
+// the SSL certs passed to NewSDNHTTP are nil, so no client certificate is presented, or when WithRootCAsPEM is set.
+// This lets tests and developers use a local SDN with a self-signed certificate without SSL certs.
+// It is disabled by default and logs a warning when enabled.
+func WithInsecureSkipVerify(skip bool) Option {
+	return func(s *realSDNHTTP) {
+		if skip {
+			log.Warn("SDN server certificate verification is disabled, SDN requests are vulnerable to interception")
+		}
+		s.insecureSkipVerify = skip
+	}
+}
+
+// WithNodeModelChangeHandler sets a handler which is called by Register when the SDN response changes
+// the registered node model, e.g. by assigning the node ID or adjusting the blockchain network number
+func WithNodeModelChangeHandler(handler NodeModelChangeHandler) Option {
+	return func(s *realSDNHTTP) {
+		s.nodeModelChangeHandler = handler
+	}
+}
+
+// WithLocalNodeModels sets a function returning the node models of the other nodes registered on the host,
+// e.g. read from their data directories. Register fails with message.ErrExternalPortConflict before contacting
+// the SDN if one of them has the same external IP and port as the node model.
+func WithLocalNodeModels(localNodeModels func() []message.NodeModel) Option {
+	return func(s *realSDNHTTP) {
+		s.localNodeModels = localNodeModels
+	}
+}
+
+// WithNetworksChangeHandler sets a handler which is called by FetchAllBlockchainNetworks with the blockchain
+// networks added, removed or changed since the previous fetch, e.g. to react to a MinTxAgeSeconds change
+func WithNetworksChangeHandler(handler NetworksChangeHandler) Option {
+	return func(s *realSDNHTTP) {
+		s.networksChangeHandler = handler
+	}
+}
+
+// WithUserAgentPrefix sets the product name in the User-Agent of SDN requests, which is followed by the
+// source version and node type of the node model, e.g. "gateway/2.1.0 (EXTERNAL_GATEWAY)".
+// Defaults to DefaultUserAgentPrefix.
+func WithUserAgentPrefix(prefix string) Option {
+	return func(s *realSDNHTTP) {
+		s.userAgentPrefix = prefix
+	}
+}
+
+// WithTransportWrapper wraps the transport used for SDN requests,
+// e.g. with a Recorder to capture the SDN interactions or a ReplayTransport to serve them back
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(s *realSDNHTTP) {
+		s.transportWrapper = wrap
+	}
+}
+
+// WithRecording saves every SDN request/response pair to fileName for later replay with NewReplayTransport
+func WithRecording(fileName string) Option {
+	return WithTransportWrapper(NewRecorder(fileName).Wrap)
+}
+
+// WithRelayEventStream subscribes DirectRelayConnectionsContext to the SDN relay event stream,
+// re-evaluating the auto relays as soon as the SDN adds or removes relays. The stream is reconnected
+// with backoff when dropped, and if the SDN does not support it the potential relays are polled instead,
+// every types.RelayMonitorInterval. With WithRelayReevaluationInterval the periodic re-evaluation also runs
+// alongside the stream, and replaces the polling if the SDN does not support the stream.
+func WithRelayEventStream() Option {
+	return func(s *realSDNHTTP) {
+		s.relayEventStream = true
+	}
+}
+
+// WithFallbackSDNURLs sets standby SDN URLs which are tried in order after the SDN URL passed to NewSDNHTTP
+// when an SDN does not respond or fails with a 5xx. The SDN URL which served the last successful request
+// is tried first by subsequent requests.
+func WithFallbackSDNURLs(sdnURLs ...string) Option {
+	return func(s *realSDNHTTP) {
+		s.fallbackSDNURLs = sdnURLs
+	}
+}
+
+// WithPingRelaysTimeout bounds how long the potential relays are pinged when choosing auto relays.
+// Relays which did not respond in time are treated as unreachable with the PingTimeout latency. Defaults to 5 seconds,
+// plus one second per packet above one set by WithPingCount.
+func WithPingRelaysTimeout(timeout time.Duration) Option {
+	return func(s *realSDNHTTP) {
+		s.pingRelaysTimeout = timeout
+	}
+}
+
+// WithPingCount pings each potential relay with count packets instead of one (default), using their average
+// latency and packet loss. The packets are sent one second apart, so the default ping relays timeout is extended
+// by one second per extra packet; a timeout set by WithPingRelaysTimeout is used as is. Counts below 1 are treated as 1.
+func WithPingCount(count int) Option {
+	return func(s *realSDNHTTP) {
+		count = max(count, 1)
+		s.pingCount = count
+		s.getPingLatencies = func(ctx context.Context, peers message.Peers) []nodeLatencyInfo {
+			return getPingLatenciesWithCount(ctx, peers, count)
+		}
+	}
+}
+
+// WithMaxPacketLoss sets the packet loss (%) above which a relay is deprioritized however low its latency:
+// it is connected as an auto relay only after all the relays with less loss and is never switched to.
+// Zero deprioritizes any packet loss. Defaults to 20%.
+func WithMaxPacketLoss(percent float64) Option {
+	return func(s *realSDNHTTP) {
+		s.maxPacketLoss = &percent
+	}
+}
+
+// WithCertExpiryWarning sets how long before the certificate expires Register logs a warning about it. Defaults to 30 days.
+func WithCertExpiryWarning(window time.Duration) Option {
+	return func(s *realSDNHTTP) {
+		s.certExpiryWarning = window
+	}
+}
+
+// WithSDNOrderFallback connects the auto relays in the order of the SDN relay list, which is treated as authoritative,
+// when no relay answered the ping, e.g. in containers without ICMP. By default the relays are then chosen
+// among the unreachable relays by IP, or none are connected if the unreachable relays are excluded.
+// FindFastestRelays and the auto relay re-evaluation then only connect the missing auto relays in that order.
+func WithSDNOrderFallback() Option {
+	return func(s *realSDNHTTP) {
+		s.sdnOrderFallback = true
+	}
+}
+
+// WithUnreachableRelaysExcluded drops the relays which did not answer the ping, i.e. have the PingTimeout latency,
+// from the ping results, so they are never suggested as auto relays. The latency sink still receives them.
+// By default unreachable relays are kept, sorted after the reachable ones, for diagnostic visibility.
+func WithUnreachableRelaysExcluded() Option {
+	return func(s *realSDNHTTP) {
+		s.excludeUnreachableRelays = true
+	}
+}
+
+// WithRelayPortCheck dials the relay port of every auto relay before sending its Connect instruction,
+// skipping relays which do not accept a TCP connection within timeout, e.g. because the port is firewalled
+// while the relay answers the ping. Zero disables the check (default).
+func WithRelayPortCheck(timeout time.Duration) Option {
+	return func(s *realSDNHTTP) {
+		s.relayPortCheckTimeout = timeout
+	}
+}
+
+// WithNodeEventFlushInterval sets how often the node events queued by SendNodeEvents are sent to the SDN,
+// all the events queued within an interval being sent in a single request. Defaults to 1 second.
+func WithNodeEventFlushInterval(interval time.Duration) Option {
+	return func(s *realSDNHTTP) {
+		s.nodeEventFlushInterval = interval
+	}
+}
+
+// WithClock sets the clock driving the auto relay re-evaluation, the FindNewRelay and relay event stream retries
+// and the time stamps of relay states and account defaults, e.g. a clock.MockClock in tests. Defaults to clock.RealClock.
+func WithClock(c clock.Clock) Option {
+	return func(s *realSDNHTTP) {
+		s.clock = c
+	}
+}
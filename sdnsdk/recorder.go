@@ -0,0 +1,223 @@
+package sdnsdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+)
+
+// Recording is a single SDN request/response pair captured by a Recorder
+type Recording struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	RequestBody  []byte      `json:"request_body,omitempty"`
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	ResponseBody []byte      `json:"response_body,omitempty"`
+}
+
+// Recorder saves SDN request/response pairs to a file that can be served back by ReplayTransport.
+// The file holds one JSON recording per line, readable only by its owner. The secret hash, certificates
+// and CSRs in the uncompressed request and response bodies are replaced with message.Redacted.
+// Event streams are passed through as they are read and recorded when they are closed,
+// with up to maxRecordedStreamSize bytes of their body.
+type Recorder struct {
+	fileName string
+	mu       sync.Mutex
+	// started is set once the file was truncated by the first recording
+	started bool
+}
+
+// NewRecorder creates a Recorder writing the recordings to fileName, replacing the file on the first recording
+func NewRecorder(fileName string) *Recorder {
+	return &Recorder{fileName: fileName}
+}
+
+// Wrap returns an http.RoundTripper which passes requests to next and records them
+func (r *Recorder) Wrap(next http.RoundTripper) http.RoundTripper {
+	return &recordingTransport{next: next, recorder: r}
+}
+
+// record appends recording to the file with its secrets redacted
+func (r *Recorder) record(recording Recording) error {
+	recording.RequestBody = message.RedactAccountJSON(recording.RequestBody)
+	recording.ResponseBody = message.RedactAccountJSON(recording.ResponseBody)
+	b, err := json.Marshal(recording)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !r.started {
+		flags |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(r.fileName, flags, 0600)
+	if err != nil {
+		return err
+	}
+	r.started = true
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type recordingTransport struct {
+	next     http.RoundTripper
+	recorder *Recorder
+}
+
+// RoundTrip executes the request using the next transport and records it
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recording := Recording{Method: req.Method, URL: req.URL.String()}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		recording.RequestBody = body
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	recording.StatusCode = resp.StatusCode
+	recording.Header = resp.Header.Clone()
+	if isEventStream(req, resp) {
+		// reading the whole stream would block until the SDN closes it
+		resp.Body = &recordingStream{ReadCloser: resp.Body, recording: recording, recorder: t.recorder}
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	recording.ResponseBody = body
+	if err = t.recorder.record(recording); err != nil {
+		return nil, fmt.Errorf("could not save SDN recording to %v: %v", t.recorder.fileName, err)
+	}
+	return resp, nil
+}
+
+// maxRecordedStreamSize is how many bytes of an event stream are recorded, the rest is passed through only
+const maxRecordedStreamSize = 1 << 20
+
+// isEventStream returns whether resp is a server-sent event stream, which is read as the events arrive
+func isEventStream(req *http.Request, resp *http.Response) bool {
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") ||
+		resp.StatusCode == http.StatusOK && req.Header.Get("Accept") == "text/event-stream"
+}
+
+// recordingStream passes a response body through unbuffered, keeping what was read to record it on Close
+type recordingStream struct {
+	io.ReadCloser
+	body      bytes.Buffer
+	recording Recording
+	recorder  *Recorder
+	closeOnce sync.Once
+}
+
+// Read reads from the response body, keeping up to maxRecordedStreamSize bytes read for the recording
+func (s *recordingStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	if room := maxRecordedStreamSize - s.body.Len(); room > 0 {
+		s.body.Write(p[:min(n, room)])
+	}
+	return n, err
+}
+
+// Close closes the response body and records the stream read so far
+func (s *recordingStream) Close() error {
+	err := s.ReadCloser.Close()
+	s.closeOnce.Do(func() {
+		s.recording.ResponseBody = s.body.Bytes()
+		if recordErr := s.recorder.record(s.recording); recordErr != nil && err == nil {
+			err = fmt.Errorf("could not save SDN recording to %v: %v", s.recorder.fileName, recordErr)
+		}
+	})
+	return err
+}
+
+// ReplayTransport is an http.RoundTripper serving the responses saved by a Recorder
+// without performing any network calls. Requests are matched by method and URL; repeated requests
+// are served in recorded order, and the last matching recording is served once they are exhausted.
+type ReplayTransport struct {
+	mu         sync.Mutex
+	recordings map[string][]Recording
+}
+
+// NewReplayTransport creates a ReplayTransport from the recordings saved in fileName
+func NewReplayTransport(fileName string) (*ReplayTransport, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &ReplayTransport{recordings: make(map[string][]Recording)}
+	decoder := json.NewDecoder(f)
+	for {
+		var recording Recording
+		if err = decoder.Decode(&recording); errors.Is(err, io.EOF) {
+			return t, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("could not deserialize SDN recordings from %v: %v", fileName, err)
+		}
+		key := replayKey(recording.Method, recording.URL)
+		t.recordings[key] = append(t.recordings[key], recording)
+	}
+}
+
+// RoundTrip serves the next recorded response matching the request
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	key := replayKey(req.Method, req.URL.String())
+	t.mu.Lock()
+	recordings := t.recordings[key]
+	if len(recordings) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("no SDN recording found for %v", key)
+	}
+	recording := recordings[0]
+	if len(recordings) > 1 {
+		t.recordings[key] = recordings[1:]
+	}
+	t.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recording.StatusCode, http.StatusText(recording.StatusCode)),
+		StatusCode:    recording.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recording.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(recording.ResponseBody)),
+		ContentLength: int64(len(recording.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+func replayKey(method, url string) string {
+	return method + " " + url
+}
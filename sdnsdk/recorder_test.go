@@ -0,0 +1,95 @@
+package sdnsdk
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplayRegistration(t *testing.T) {
+	nodeModel := message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet"}
+	dataDir := t.TempDir()
+	recordingFile := path.Join(dataDir, "sdn-recording.json")
+
+	handler := mockNodesServer(t, nodeModel.NodeID, nodeModel.ExternalPort, nodeModel.ExternalIP, nodeModel.Protocol, nodeModel.Network, 5, "")
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: handler}})
+	serverURL := server.URL
+
+	testCerts := SetupTestCerts()
+	recording := realSDNHTTP{
+		sdnURL:           serverURL,
+		sslCerts:         &testCerts,
+		nodeModel:        &message.NodeModel{Protocol: nodeModel.Protocol, Network: nodeModel.Network},
+		dataDir:          dataDir,
+		transportWrapper: NewRecorder(recordingFile).Wrap,
+	}
+	require.NoError(t, recording.Register())
+	server.Close()
+
+	replayTransport, err := NewReplayTransport(recordingFile)
+	require.NoError(t, err)
+	replay := realSDNHTTP{
+		sdnURL:    serverURL,
+		sslCerts:  &testCerts,
+		nodeModel: &message.NodeModel{Protocol: nodeModel.Protocol, Network: nodeModel.Network},
+		dataDir:   dataDir,
+	}
+	WithTransportWrapper(func(http.RoundTripper) http.RoundTripper { return replayTransport })(&replay)
+
+	// the server is closed, so the registration can only succeed from the recording
+	require.NoError(t, replay.Register())
+	assert.Equal(t, recording.nodeModel.NodeID, replay.nodeModel.NodeID)
+	assert.Equal(t, nodeModel.Network, replay.nodeModel.Network)
+	assert.Equal(t, types.NetworkNum(5), replay.nodeModel.BlockchainNetworkNum)
+
+	_, err = replay.http(serverURL+"/nodes/unknown", http.MethodGet, nil)
+	assert.Error(t, err)
+}
+
+func TestRecorder_RedactsSecrets(t *testing.T) {
+	recordingFile := path.Join(t.TempDir(), "sdn-recording.json")
+	require.NoError(t, os.WriteFile(recordingFile, []byte("stale recordings\n"), 0600))
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"node_id":"node","cert":"private cert","secret_hash":"hash"}`))
+	}}})
+	defer server.Close()
+
+	client := &http.Client{Transport: NewRecorder(recordingFile).Wrap(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(server.URL+"/nodes", "application/json", strings.NewReader(`{"csr":"request","cert":""}`))
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		// the response passed on is not redacted
+		assert.Contains(t, string(body), "private cert")
+	}
+
+	info, err := os.Stat(recordingFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	b, err := os.ReadFile(recordingFile)
+	require.NoError(t, err)
+	// the recordings are appended one per line, replacing the stale file
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var recording Recording
+		require.NoError(t, json.Unmarshal([]byte(line), &recording))
+		assert.JSONEq(t, `{"csr":"[REDACTED]","cert":""}`, string(recording.RequestBody))
+		assert.JSONEq(t, `{"node_id":"node","cert":"[REDACTED]","secret_hash":"[REDACTED]"}`, string(recording.ResponseBody))
+	}
+
+	replayTransport, err := NewReplayTransport(recordingFile)
+	require.NoError(t, err)
+	assert.Len(t, replayTransport.recordings[replayKey(http.MethodPost, server.URL+"/nodes")], 2)
+}
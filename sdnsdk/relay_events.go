@@ -0,0 +1,158 @@
+package sdnsdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/bloXroute-Labs/bxcommon-go/logger"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+)
+
+// Relay event types pushed by the SDN relay event stream
+const (
+	RelayEventAdd    = "add"
+	RelayEventRemove = "remove"
+)
+
+const (
+	relayEventStreamMinBackoff = time.Second
+	relayEventStreamMaxBackoff = time.Minute
+)
+
+var errRelayEventsUnsupported = errors.New("SDN does not support the relay event stream")
+
+// RelayEvent is a potential relay change pushed by the SDN
+type RelayEvent struct {
+	Type string `json:"type"`
+	IP   string `json:"ip"`
+	Port int64  `json:"port"`
+}
+
+// streamRelayEvents subscribes to the SDN relay event stream and re-evaluates the auto relays on every event.
+// The subscription is reconnected with backoff when dropped. If the SDN does not support the stream,
+// the auto relays are re-evaluated by polling instead.
+func (s *realSDNHTTP) streamRelayEvents(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) {
+	minBackoff := s.relayEventStreamBackoff
+	if minBackoff <= 0 {
+		minBackoff = relayEventStreamMinBackoff
+	}
+	backoff := minBackoff
+
+	for {
+		connected, err := s.readRelayEvents(ctx, func(event RelayEvent) {
+			s.handleRelayEvent(ctx, event, autoRelayCount, relayInstructions, ignoredRelays)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, errRelayEventsUnsupported) {
+			if s.relayReevaluationInterval > 0 {
+				// the re-evaluation loop already polls the potential relays
+				log.Infof("%v, relying on the auto relay re-evaluation every %v", err, s.relayReevaluationInterval)
+				return
+			}
+			log.Infof("%v, polling potential relays every %v instead", err, types.RelayMonitorInterval)
+			s.reevaluateAutoRelays(ctx, types.RelayMonitorInterval, autoRelayCount, relayInstructions, ignoredRelays)
+			return
+		}
+		if connected {
+			backoff = minBackoff
+		}
+
+		log.Warnf("relay event stream dropped: %v, reconnecting in %v", err, backoff)
+		timer := s.timeSource().Timer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.Alert():
+		}
+		backoff *= 2
+		if backoff > relayEventStreamMaxBackoff {
+			backoff = relayEventStreamMaxBackoff
+		}
+	}
+}
+
+// readRelayEvents reads server-sent relay events until the stream is closed, reporting whether it connected
+func (s *realSDNHTTP) readRelayEvents(ctx context.Context, onEvent func(event RelayEvent)) (bool, error) {
+	url := fmt.Sprintf("%v/nodes/%v/%d/relay-events", s.currentSDNURL(), s.NodeModel().NodeID, s.NetworkNum())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	s.setRequestHeaders(req)
+
+	client, err := s.httpClient()
+	if err != nil {
+		return false, err
+	}
+	// the stream is long-lived, it is bounded by ctx instead
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer s.close(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return false, errRelayEventsUnsupported
+	default:
+		return false, fmt.Errorf("GET to %v received a [%v]", url, resp.Status)
+	}
+
+	var data []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) == 0 {
+				continue
+			}
+			var event RelayEvent
+			if err = json.Unmarshal([]byte(strings.Join(data, "\n")), &event); err != nil {
+				log.Errorf("could not deserialize relay event '%s': %v", strings.Join(data, "\n"), err)
+			} else {
+				onEvent(event)
+			}
+			data = data[:0]
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return true, err
+	}
+	return true, errors.New("relay event stream closed by the SDN")
+}
+
+// handleRelayEvent disconnects a removed auto relay and re-evaluates the auto relays
+func (s *realSDNHTTP) handleRelayEvent(ctx context.Context, event RelayEvent, autoRelayCount int, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) {
+	tracker := s.relayTracker(ignoredRelays)
+	switch event.Type {
+	case RelayEventRemove:
+		if relayInfo, ok := tracker.Load(event.IP); ok && relayInfo.IsConnected && !relayInfo.IsStatic {
+			log.WithFields(relayLogFields(event.IP, relayInfo.Port, Disconnect)).
+				Infof("auto relay %v:%v was removed by the SDN, disconnecting", event.IP, relayInfo.Port)
+			tracker.MarkDisconnected(event.IP, relayInfo.Port)
+			if !sendRelayInstruction(ctx, relayInstructions, RelayInstruction{IP: event.IP, Port: relayInfo.Port, Type: Disconnect}) {
+				return
+			}
+		}
+	case RelayEventAdd:
+	default:
+		log.Warnf("ignoring unknown relay event type %v for relay %v:%v", event.Type, event.IP, event.Port)
+		return
+	}
+	s.reevaluateAutoRelaysOnce(ctx, autoRelayCount, relayInstructions, ignoredRelays)
+}
@@ -0,0 +1,202 @@
+package sdnsdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bloXroute-Labs/bxcommon-go/cert"
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/syncmap"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var relayEventsNodeModel = message.NodeModel{
+	NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
+	ExternalIP: "11.113.164.111",
+	Protocol:   "Ethereum",
+	Network:    "Mainnet",
+}
+
+func mockChangingRelaysServer(relays *atomic.Value) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(relays.Load().(string)))
+	}
+}
+
+func pingAllRelays(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+	latencies := make([]nodeLatencyInfo, 0, len(peers))
+	for _, peer := range peers {
+		latencies = append(latencies, nodeLatencyInfo{IP: peer.IP, Port: peer.Port, Latency: 5})
+	}
+	return latencies
+}
+
+func receiveInstruction(t *testing.T, relayInstructions <-chan RelayInstruction) RelayInstruction {
+	select {
+	case instruction := <-relayInstructions:
+		return instruction
+	case <-time.After(time.Second):
+		require.Fail(t, "expected relay instruction")
+	}
+	return RelayInstruction{}
+}
+
+func TestStreamRelayEvents_RemoveAndReconnect(t *testing.T) {
+	defer cleanupFiles()
+	var relays atomic.Value
+	relays.Store(`[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`)
+
+	var connections atomic.Int32
+	streamHandler := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		if connections.Add(1) > 1 {
+			<-r.Context().Done()
+			return
+		}
+		relays.Store(`[{"ip":"2.2.2.2", "port":1809}]`)
+		event, _ := json.Marshal(RelayEvent{Type: RelayEventRemove, IP: "1.1.1.1", Port: 1809})
+		_, _ = fmt.Fprintf(w, ": keep-alive\n\ndata: %s\n\n", event)
+		// the stream is closed after the event, so the client has to reconnect
+	}
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: mockChangingRelaysServer(&relays)},
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/relay-events", handler: streamHandler},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "", WithRelayEventStream()).(*realSDNHTTP)
+	sdn.relayEventStreamBackoff = 10 * time.Millisecond
+	sdn.getPingLatencies = pingAllRelays
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relayInstructions := make(chan RelayInstruction, 10)
+	require.NoError(t, sdn.DirectRelayConnectionsContext(ctx, "auto", 1, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]()))
+
+	assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+	assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Disconnect}, receiveInstruction(t, relayInstructions))
+	assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+
+	assert.Eventually(t, func() bool { return connections.Load() >= 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamRelayEvents_FallbackToPolling(t *testing.T) {
+	defer cleanupFiles()
+	var relays atomic.Value
+	relays.Store(`[{"ip":"1.1.1.1", "port":1809}]`)
+
+	// the relay-events endpoint is not served, so the SDN responds with 404
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: mockChangingRelaysServer(&relays)},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "",
+		WithRelayEventStream(), WithRelayReevaluationInterval(10*time.Millisecond)).(*realSDNHTTP)
+	sdn.getPingLatencies = pingAllRelays
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relayInstructions := make(chan RelayInstruction, 10)
+	require.NoError(t, sdn.DirectRelayConnectionsContext(ctx, "auto, auto", 2, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]()))
+
+	assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+	relays.Store(`[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`)
+	assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+}
+
+func TestStreamRelayEvents_WithReevaluationInterval(t *testing.T) {
+	defer cleanupFiles()
+	var relays atomic.Value
+	relays.Store(`[{"ip":"1.1.1.1", "port":1809}]`)
+
+	// the stream is supported but sends no event
+	streamHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: mockChangingRelaysServer(&relays)},
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/relay-events", handler: streamHandler},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "",
+		WithRelayEventStream(), WithRelayReevaluationInterval(10*time.Millisecond)).(*realSDNHTTP)
+	sdn.getPingLatencies = pingAllRelays
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relayInstructions := make(chan RelayInstruction, 10)
+	require.NoError(t, sdn.DirectRelayConnectionsContext(ctx, "auto, auto", 2, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]()))
+
+	// the new relay is found by the periodic re-evaluation while the stream is connected
+	assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+	relays.Store(`[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`)
+	assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+}
+
+func TestStreamRelayEvents_Recording(t *testing.T) {
+	defer cleanupFiles()
+	var relays atomic.Value
+	relays.Store(`[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`)
+
+	streamHandler := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		relays.Store(`[{"ip":"2.2.2.2", "port":1809}]`)
+		event, _ := json.Marshal(RelayEvent{Type: RelayEventRemove, IP: "1.1.1.1", Port: 1809})
+		_, _ = fmt.Fprintf(w, "data: %s\n\n", event)
+		w.(http.Flusher).Flush()
+		// the stream stays open, so the event must be handled before the stream ends
+		<-r.Context().Done()
+	}
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: mockChangingRelaysServer(&relays)},
+		{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/relay-events", handler: streamHandler},
+	})
+	defer server.Close()
+
+	recordingFile := path.Join(t.TempDir(), "sdn-recording.json")
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "", WithRelayEventStream(), WithRecording(recordingFile)).(*realSDNHTTP)
+	sdn.getPingLatencies = pingAllRelays
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relayInstructions := make(chan RelayInstruction, 10)
+	require.NoError(t, sdn.DirectRelayConnectionsContext(ctx, "auto", 1, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]()))
+
+	assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+	assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Disconnect}, receiveInstruction(t, relayInstructions))
+	assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, receiveInstruction(t, relayInstructions))
+
+	// the stream is recorded with its events once it is closed
+	cancel()
+	assert.Eventually(t, func() bool {
+		data, err := os.ReadFile(recordingFile)
+		if err != nil {
+			return false
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var recording Recording
+			if json.Unmarshal([]byte(line), &recording) == nil && strings.Contains(recording.URL, "relay-events") {
+				return strings.Contains(string(recording.ResponseBody), `"ip":"1.1.1.1"`)
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,59 @@
+package sdnsdk
+
+// RelayCandidate is a potential auto relay with its ping latency (ms), packet loss (%) and location
+type RelayCandidate struct {
+	IP         string
+	Port       int64
+	Latency    float64
+	PacketLoss float64
+	Continent  string
+	Country    string
+	Region     string
+}
+
+// RelaySelector orders the potential auto relays by preference. The candidates are sorted by ascending latency,
+// and count auto relays are needed. Relays are connected in the returned order, skipping the ones which are
+// already connected, can not be resolved or fail the relay port check, until count relays are connected.
+type RelaySelector interface {
+	SelectRelays(candidates []RelayCandidate, count int) []RelayCandidate
+}
+
+// LatencyRelaySelector prefers the relays with the lowest latency. It is the default RelaySelector.
+type LatencyRelaySelector struct{}
+
+// SelectRelays keeps the candidates in ascending latency order
+func (LatencyRelaySelector) SelectRelays(candidates []RelayCandidate, _ int) []RelayCandidate {
+	return candidates
+}
+
+// RegionDiversityRelaySelector spreads the auto relays across distinct regions, so a datacenter outage
+// does not disconnect all of them. Among the relays whose latency is within LatencyBudget ms of the fastest
+// relay, the fastest relay of each region is preferred, then the remaining relays follow in latency order.
+// Relays without a region are treated as being in a region of their own.
+type RegionDiversityRelaySelector struct {
+	LatencyBudget float64
+}
+
+// SelectRelays orders the candidates so the first ones are in distinct regions within the latency budget
+func (s RegionDiversityRelaySelector) SelectRelays(candidates []RelayCandidate, count int) []RelayCandidate {
+	if len(candidates) == 0 {
+		return candidates
+	}
+
+	maxLatency := candidates[0].Latency + s.LatencyBudget
+	selected := make([]RelayCandidate, 0, len(candidates))
+	rest := make([]RelayCandidate, 0, len(candidates))
+	regions := make(map[string]struct{})
+	for _, candidate := range candidates {
+		_, seenRegion := regions[candidate.Region]
+		if len(selected) < count && candidate.Latency <= maxLatency && (candidate.Region == "" || !seenRegion) {
+			if candidate.Region != "" {
+				regions[candidate.Region] = struct{}{}
+			}
+			selected = append(selected, candidate)
+			continue
+		}
+		rest = append(rest, candidate)
+	}
+	return append(selected, rest...)
+}
@@ -0,0 +1,86 @@
+package sdnsdk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
+	"github.com/bloXroute-Labs/bxcommon-go/syncmap"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func relayCandidateIPs(candidates []RelayCandidate) []string {
+	ips := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		ips = append(ips, candidate.IP)
+	}
+	return ips
+}
+
+func TestLatencyRelaySelector(t *testing.T) {
+	candidates := []RelayCandidate{
+		{IP: "1.1.1.1", Latency: 5, Region: "us-east"},
+		{IP: "2.2.2.2", Latency: 6, Region: "us-east"},
+		{IP: "3.3.3.3", Latency: 10, Region: "us-west"},
+	}
+	assert.Equal(t, candidates, LatencyRelaySelector{}.SelectRelays(candidates, 2))
+}
+
+func TestRegionDiversityRelaySelector(t *testing.T) {
+	candidates := []RelayCandidate{
+		{IP: "1.1.1.1", Latency: 5, Region: "us-east"},
+		{IP: "2.2.2.2", Latency: 6, Region: "us-east"},
+		{IP: "3.3.3.3", Latency: 10, Region: "us-west"},
+		{IP: "4.4.4.4", Latency: 12, Region: "us-central"},
+		{IP: "5.5.5.5", Latency: 100, Region: "eu-west"},
+		{IP: "6.6.6.6", Latency: 101},
+	}
+
+	testTable := []struct {
+		name          string
+		latencyBudget float64
+		count         int
+		expectedIPs   []string
+	}{
+		{name: "distinct regions first", latencyBudget: 10, count: 3, expectedIPs: []string{"1.1.1.1", "3.3.3.3", "4.4.4.4", "2.2.2.2", "5.5.5.5", "6.6.6.6"}},
+		{name: "only count relays are spread", latencyBudget: 10, count: 2, expectedIPs: []string{"1.1.1.1", "3.3.3.3", "2.2.2.2", "4.4.4.4", "5.5.5.5", "6.6.6.6"}},
+		{name: "slow regions are not preferred", latencyBudget: 5, count: 3, expectedIPs: []string{"1.1.1.1", "3.3.3.3", "2.2.2.2", "4.4.4.4", "5.5.5.5", "6.6.6.6"}},
+		{name: "zero budget keeps latency order", count: 3, expectedIPs: []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6"}},
+		{name: "relays without region", latencyBudget: 100, count: 6, expectedIPs: []string{"1.1.1.1", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6", "2.2.2.2"}},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			selector := RegionDiversityRelaySelector{LatencyBudget: testCase.latencyBudget}
+			assert.Equal(t, testCase.expectedIPs, relayCandidateIPs(selector.SelectRelays(candidates, testCase.count)))
+		})
+	}
+
+	assert.Empty(t, RegionDiversityRelaySelector{LatencyBudget: 10}.SelectRelays(nil, 2))
+}
+
+func TestSDNHTTP_ConnectAutoRelays_RelaySelector(t *testing.T) {
+	relays := message.Peers{
+		{IP: "1.1.1.1", Port: 1809, Attributes: message.Attributes{Region: "us-east"}},
+		{IP: "2.2.2.2", Port: 1809, Attributes: message.Attributes{Region: "us-east"}},
+		{IP: "3.3.3.3", Port: 1809, Attributes: message.Attributes{Region: "us-west"}},
+	}
+	latencies := map[string]float64{"1.1.1.1": 5, "2.2.2.2": 6, "3.3.3.3": 10}
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}}
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		pingLatencies := make([]nodeLatencyInfo, 0, len(peers))
+		for _, peer := range peers {
+			pingLatencies = append(pingLatencies, nodeLatencyInfo{IP: peer.IP, Port: peer.Port, Latency: latencies[peer.IP], Region: peer.Attributes.Region})
+		}
+		return pingLatencies
+	}
+	WithRelaySelector(RegionDiversityRelaySelector{LatencyBudget: 10})(sdn)
+
+	relayInstructions := make(chan RelayInstruction, 2)
+	sdn.manageAutoRelays(context.Background(), 2, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	require.Len(t, relayInstructions, 2)
+	assert.Equal(t, "1.1.1.1", (<-relayInstructions).IP)
+	assert.Equal(t, "3.3.3.3", (<-relayInstructions).IP)
+}
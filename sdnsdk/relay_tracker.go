@@ -0,0 +1,168 @@
+package sdnsdk
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bloXroute-Labs/bxcommon-go/clock"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+)
+
+// RelayConnectionTracker keeps the connection state of relays in an IgnoredRelaysMap.
+// Relays stay tracked after they are disconnected, so they are not suggested again as auto relays
+// until disconnectedRelayRetryDelay passed. Relays stored without a TimeAdded are not suggested again.
+type RelayConnectionTracker struct {
+	relays IgnoredRelaysMap
+	clock  clock.Clock
+}
+
+// NewRelayConnectionTracker creates a RelayConnectionTracker keeping the relay states in relays
+func NewRelayConnectionTracker(relays IgnoredRelaysMap) *RelayConnectionTracker {
+	return newRelayConnectionTracker(relays, clock.RealClock{})
+}
+
+// newRelayConnectionTracker creates a RelayConnectionTracker stamping the relay states with the time of clock
+func newRelayConnectionTracker(relays IgnoredRelaysMap, clock clock.Clock) *RelayConnectionTracker {
+	return &RelayConnectionTracker{relays: relays, clock: clock}
+}
+
+// MarkConnected records the relay at ip:port as connected
+func (t *RelayConnectionTracker) MarkConnected(ip string, port int64, isStatic bool) {
+	t.relays.Store(ip, types.RelayInfo{TimeAdded: t.clock.Now(), IsConnected: true, IsStatic: isStatic, Port: port})
+}
+
+// MarkAutoConnected records the relay at ip:port as a connected auto relay unless the relay is already tracked,
+// returning whether it was marked
+func (t *RelayConnectionTracker) MarkAutoConnected(ip string, port int64) bool {
+	_, loaded := t.relays.LoadOrStore(ip, types.RelayInfo{TimeAdded: t.clock.Now(), IsConnected: true, Port: port})
+	return !loaded
+}
+
+// MarkDisconnected records the relay at ip:port as disconnected
+func (t *RelayConnectionTracker) MarkDisconnected(ip string, port int64) {
+	t.relays.Store(ip, types.RelayInfo{TimeAdded: t.clock.Now(), Port: port, IsConnected: false})
+}
+
+// canReconnect returns whether the relay at ip may be connected as an auto relay,
+// i.e. it is not tracked or can be reconnected
+func (t *RelayConnectionTracker) canReconnect(ip string) bool {
+	relayInfo, ok := t.relays.Load(ip)
+	return !ok || t.reconnectable(relayInfo)
+}
+
+// reconnectable returns whether a tracked relay was marked disconnected at least disconnectedRelayRetryDelay ago
+func (t *RelayConnectionTracker) reconnectable(relayInfo types.RelayInfo) bool {
+	return !relayInfo.IsConnected && !relayInfo.TimeAdded.IsZero() && t.clock.Now().Sub(relayInfo.TimeAdded) >= disconnectedRelayRetryDelay
+}
+
+// markAutoReconnected records the relay at ip:port as a connected auto relay unless the relay is tracked
+// and can not be reconnected, returning whether it was marked
+func (t *RelayConnectionTracker) markAutoReconnected(ip string, port int64) bool {
+	newRelayInfo := types.RelayInfo{TimeAdded: t.clock.Now(), IsConnected: true, Port: port}
+	if relays, ok := t.relays.(relayInfoComputer); ok {
+		marked := false
+		relays.Compute(ip, func(relayInfo types.RelayInfo, loaded bool) (types.RelayInfo, bool) {
+			if loaded && !t.reconnectable(relayInfo) {
+				return relayInfo, false
+			}
+			marked = true
+			return newRelayInfo, false
+		})
+		return marked
+	}
+	if relayInfo, ok := t.relays.Load(ip); ok {
+		if !t.reconnectable(relayInfo) {
+			return false
+		}
+		t.relays.Store(ip, newRelayInfo)
+		return true
+	}
+	return t.MarkAutoConnected(ip, port)
+}
+
+// relayInfoComputer is implemented by the relay maps which can update a relay atomically, e.g. syncmap.SyncMap
+type relayInfoComputer interface {
+	Compute(key string, valueFn func(oldValue types.RelayInfo, loaded bool) (newValue types.RelayInfo, delete bool)) (actual types.RelayInfo, ok bool)
+}
+
+// RecordLatency records a latency sample of the relay at ip if it is connected, keeping its recent latency history
+func (t *RelayConnectionTracker) RecordLatency(ip string, latency float64) {
+	if relays, ok := t.relays.(relayInfoComputer); ok {
+		relays.Compute(ip, func(relayInfo types.RelayInfo, loaded bool) (types.RelayInfo, bool) {
+			if loaded && relayInfo.IsConnected {
+				relayInfo.AddLatency(latency)
+			}
+			return relayInfo, !loaded
+		})
+		return
+	}
+	if relayInfo, ok := t.relays.Load(ip); ok && relayInfo.IsConnected {
+		relayInfo.AddLatency(latency)
+		t.relays.Store(ip, relayInfo)
+	}
+}
+
+// IsConnected returns whether the relay at ip is connected
+func (t *RelayConnectionTracker) IsConnected(ip string) bool {
+	relayInfo, ok := t.relays.Load(ip)
+	return ok && relayInfo.IsConnected
+}
+
+// IsTracked returns whether the relay at ip is connected or was disconnected
+func (t *RelayConnectionTracker) IsTracked(ip string) bool {
+	_, ok := t.relays.Load(ip)
+	return ok
+}
+
+// Load returns the state of the relay at ip
+func (t *RelayConnectionTracker) Load(ip string) (types.RelayInfo, bool) {
+	return t.relays.Load(ip)
+}
+
+// ConnectedCount returns the number of connected relays, static and auto
+func (t *RelayConnectionTracker) ConnectedCount() int {
+	count := 0
+	t.relays.Range(func(_ string, relayInfo types.RelayInfo) bool {
+		if relayInfo.IsConnected {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// RelayStatus is a snapshot of a connected relay, or of a potential relay returned by PotentialRelays
+type RelayStatus struct {
+	IP        string
+	Port      int64
+	Latency   float64
+	TimeAdded time.Time
+}
+
+// ConnectedAutoRelays returns a snapshot of the connected auto relays sorted by IP and port
+func (t *RelayConnectionTracker) ConnectedAutoRelays() []RelayStatus {
+	connectedAutoRelays := t.connectedAutoRelayInfos()
+	relays := make([]RelayStatus, 0, len(connectedAutoRelays))
+	for ip, relayInfo := range connectedAutoRelays {
+		relays = append(relays, RelayStatus{IP: ip, Port: relayInfo.Port, Latency: relayInfo.Latency, TimeAdded: relayInfo.TimeAdded})
+	}
+	sort.Slice(relays, func(i, j int) bool {
+		if relays[i].IP != relays[j].IP {
+			return relays[i].IP < relays[j].IP
+		}
+		return relays[i].Port < relays[j].Port
+	})
+	return relays
+}
+
+// connectedAutoRelayInfos returns the connected auto relays by IP
+func (t *RelayConnectionTracker) connectedAutoRelayInfos() map[string]types.RelayInfo {
+	connectedAutoRelays := make(map[string]types.RelayInfo)
+	t.relays.Range(func(ip string, relayInfo types.RelayInfo) bool {
+		if relayInfo.IsConnected && !relayInfo.IsStatic {
+			connectedAutoRelays[ip] = relayInfo
+		}
+		return true
+	})
+	return connectedAutoRelays
+}
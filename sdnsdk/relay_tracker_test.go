@@ -0,0 +1,107 @@
+package sdnsdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bloXroute-Labs/bxcommon-go/clock"
+	"github.com/bloXroute-Labs/bxcommon-go/syncmap"
+	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayConnectionTracker(t *testing.T) {
+	tracker := NewRelayConnectionTracker(syncmap.NewStringMapOf[types.RelayInfo]())
+
+	tracker.MarkConnected("1.1.1.1", 1809, true)
+	assert.True(t, tracker.MarkAutoConnected("2.2.2.2", 1809))
+	assert.True(t, tracker.MarkAutoConnected("3.3.3.3", 1809))
+	// already tracked relays are not marked again
+	assert.False(t, tracker.MarkAutoConnected("1.1.1.1", 1809))
+
+	assert.True(t, tracker.IsConnected("1.1.1.1"))
+	assert.Equal(t, 3, tracker.ConnectedCount())
+	assert.Len(t, tracker.ConnectedAutoRelays(), 2)
+
+	tracker.MarkDisconnected("3.3.3.3", 1809)
+	assert.False(t, tracker.IsConnected("3.3.3.3"))
+	assert.True(t, tracker.IsTracked("3.3.3.3"))
+	assert.False(t, tracker.MarkAutoConnected("3.3.3.3", 1809))
+	assert.Equal(t, 2, tracker.ConnectedCount())
+
+	connectedAutoRelays := tracker.ConnectedAutoRelays()
+	assert.Len(t, connectedAutoRelays, 1)
+	assert.Equal(t, "2.2.2.2", connectedAutoRelays[0].IP)
+	assert.Equal(t, int64(1809), connectedAutoRelays[0].Port)
+
+	assert.False(t, tracker.IsConnected("4.4.4.4"))
+	assert.False(t, tracker.IsTracked("4.4.4.4"))
+}
+
+func TestRelayConnectionTracker_ConnectedAutoRelays(t *testing.T) {
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	timeAdded := time.Now()
+	ignoredRelays.Store("3.3.3.3", types.RelayInfo{TimeAdded: timeAdded, IsConnected: true, Latency: 30, Port: 1810})
+	ignoredRelays.Store("1.1.1.1", types.RelayInfo{TimeAdded: timeAdded, IsConnected: true, Latency: 10, Port: 1809})
+	ignoredRelays.Store("2.2.2.2", types.RelayInfo{TimeAdded: timeAdded, IsConnected: true, IsStatic: true, Port: 1809})
+	ignoredRelays.Store("4.4.4.4", types.RelayInfo{TimeAdded: timeAdded, IsConnected: false, Port: 1809})
+
+	relays := NewRelayConnectionTracker(ignoredRelays).ConnectedAutoRelays()
+	assert.Equal(t, []RelayStatus{
+		{IP: "1.1.1.1", Port: 1809, Latency: 10, TimeAdded: timeAdded},
+		{IP: "3.3.3.3", Port: 1810, Latency: 30, TimeAdded: timeAdded},
+	}, relays)
+
+	// the snapshot is not affected by later changes
+	ignoredRelays.Store("1.1.1.1", types.RelayInfo{TimeAdded: time.Now(), Port: 1809})
+	assert.Equal(t, 10.0, relays[0].Latency)
+	assert.Len(t, NewRelayConnectionTracker(ignoredRelays).ConnectedAutoRelays(), 1)
+}
+
+func TestRelayConnectionTracker_RecordLatency(t *testing.T) {
+	tracker := NewRelayConnectionTracker(syncmap.NewStringMapOf[types.RelayInfo]())
+	assert.True(t, tracker.MarkAutoConnected("1.1.1.1", 1809))
+	tracker.MarkDisconnected("2.2.2.2", 1809)
+
+	tracker.RecordLatency("1.1.1.1", 10)
+	tracker.RecordLatency("1.1.1.1", 12)
+	tracker.RecordLatency("2.2.2.2", 5)
+	tracker.RecordLatency("3.3.3.3", 5)
+
+	relayInfo, _ := tracker.Load("1.1.1.1")
+	assert.Equal(t, []float64{10, 12}, relayInfo.Latencies())
+	assert.Equal(t, float64(12), relayInfo.Latency)
+	// only connected relays keep a latency history
+	relayInfo, _ = tracker.Load("2.2.2.2")
+	assert.Empty(t, relayInfo.Latencies())
+	assert.False(t, tracker.IsTracked("3.3.3.3"))
+}
+
+func TestRelayConnectionTracker_MarkAutoReconnected(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	mockClock.SetTime(time.Now())
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	tracker := newRelayConnectionTracker(ignoredRelays, mockClock)
+
+	tracker.MarkConnected("1.1.1.1", 1809, true)
+	tracker.MarkDisconnected("2.2.2.2", 1809)
+	// relays stored without a TimeAdded stay ignored
+	ignoredRelays.Store("3.3.3.3", types.RelayInfo{Port: 1809})
+
+	assert.True(t, tracker.canReconnect("4.4.4.4"))
+	assert.False(t, tracker.canReconnect("1.1.1.1"))
+	assert.False(t, tracker.canReconnect("2.2.2.2"))
+	assert.False(t, tracker.markAutoReconnected("2.2.2.2", 1809))
+
+	mockClock.IncTime(disconnectedRelayRetryDelay)
+	assert.False(t, tracker.canReconnect("1.1.1.1"))
+	assert.False(t, tracker.canReconnect("3.3.3.3"))
+	assert.False(t, tracker.markAutoReconnected("3.3.3.3", 1809))
+	assert.True(t, tracker.canReconnect("2.2.2.2"))
+	assert.True(t, tracker.markAutoReconnected("2.2.2.2", 1810))
+	assert.True(t, tracker.IsConnected("2.2.2.2"))
+	// a reconnected relay is not marked again
+	assert.False(t, tracker.markAutoReconnected("2.2.2.2", 1810))
+	assert.True(t, tracker.markAutoReconnected("4.4.4.4", 1809))
+	assert.Len(t, tracker.ConnectedAutoRelays(), 2)
+}
@@ -2,16 +2,21 @@ package sdnsdk
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math"
 	"math/big"
+	"math/rand/v2"
+	"net"
 	"net/http"
+	"os"
 	"os/exec"
 	"regexp"
 	"runtime/debug"
@@ -19,12 +24,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bloXroute-Labs/bxcommon-go/cert"
+	"github.com/bloXroute-Labs/bxcommon-go/cli"
+	"github.com/bloXroute-Labs/bxcommon-go/clock"
 	log "github.com/bloXroute-Labs/bxcommon-go/logger"
 	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
 	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/google/uuid"
 	"github.com/jinzhu/copier"
 )
 
@@ -33,6 +42,16 @@ var (
 	ErrSDNUnavailable = errors.New("SDN service unavailable")
 	// ErrNoRelays - sdn did not find any relays error
 	ErrNoRelays = errors.New("no relays were acquired from SDN")
+	// ErrRegistrationFailed - InitGateway failed to register the node with the SDN
+	ErrRegistrationFailed = errors.New("registration with SDN failed")
+	// ErrNetworkFetchFailed - InitGateway failed to fetch the blockchain network from the SDN
+	ErrNetworkFetchFailed = errors.New("fetching blockchain network from SDN failed")
+	// ErrAccountFetchFailed - InitGateway failed to fetch the account model from the SDN
+	ErrAccountFetchFailed = errors.New("fetching account model from SDN failed")
+	// ErrResponseTooLarge - SDN response, as received or decompressed, exceeds the configured max size
+	ErrResponseTooLarge = errors.New("SDN response exceeds max size")
+	// ErrCertExpired - Register was called with an expired certificate
+	ErrCertExpired = errors.New("certificate has expired")
 )
 
 // SDN Http type constants
@@ -44,8 +63,34 @@ const (
 	nodeModelCacheFileName          = "nodemodel.json"
 	potentialRelaysFileName         = "potentialrelays.json"
 	accountModelsFileName           = "accountmodel.json"
+	customerAccountModelsFileName   = "customeraccountmodel.json"
 	httpTimeout                     = 10 * time.Second
-	latencyThreshold                = 10
+	// DefaultUserAgentPrefix is the product name in the User-Agent of SDN requests unless overridden
+	DefaultUserAgentPrefix = "bxcommon-go"
+	// RequestIDHeader carries the unique ID of each SDN request, which is logged if the request fails
+	RequestIDHeader = "X-Request-ID"
+	// defaultPingRelaysTimeout bounds how long the potential relays are pinged, each ping waits up to PingTimeout
+	defaultPingRelaysTimeout   = 5 * time.Second
+	defaultLatencyThreshold    = 10
+	defaultMaxDecompressedSize = 64 << 20
+	defaultMaxResponseSize     = 8 << 20
+	findNewRelayMaxBackoff     = 10 * time.Minute
+	// defaultRelayPort is the port of a --relays entry without a port when no default is configured for the node protocol
+	defaultRelayPort = 1809
+	// defaultHighLatencyWarning is the latency (ms) of the fastest selected relay above which a warning is logged
+	defaultHighLatencyWarning = 40
+	// defaultCertExpiryWarning is how long before the certificate expires Register warns about it by default
+	defaultCertExpiryWarning = 30 * 24 * time.Hour
+	// defaultMaxPacketLoss is the packet loss (%) above which a relay is deprioritized by default
+	defaultMaxPacketLoss = 20
+	// defaultNetworkPingConcurrency is the number of networks PingNetworksRelays fetches and pings at once by default
+	defaultNetworkPingConcurrency = 4
+	// findNewRelayErrorLogAttempts is the number of failed attempts logged at error level by FindNewRelay
+	findNewRelayErrorLogAttempts = 3
+	// disconnectedRelayRetryDelay is how long a relay marked disconnected is not suggested again as an auto relay
+	disconnectedRelayRetryDelay = 10 * time.Minute
+	// pendingSwitchTimeout is how long a Switch instruction the gateway did not act on is not sent again
+	pendingSwitchTimeout = 10 * time.Minute
 )
 
 // SDNHTTP is the interface for realSDNHTTP type
@@ -53,39 +98,205 @@ type SDNHTTP interface {
 	SDNURL() string
 	NodeID() types.NodeID
 	Networks() *message.BlockchainNetworks
+	SnapshotNetworks() message.BlockchainNetworks
 	SetNetworks(networks message.BlockchainNetworks)
 	FetchAllBlockchainNetworks() error
 	FetchBlockchainNetwork() error
+	FetchBlockchainNetworkNum(networkNum types.NetworkNum) error
 	InitGateway(protocol string, network string) error
 	NodeModel() *message.NodeModel
+	ExternalIP() string
 	AccountTier() message.AccountTier
 	AccountModel() message.Account
+	AccountModelLoaded() bool
+	RefreshAccountModel() (message.Account, error)
+	GetAccountModel(accountID types.AccountID) (message.Account, error)
 	NetworkNum() types.NetworkNum
 	Register() error
+	ForceReRegister() error
 	NeedsRegistration() bool
+	CertExpiry() (time.Time, error)
 	FetchCustomerAccountModel(accountID types.AccountID) (message.Account, error)
 	DirectRelayConnections(relayHosts string, relayLimit uint64, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error
+	DirectRelayConnectionsContext(ctx context.Context, relayHosts string, relayLimit uint64, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error
+	PlanRelayConnections(relayHosts string, relayLimit uint64) ([]RelayInstruction, int, error)
 	FindNetwork(networkNum types.NetworkNum) (*message.BlockchainNetwork, error)
 	MinTxAge() time.Duration
+	MinTxAgeForNetwork(networkNum types.NetworkNum) (time.Duration, error)
 	SendNodeEvent(event message.NodeEvent, id types.NodeID)
+	SendNodeEventSync(ctx context.Context, event message.NodeEvent, id types.NodeID) error
+	SendNodeEvents(events []message.NodeEvent, id types.NodeID)
 	Get(endpoint string, requestBody []byte) ([]byte, error)
+	Do(method string, endpoint string, requestBody []byte, headers http.Header) ([]byte, error)
 	GetQuotaUsage(accountID string) (*QuotaResponseBody, error)
+	GetQuotaUsageBatch(accountIDs []string) (map[string]*QuotaResponseBody, error)
 	FindNewRelay(ctx context.Context, oldRelayIP string, oldRelayIPPort int64, relayInstructions chan RelayInstruction, ignoredRelays IgnoredRelaysMap)
+	RelayReconnectFailures() int64
 	FindFastestRelays(relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap)
+	PotentialRelays() ([]RelayStatus, error)
+	PingNetworksRelays(ctx context.Context, networkNums []types.NetworkNum, concurrency int) (map[types.NetworkNum][]RelayCandidate, error)
+	Ping(ctx context.Context) error
+	WaitForRelayConnection(ctx context.Context) error
+	ResponsesFromCache() []string
+	DiagnosticSnapshot() ([]byte, error)
+	Close() error
 }
 
 // realSDNHTTP is a connection to the bloxroute API
 type realSDNHTTP struct {
+	// mu protects networks, accountModel, nodeModel, nodeID, accountID, relayConnections and autoRelayCount
+	mu               sync.RWMutex
 	sslCerts         *cert.SSLCerts
-	getPingLatencies func(peers message.Peers) []nodeLatencyInfo
+	getPingLatencies func(ctx context.Context, peers message.Peers) []nodeLatencyInfo
 	networks         message.BlockchainNetworks
 	accountModel     *message.Account
 	nodeID           types.NodeID
 	accountID        types.AccountID
 	sdnURL           string
-	dataDir          string
+	// fallbackSDNURLs are tried in order after sdnURL when the SDN does not respond or fails with a 5xx
+	fallbackSDNURLs []string
+	// healthySDNURL is the index in sdnURLs of the SDN URL which served the last successful request
+	healthySDNURL atomic.Int32
+	dataDir       string
+	dataDirMode   os.FileMode
+	cacheFS       CacheFS
+	// cachedResponses holds the names of the cache files which served the last response of their request
+	cachedResponses  sync.Map
 	nodeModel        *message.NodeModel
 	relays           message.Peers
+	slowRelayLatency float64
+	latencyThreshold float64
+	externalIP       string
+	// relayReevaluationInterval is the interval of the auto relays re-evaluation loop, zero disables the loop
+	relayReevaluationInterval time.Duration
+	latencySink               LatencySink
+	relayShortfallHandler     RelayShortfallHandler
+	maxDecompressedSize       int64
+	// maxResponseSize limits the size of a response body as received, zero uses defaultMaxResponseSize
+	maxResponseSize         int64
+	ipResolutionPolicy      IPResolutionPolicy
+	expandRelayHostnames    bool
+	requestObserver         RequestObserver
+	rootCAsPEM              []byte
+	insecureSkipVerify      bool
+	nodeModelChangeHandler  NodeModelChangeHandler
+	networksChangeHandler   NetworksChangeHandler
+	localNodeModels         func() []message.NodeModel
+	userAgentPrefix         string
+	relaySelector           RelaySelector
+	transportWrapper        func(http.RoundTripper) http.RoundTripper
+	relayEventStream        bool
+	relayEventStreamBackoff time.Duration
+	// findNewRelayBackoff is the initial FindNewRelay retry interval, zero uses types.RelayMonitorInterval
+	findNewRelayBackoff time.Duration
+	// relayPriorities are the priorities of preferred relays by IP, each priority level counting as
+	// relayPriorityMargin ms less latency when ranking the relays
+	relayPriorities     map[string]int
+	relayPriorityMargin float64
+	// cachePolicy overrides defaultCachePolicy for the endpoints it contains
+	cachePolicy map[CacheEndpoint]bool
+	// relayPortCheckTimeout bounds the TCP dial checking the port of a relay before connecting to it, zero disables the check
+	relayPortCheckTimeout time.Duration
+	// highLatencyWarning is the latency (ms) of the fastest selected relay above which a warning is logged,
+	// zero uses defaultHighLatencyWarning
+	highLatencyWarning float64
+	// certExpiryWarning is how long before the certificate expires Register warns about it, zero uses defaultCertExpiryWarning
+	certExpiryWarning time.Duration
+	// maxPacketLoss is the packet loss (%) above which a relay is deprioritized, nil uses defaultMaxPacketLoss
+	maxPacketLoss *float64
+	// defaultRelayPorts are the ports of --relays entries without a port by protocol and network
+	defaultRelayPorts map[RelayPortKey]int64
+	// pingRelaysTimeout bounds how long the potential relays are pinged, zero uses defaultPingRelaysTimeout
+	// extended by one second per extra ping packet
+	pingRelaysTimeout time.Duration
+	// pingCount is the number of packets each potential relay is pinged with, zero means one
+	pingCount int
+	// relayConnections are the relay connections tracked by DirectRelayConnectionsContext, reported by DiagnosticSnapshot
+	relayConnections IgnoredRelaysMap
+	// autoRelayCount is the number of auto relays requested by DirectRelayConnectionsContext
+	autoRelayCount int
+	// reevaluationMu serializes the auto relay re-evaluations of the relay event stream and the re-evaluation loop
+	reevaluationMu sync.Mutex
+	// pendingSwitches are the auto relays a Switch instruction was sent for which the gateway did not act on yet
+	pendingSwitches pendingRelaySwitches
+	// nodeEvents buffers the node events queued by SendNodeEvents
+	nodeEvents nodeEventQueue
+	// nodeEventFlushInterval is how often the queued node events are posted, zero uses defaultNodeEventFlushInterval
+	nodeEventFlushInterval time.Duration
+	// quotaBatchUnsupported is set once the SDN rejected the quota status batch endpoint
+	quotaBatchUnsupported atomic.Bool
+	// sdnOrderFallback connects the auto relays in the order of the SDN relay list when no relay latency could be measured
+	sdnOrderFallback bool
+	// excludeUnreachableRelays drops the relays which did not answer the ping from the ping results
+	excludeUnreachableRelays bool
+	relayReconnectFailures   atomic.Int64
+	relayConnected           *relayConnectedSignal
+	clock                    clock.Clock
+	// ctx is canceled by Close to stop the goroutines started by the client
+	ctx    context.Context
+	cancel context.CancelFunc
+	// transportMu protects transport, transportNeedsPrivateCert and the private certificate of sslCerts
+	transportMu sync.Mutex
+	// transport is shared by the SDN requests so their connections are reused
+	transport *http.Transport
+	// transportNeedsPrivateCert is whether transport was created with the registration certificate
+	transportNeedsPrivateCert bool
+}
+
+// relayConnectedSignal is closed once the first relay connect instruction is received by the gateway
+type relayConnectedSignal struct {
+	once sync.Once
+	ch   chan struct{}
+}
+
+func newRelayConnectedSignal() *relayConnectedSignal {
+	return &relayConnectedSignal{ch: make(chan struct{})}
+}
+
+func (r *relayConnectedSignal) signal() {
+	if r == nil {
+		return
+	}
+	r.once.Do(func() { close(r.ch) })
+}
+
+// pendingRelaySwitches records when a Switch instruction was sent for each auto relay,
+// so it is not sent again on every re-evaluation until the gateway acts on it
+type pendingRelaySwitches struct {
+	mu    sync.Mutex
+	since map[relayToSwitch]time.Time
+}
+
+// add records a Switch instruction sent for relay at now, returning false if one is already pending.
+// A pending Switch is dropped once its relay is no longer a connected auto relay or was connected again since,
+// and after pendingSwitchTimeout.
+func (p *pendingRelaySwitches) add(relay relayToSwitch, connectedAutoRelays map[string]types.RelayInfo, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for pending, since := range p.since {
+		relayInfo, connected := connectedAutoRelays[pending.ip]
+		if !connected || relayInfo.Port != pending.port || relayInfo.TimeAdded.After(since) || now.Sub(since) >= pendingSwitchTimeout {
+			delete(p.since, pending)
+		}
+	}
+	if _, ok := p.since[relay]; ok {
+		return false
+	}
+	if p.since == nil {
+		p.since = make(map[relayToSwitch]time.Time)
+	}
+	p.since[relay] = now
+	return true
+}
+
+// sendRelayInstruction sends instruction to relayInstructions, returning false if ctx is done first
+func sendRelayInstruction(ctx context.Context, relayInstructions chan<- RelayInstruction, instruction RelayInstruction) bool {
+	select {
+	case relayInstructions <- instruction:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 // relayMap maps a relay's IP to its port
@@ -105,6 +316,155 @@ type nodeLatencyInfo struct {
 	IP      string
 	Port    int64
 	Latency float64
+	// PacketLoss is the percentage of the ping packets which were not answered
+	PacketLoss float64
+	Continent  string
+	Country    string
+	Region     string
+}
+
+// LatencySample is a single relay ping measurement
+type LatencySample struct {
+	IP        string
+	Port      int64
+	Latency   float64
+	Timestamp time.Time
+	Reachable bool
+}
+
+// RequestOutcome describes the outcome of an SDN request
+type RequestOutcome struct {
+	// Endpoint is the requested URL without the SDN URL prefix
+	Endpoint string
+	Method   string
+	// StatusCode is zero if no response was received
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// StatusError is returned when the SDN responds to a request with a status other than
+// 200 OK or 503 Service Unavailable, which is reported as ErrSDNUnavailable
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// Details are the error details returned by the SDN, empty if the response was not an SDN error message
+	Details string
+	// Err describes the failure, including the error details returned by the SDN
+	Err error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// UnavailableError is returned when the SDN responds with 503 Service Unavailable, it matches ErrSDNUnavailable
+type UnavailableError struct {
+	// RetryAfter is the interval suggested by the Retry-After header of the response, zero if there was none
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%v, retry after %v", ErrSDNUnavailable, e.RetryAfter)
+	}
+	return ErrSDNUnavailable.Error()
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return ErrSDNUnavailable
+}
+
+// RetryAfter returns the interval the SDN asked to wait before retrying the request which failed with err,
+// or false if err is not an UnavailableError with a Retry-After interval
+func RetryAfter(err error) (time.Duration, bool) {
+	var unavailableErr *UnavailableError
+	if errors.As(err, &unavailableErr) && unavailableErr.RetryAfter > 0 {
+		return unavailableErr.RetryAfter, true
+	}
+	return 0, false
+}
+
+// unavailableError returns the UnavailableError of a 503 Service Unavailable response
+func (s *realSDNHTTP) unavailableError(resp *http.Response) error {
+	return &UnavailableError{RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), s.timeSource().Now())}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date,
+// returning zero if it is missing, invalid or in the past
+func parseRetryAfter(retryAfter string, now time.Time) time.Duration {
+	retryAfter = strings.TrimSpace(retryAfter)
+	if retryAfter == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseInt(retryAfter, 10, 64); err == nil {
+		if seconds <= 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(retryAfter)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+	return date.Sub(now)
+}
+
+// RequestObserver is called after every SDN request, e.g. to export request metrics
+type RequestObserver func(outcome RequestOutcome)
+
+// NodeModelChangeHandler is called when the SDN changes the node model on registration,
+// with the JSON names of the changed fields
+type NodeModelChangeHandler func(before, after message.NodeModel, changedFields []string)
+
+// NetworksChangeHandler is called when FetchAllBlockchainNetworks finds blockchain networks
+// which were added, removed or changed since the previous fetch
+type NetworksChangeHandler func(diff message.BlockchainNetworksDiff)
+
+// LatencySink receives the latency sample of each relay pinged in a ping round
+type LatencySink func(sample LatencySample)
+
+// RelayShortfall reports that fewer auto relays were connected than requested
+type RelayShortfall struct {
+	// Requested is the number of auto relays which were to be connected
+	Requested int
+	// Connected is the number of auto relays for which Connect instructions were sent
+	Connected int
+}
+
+// RelayShortfallHandler is called when fewer auto relays than requested could be connected,
+// e.g. to alert when a gateway is running with too few relays
+type RelayShortfallHandler func(shortfall RelayShortfall)
+
+// CacheEndpoint identifies an SDN endpoint whose responses can be cached,
+// and served from the cache files when the SDN is unavailable
+type CacheEndpoint string
+
+// CacheEndpoint types
+const (
+	CacheEndpointBlockchainNetworks CacheEndpoint = "blockchain-networks"
+	CacheEndpointBlockchainNetwork  CacheEndpoint = "blockchain-network"
+	CacheEndpointNodes              CacheEndpoint = "nodes"
+	CacheEndpointPotentialRelays    CacheEndpoint = "potential-relays"
+	// CacheEndpointAccount is the account of the node
+	CacheEndpointAccount CacheEndpoint = "account"
+	// CacheEndpointAccounts is the account of a customer, which is not cached by default
+	CacheEndpointAccounts CacheEndpoint = "accounts"
+)
+
+// defaultCachePolicy is whether the responses of each endpoint are cached unless overridden by WithCachePolicy
+var defaultCachePolicy = map[CacheEndpoint]bool{
+	CacheEndpointBlockchainNetworks: true,
+	CacheEndpointBlockchainNetwork:  true,
+	CacheEndpointNodes:              true,
+	CacheEndpointPotentialRelays:    true,
+	CacheEndpointAccount:            true,
+	CacheEndpointAccounts:           false,
 }
 
 // RelayInstruction specifies whether to connect or disconnect to the relay at an IP:Port
@@ -123,6 +483,10 @@ type quotaRequestBody struct {
 	AccountID string `json:"account_id"`
 }
 
+type quotaBatchRequestBody struct {
+	AccountIDs []string `json:"account_ids"`
+}
+
 // QuotaResponseBody quota usage response body
 type QuotaResponseBody struct {
 	AccountID   string `json:"account_id"`
@@ -144,8 +508,22 @@ const (
 	Switch
 )
 
+// String returns the string representation of a connection instruction type for use in logs
+func (c ConnInstructionType) String() string {
+	switch c {
+	case Connect:
+		return "CONNECT"
+	case Disconnect:
+		return "DISCONNECT"
+	case Switch:
+		return "SWITCH"
+	default:
+		return "UNKNOWN"
+	}
+}
+
 // NewSDNHTTP creates a new connection to the bloxroute API
-func NewSDNHTTP(sslCerts *cert.SSLCerts, sdnURL string, nodeModel message.NodeModel, dataDir string) SDNHTTP {
+func NewSDNHTTP(sslCerts *cert.SSLCerts, sdnURL string, nodeModel message.NodeModel, dataDir string, opts ...Option) SDNHTTP {
 	if nodeModel.ExternalIP == "" {
 		var err error
 		nodeModel.ExternalIP, err = IPResolverHolder.GetPublicIP()
@@ -163,11 +541,81 @@ func NewSDNHTTP(sslCerts *cert.SSLCerts, sdnURL string, nodeModel message.NodeMo
 		nodeModel:        &nodeModel,
 		getPingLatencies: getPingLatencies,
 		dataDir:          dataDir,
+		latencyThreshold: defaultLatencyThreshold,
+		relayConnected:   newRelayConnectedSignal(),
+		clock:            clock.RealClock{},
+		externalIP:       nodeModel.ExternalIP,
+	}
+	sdn.ctx, sdn.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(sdn)
 	}
 	return sdn
 }
 
-// FetchAllBlockchainNetworks fetches list of blockchain networks from the SDN
+// Close stops the goroutines started by the SDN client, e.g. the auto relay re-evaluation and FindNewRelay retries,
+// and closes its idle connections to the SDN after sending the node events queued by SendNodeEvents,
+// waiting at most nodeEventFlushTimeout for them. Methods of the SDN client must not be called after Close.
+func (s *realSDNHTTP) Close() error {
+	s.nodeEvents.close()
+	if s.cancel != nil {
+		s.cancel()
+		// the events drained by a flush of the loop in flight are sent before the remaining ones
+		s.nodeEvents.loop.Wait()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), nodeEventFlushTimeout)
+	defer cancel()
+	if err := s.flushNodeEvents(ctx); err != nil {
+		log.Errorf("could not send node events to SDN: %v", err)
+	}
+	s.closeTransport()
+	return nil
+}
+
+// timeSource returns the clock of the SDN client, the system clock by default
+func (s *realSDNHTTP) timeSource() clock.Clock {
+	if s.clock == nil {
+		return clock.RealClock{}
+	}
+	return s.clock
+}
+
+// highLatencyWarningThreshold returns the latency (ms) of the fastest selected relay above which a warning is logged
+func (s *realSDNHTTP) highLatencyWarningThreshold() float64 {
+	if s.highLatencyWarning <= 0 {
+		return defaultHighLatencyWarning
+	}
+	return s.highLatencyWarning
+}
+
+// relayTracker returns a RelayConnectionTracker of ignoredRelays stamping the relay states with the client clock
+func (s *realSDNHTTP) relayTracker(ignoredRelays IgnoredRelaysMap) *RelayConnectionTracker {
+	return newRelayConnectionTracker(ignoredRelays, s.timeSource())
+}
+
+// clientContext returns the context which is canceled by Close
+func (s *realSDNHTTP) clientContext() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// withClientContext returns a context which is done when ctx is done or the SDN client is closed
+func (s *realSDNHTTP) withClientContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if s.ctx == nil {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(s.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// FetchAllBlockchainNetworks fetches list of blockchain networks from the SDN, replacing the known networks.
+// The networks added, removed or changed since the previous fetch are reported to the networks change handler.
 func (s *realSDNHTTP) FetchAllBlockchainNetworks() error {
 	err := s.getBlockchainNetworks()
 	if err != nil {
@@ -178,183 +626,531 @@ func (s *realSDNHTTP) FetchAllBlockchainNetworks() error {
 
 // Get is a generic function for sending GET request to SDNHttp
 func (s *realSDNHTTP) Get(endpoint string, requestBody []byte) ([]byte, error) {
-	url := s.sdnURL + endpoint
-	proxyReq, err := http.NewRequest(http.MethodGet, url, bytes.NewReader(requestBody))
+	return s.Do(http.MethodGet, endpoint, requestBody, nil)
+}
+
+// Do is a generic function for sending a request to SDNHttp with additional headers, e.g. an API key.
+// The headers are merged with the headers set by the SDN client, which are not overwritten,
+// e.g. the Content-Type of POST requests, the User-Agent and the request ID.
+// The response is returned whatever its status. If fallback SDN URLs are configured, the request is sent to
+// the next SDN while an SDN does not respond or responds with a 5xx, and the last response is returned.
+func (s *realSDNHTTP) Do(method string, endpoint string, requestBody []byte, headers http.Header) ([]byte, error) {
+	var respBytes []byte
+	err := s.withSDNFailover(s.clientContext(), s.currentSDNURL()+endpoint, bytes.NewReader(requestBody), func(url string, body io.Reader) (int, error) {
+		var statusCode int
+		var err error
+		respBytes, statusCode, err = s.doOnce(method, url, body, headers)
+		if err == nil && statusCode >= http.StatusInternalServerError {
+			return statusCode, errServerErrorResponse
+		}
+		return statusCode, err
+	})
+	if errors.Is(err, errServerErrorResponse) {
+		return respBytes, nil
+	}
+	return respBytes, err
+}
+
+// errServerErrorResponse makes withSDNFailover try the next SDN when Do gets a 5xx response, which it returns as is
+var errServerErrorResponse = errors.New("SDN responded with a server error")
+
+// doOnce sends a request of Do to url, returning the response whatever its status
+func (s *realSDNHTTP) doOnce(method string, url string, body io.Reader, headers http.Header) (_ []byte, statusCode int, err error) {
+	start := time.Now()
+	defer func() { s.observeRequest(url, method, statusCode, start, err) }()
+
+	proxyReq, err := http.NewRequest(method, url, body)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if method == http.MethodPost {
+		proxyReq.Header.Set("Content-Type", "application/json")
+	}
+	proxyReq.Header.Set("Accept-Encoding", "gzip, deflate")
+	requestID := s.setRequestHeaders(proxyReq)
+	for key, values := range headers {
+		if proxyReq.Header.Get(key) != "" {
+			continue
+		}
+		for _, value := range values {
+			proxyReq.Header.Add(key, value)
+		}
 	}
+	defer func() {
+		if err != nil {
+			log.Debugf("%v request %v to %v failed: %v", method, requestID, url, err)
+		}
+	}()
 	c, err := s.httpClient()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	resp, err := c.Do(proxyReq)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	respBytes, err := io.ReadAll(resp.Body)
+	defer s.close(resp)
+	statusCode = resp.StatusCode
+	respBytes, err := s.readBody(resp)
 	if err != nil {
-		return nil, err
+		return nil, statusCode, err
+	}
+	return respBytes, statusCode, nil
+}
+
+// Ping checks whether the SDN is reachable by issuing a HEAD request to its base URL.
+// It returns nil if the SDN responds with 200 and ErrSDNUnavailable if it responds with 503.
+// If fallback SDN URLs are configured, the next SDN is pinged while an SDN does not respond or responds with a 5xx.
+func (s *realSDNHTTP) Ping(ctx context.Context) error {
+	return s.withSDNFailover(ctx, s.currentSDNURL(), nil, func(sdnURL string, _ io.Reader) (int, error) {
+		return s.pingOnce(ctx, sdnURL)
+	})
+}
+
+// pingOnce issues a HEAD request of Ping to sdnURL, returning the response status code
+func (s *realSDNHTTP) pingOnce(ctx context.Context, sdnURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, sdnURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	s.setRequestHeaders(req)
+	client, err := s.httpClient()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not reach SDN at %v: %v", sdnURL, err)
+	}
+	defer s.close(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.StatusCode, nil
+	case http.StatusServiceUnavailable:
+		return resp.StatusCode, s.unavailableError(resp)
+	default:
+		return resp.StatusCode, fmt.Errorf("SDN at %v responded to ping with %v", sdnURL, resp.Status)
 	}
-	return respBytes, nil
 }
 
 // FetchBlockchainNetwork fetches a blockchain network given the blockchain number of the model registered with SDN
 func (s *realSDNHTTP) FetchBlockchainNetwork() error {
-	networkNum := s.NetworkNum()
-	url := fmt.Sprintf("%v/blockchain-networks/%v", s.sdnURL, networkNum)
-	resp, err := s.httpWithCache(url, http.MethodGet, blockchainNetworkCacheFileName, nil)
+	return s.FetchBlockchainNetworkNum(s.NetworkNum())
+}
+
+// FetchBlockchainNetworkNum fetches the blockchain network networkNum, which does not need to be the network
+// the node is registered on, e.g. for a relay proxy routing several networks. The network is cached like
+// the registered one and can be found with FindNetwork.
+func (s *realSDNHTTP) FetchBlockchainNetworkNum(networkNum types.NetworkNum) error {
+	url := fmt.Sprintf("%v/blockchain-networks/%d", s.sdnURL, networkNum)
+	resp, err := s.httpWithCachePolicy(CacheEndpointBlockchainNetwork, url, http.MethodGet, networkCacheFileName(blockchainNetworkCacheFileName, networkNum), nil)
 	if err != nil {
 		return err
 	}
-	prev, ok := s.networks[networkNum]
-	if !ok {
-		s.networks[networkNum] = new(message.BlockchainNetwork)
+	s.mu.RLock()
+	prev := s.networks[networkNum]
+	network := new(message.BlockchainNetwork)
+	if prev != nil {
+		// fields missing from the response keep their previous values
+		*network = *prev
+		if ttd, ok := prev.DefaultAttributes.TerminalTotalDifficulty.(*big.Int); ok && ttd != nil {
+			// the response is decoded into the difficulty, copy it so the previous network is not modified
+			network.DefaultAttributes.TerminalTotalDifficulty = new(big.Int).Set(ttd)
+		}
 	}
-	if err = json.Unmarshal(resp, s.networks[networkNum]); err != nil {
+	s.mu.RUnlock()
+
+	if err = json.Unmarshal(resp, network); err != nil {
 		return fmt.Errorf("could not deserialize '%s' response into blockchain network (previously cached as: %v) for networkNum %v: %v", string(resp), prev, networkNum, err)
 	}
-	if prev != nil && s.networks[networkNum].MinTxAgeSeconds != prev.MinTxAgeSeconds {
-		log.Debugf("MinTxAgeSeconds changed from %v seconds to %v seconds after the update", prev.MinTxAgeSeconds, s.networks[networkNum].MinTxAgeSeconds)
+	if prev != nil && network.MinTxAgeSeconds != prev.MinTxAgeSeconds {
+		log.Debugf("MinTxAgeSeconds changed from %v seconds to %v seconds after the update", prev.MinTxAgeSeconds, network.MinTxAgeSeconds)
 	}
-	if s.networks[networkNum].Protocol == types.EthereumProtocol && s.networks[networkNum].DefaultAttributes.TerminalTotalDifficulty == 0 {
-		s.networks[networkNum].DefaultAttributes.TerminalTotalDifficulty = big.NewInt(math.MaxInt)
+	if err = network.ApplyDefaults(); err != nil {
+		return fmt.Errorf("invalid blockchain network for networkNum %v: %v", networkNum, err)
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.networks[networkNum]; ok {
+		// update in place so networks previously returned by FindNetwork see the update
+		*existing = *network
+	} else {
+		if s.networks == nil {
+			s.networks = make(message.BlockchainNetworks)
+		}
+		s.networks[networkNum] = network
+	}
 	return nil
 }
 
-// InitGateway fetches all necessary information over HTTP from the SDN
+// InitGateway fetches all necessary information over HTTP from the SDN.
+// Errors wrap ErrRegistrationFailed, ErrNetworkFetchFailed or ErrAccountFetchFailed depending on the failed step,
+// and the state fetched by the preceding steps stays populated.
 func (s *realSDNHTTP) InitGateway(protocol string, network string) error {
 	var err error
-	s.nodeModel.Network = network
-	s.nodeModel.Protocol = protocol
+	s.updateNodeModel(func(nodeModel *message.NodeModel) {
+		nodeModel.Network = network
+		nodeModel.Protocol = protocol
+	})
+	s.mu.Lock()
 	s.networks = make(message.BlockchainNetworks)
+	s.mu.Unlock()
 
 	if err = s.Register(); err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrRegistrationFailed, err)
 	}
 	if err = s.FetchBlockchainNetwork(); err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrNetworkFetchFailed, err)
 	}
-	err = s.getAccountModel(s.nodeModel.AccountID)
+	err = s.getAccountModel(s.NodeModel().AccountID)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %w", ErrAccountFetchFailed, err)
 	}
 	return nil
 }
 
-func logLowestLatency(lowestLatencyRelay nodeLatencyInfo) {
-	if lowestLatencyRelay.Latency > 40 {
-		log.Warnf("ping latency of the fastest relay %v:%v is %v ms, which is more than 40 ms",
-			lowestLatencyRelay.IP, lowestLatencyRelay.Port, lowestLatencyRelay.Latency)
+// logLowestLatency logs the latency (ms) of the fastest selected relay, warning if it is above highLatencyWarning (ms)
+func logLowestLatency(lowestLatencyRelay nodeLatencyInfo, highLatencyWarning float64) {
+	entry := log.WithFields(relayLogFields(lowestLatencyRelay.IP, lowestLatencyRelay.Port, Connect)).
+		WithField("latency_ms", lowestLatencyRelay.Latency)
+	if lowestLatencyRelay.Latency > highLatencyWarning {
+		entry.Warnf("ping latency of the fastest relay %v:%v is %v ms, which is more than %v ms",
+			lowestLatencyRelay.IP, lowestLatencyRelay.Port, lowestLatencyRelay.Latency, highLatencyWarning)
 	}
-	log.Infof("fastest selected relay %v:%v has a latency of %v ms",
+	entry.Infof("fastest selected relay %v:%v has a latency of %v ms",
 		lowestLatencyRelay.IP, lowestLatencyRelay.Port, lowestLatencyRelay.Latency)
 }
 
+// relayLogFields returns the structured log fields describing a relay instruction
+func relayLogFields(ip string, port int64, instructionType ConnInstructionType) log.Fields {
+	return log.Fields{
+		"relay_ip":         ip,
+		"relay_port":       port,
+		"instruction_type": instructionType.String(),
+	}
+}
+
 // DirectRelayConnections directs the gateway on relays to connect/disconnect
-func (s realSDNHTTP) DirectRelayConnections(relayHosts string, relayLimit uint64, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error {
-	overrideRelays, autoCount, err := parsedCmdlineRelays(relayHosts, relayLimit)
+func (s *realSDNHTTP) DirectRelayConnections(relayHosts string, relayLimit uint64, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error {
+	return s.DirectRelayConnectionsContext(context.Background(), relayHosts, relayLimit, relayInstructions, ignoredRelays)
+}
+
+// DirectRelayConnectionsContext directs the gateway on relays to connect/disconnect.
+// If a relay re-evaluation interval or the relay event stream is configured,
+// auto relays keep being re-evaluated until ctx is done.
+func (s *realSDNHTTP) DirectRelayConnectionsContext(ctx context.Context, relayHosts string, relayLimit uint64, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error {
+	staticInstructions, autoCount, err := s.PlanRelayConnections(relayHosts, relayLimit)
 	if err != nil {
 		return err
 	}
 
+	s.mu.Lock()
+	s.relayConnections = ignoredRelays
+	s.autoRelayCount = autoCount
+	s.mu.Unlock()
+
 	// connect relays specified in `relays` argument
-	for ip, port := range overrideRelays {
-		ignoredRelays.Store(ip, types.RelayInfo{TimeAdded: time.Now(), IsConnected: true, IsStatic: true, Port: port})
-		relayInstructions <- RelayInstruction{IP: ip, Port: port, Type: Connect, IsStatic: true}
+	sendCtx, cancelSend := s.withClientContext(ctx)
+	defer cancelSend()
+	tracker := s.relayTracker(ignoredRelays)
+	for _, instruction := range staticInstructions {
+		tracker.MarkConnected(instruction.IP, instruction.Port, true)
+		log.WithFields(relayLogFields(instruction.IP, instruction.Port, Connect)).Infof("connecting to static relay %v:%v", instruction.IP, instruction.Port)
+		if !sendRelayInstruction(sendCtx, relayInstructions, instruction) {
+			return fmt.Errorf("failed to connect to static relay %v:%v: %w", instruction.IP, instruction.Port, sendCtx.Err())
+		}
+		s.relayConnected.signal()
 	}
 
 	if autoCount == 0 {
 		return nil
 	}
 
-	// TODO: fetching relay from SDN should be done in a loop inside manageAutoRelays
 	// if auto relays specified, start and manage them
-	relays, err := s.getRelays(s.nodeModel.NodeID, s.nodeModel.BlockchainNetworkNum)
+	relays, err := s.getRelays(s.NodeModel().NodeID, s.NetworkNum())
 	if err != nil {
 		return fmt.Errorf("failed to extract relay list: %v", err)
 	}
 	if len(relays) == 0 {
 		return ErrNoRelays
 	}
-	go s.manageAutoRelays(autoCount, relayInstructions, relays, ignoredRelays)
+	ctx, cancel := s.withClientContext(ctx)
+	go func() {
+		defer cancel()
+		s.manageAutoRelays(ctx, autoCount, relayInstructions, relays, ignoredRelays)
+		// the relay event stream and the periodic re-evaluation run side by side if both are enabled
+		var wg sync.WaitGroup
+		if s.relayReevaluationInterval > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.reevaluateAutoRelays(ctx, s.relayReevaluationInterval, autoCount, relayInstructions, ignoredRelays)
+			}()
+		}
+		if s.relayEventStream {
+			s.streamRelayEvents(ctx, autoCount, relayInstructions, ignoredRelays)
+		}
+		wg.Wait()
+	}()
 	return nil
 }
 
-func (s realSDNHTTP) connectToNewRelay(relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error {
-	relays, err := s.getRelays(s.nodeModel.NodeID, s.nodeModel.BlockchainNetworkNum)
+// PlanRelayConnections parses relayHosts the same way DirectRelayConnections does and returns the Connect
+// instructions for the static relays, sorted by IP, and the number of auto relays, without connecting to any relay.
+// It can be used to validate the --relays argument.
+func (s *realSDNHTTP) PlanRelayConnections(relayHosts string, relayLimit uint64) ([]RelayInstruction, int, error) {
+	overrideRelays, autoCount, err := parseRelayHosts(relayHosts, relayLimit, s.relayPortDefault(), s.ipResolutionPolicy, s.expandRelayHostnames)
 	if err != nil {
-		return fmt.Errorf("failed to extract relay list: %v", err)
+		return nil, 0, err
+	}
+
+	instructions := make([]RelayInstruction, 0, len(overrideRelays))
+	for ip, port := range overrideRelays {
+		instructions = append(instructions, RelayInstruction{IP: ip, Port: port, Type: Connect, IsStatic: true})
+	}
+	sort.Slice(instructions, func(i, j int) bool { return instructions[i].IP < instructions[j].IP })
+	return instructions, autoCount, nil
+}
+
+// reevaluateAutoRelays periodically re-evaluates the auto relays until ctx is done
+func (s *realSDNHTTP) reevaluateAutoRelays(ctx context.Context, interval time.Duration, autoRelayCount int, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) {
+	ticker := s.timeSource().Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Alert():
+		}
+		s.reevaluateAutoRelaysOnce(ctx, autoRelayCount, relayInstructions, ignoredRelays)
+	}
+}
+
+// reevaluateAutoRelaysOnce re-fetches the potential relays from the SDN and re-pings them,
+// connecting missing auto relays and switching or disconnecting the ones that became slow
+func (s *realSDNHTTP) reevaluateAutoRelaysOnce(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) {
+	// the relay event stream and the periodic re-evaluation do not re-evaluate the auto relays at the same time
+	s.reevaluationMu.Lock()
+	defer s.reevaluationMu.Unlock()
+	relays, err := s.getRelays(s.NodeModel().NodeID, s.NetworkNum())
+	if err != nil {
+		log.Errorf("failed to extract relay list: %v", err)
+		return
+	}
+	pingLatencies := s.pingRelays(ctx, relays) // list of SDN relays sorted by ascending order of latency
+	if s.sdnOrderFallback && !latencyMeasured(pingLatencies) {
+		s.replenishAutoRelaysInSDNOrder(ctx, autoRelayCount, relayInstructions, relays, ignoredRelays)
+		return
+	}
+	if len(pingLatencies) == 0 {
+		log.Errorf("ping latencies not found for relays from SDN")
+		return
+	}
+
+	if missingCount := autoRelayCount - len(s.getAutoConnectedRelays(ignoredRelays)); missingCount > 0 {
+		s.connectAutoRelays(ctx, missingCount, relayInstructions, pingLatencies, ignoredRelays)
+	}
+	s.switchAutoRelays(ctx, relayInstructions, pingLatencies, ignoredRelays)
+}
+
+// replenishAutoRelaysInSDNOrder connects the auto relays missing out of autoRelayCount in the order of the SDN relay list.
+// The auto relays can not be compared without latencies, so they are only replenished.
+func (s *realSDNHTTP) replenishAutoRelaysInSDNOrder(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, relays message.Peers, ignoredRelays IgnoredRelaysMap) {
+	if missingCount := autoRelayCount - len(s.getAutoConnectedRelays(ignoredRelays)); missingCount > 0 {
+		s.connectRelaysInSDNOrder(ctx, missingCount, relayInstructions, relays, ignoredRelays)
+	}
+}
+
+// WaitForRelayConnection blocks until the gateway received the first relay connect instruction or ctx is done
+func (s *realSDNHTTP) WaitForRelayConnection(ctx context.Context) error {
+	if s.relayConnected == nil {
+		return errors.New("relay connections are not tracked by this SDN client")
+	}
+	select {
+	case <-s.relayConnected.ch:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("no relay connection was established: %w", ctx.Err())
+	}
+}
+
+func (s *realSDNHTTP) connectToNewRelay(ctx context.Context, relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) error {
+	relays, err := s.getRelays(s.NodeModel().NodeID, s.NetworkNum())
+	if err != nil {
+		return fmt.Errorf("failed to extract relay list: %w", err)
 	}
 	if len(relays) == 0 {
 		return ErrNoRelays
 	}
-	s.manageAutoRelays(1, relayInstructions, relays, ignoredRelays)
+	s.manageAutoRelays(ctx, 1, relayInstructions, relays, ignoredRelays)
 	return nil
 }
 
-// parsedCmdlineRelays parses the relayHosts argument and returns relays IPs up to the relay limit
-func parsedCmdlineRelays(relayHosts string, relayLimit uint64) (relayMap, int, error) {
+// ParseRelayHosts parses a --relays argument: a comma separated list of relays given as host or host:port,
+// where a missing port defaults to 1809 and "auto" (case-insensitive) requests an auto relay chosen by the SDN.
+// Host names are resolved to their first address. Entries after relayLimit relays are ignored, as are
+// duplicate entries resolving to an already listed address. It returns the port of each relay by IP
+// and the number of auto relays, or an error if relayHosts is empty, has an empty entry,
+// a malformed entry, an invalid port or a host which can not be resolved.
+func ParseRelayHosts(relayHosts string, relayLimit uint64) (map[string]int64, int, error) {
+	return parseRelayHosts(relayHosts, relayLimit, defaultRelayPort, IPResolutionFirst, false)
+}
+
+// RelaySlot is an entry of a --relays argument, either an explicit relay or an auto relay chosen by the SDN
+type RelaySlot struct {
+	// IP and Port are the address of an explicit relay, empty for an auto relay
+	IP   string
+	Port int64
+	Auto bool
+}
+
+// ParseRelaySlots parses a --relays argument like ParseRelayHosts, returning the explicit relays and the auto relays
+// in the order they were given, e.g. for callers which fill the auto relays between the explicit relays
+func ParseRelaySlots(relayHosts string, relayLimit uint64) ([]RelaySlot, error) {
+	return parseRelaySlots(relayHosts, relayLimit, defaultRelayPort, IPResolutionFirst, false)
+}
+
+// RelayPortKey identifies the nodes using a default relay port, an empty Network matching all the networks of Protocol
+type RelayPortKey struct {
+	Protocol string
+	Network  string
+}
+
+// relayPortDefault returns the port of the --relays entries without a port for the protocol and network of the node,
+// falling back to the default port of its protocol and then to defaultRelayPort
+func (s *realSDNHTTP) relayPortDefault() int64 {
+	nodeModel := s.NodeModel()
+	if nodeModel == nil || len(s.defaultRelayPorts) == 0 {
+		return defaultRelayPort
+	}
+	protocol := strings.ToLower(nodeModel.Protocol)
+	network := strings.ToLower(nodeModel.Network)
+	for _, key := range []RelayPortKey{{Protocol: protocol, Network: network}, {Protocol: protocol}} {
+		if port, ok := s.defaultRelayPorts[key]; ok {
+			return port
+		}
+	}
+	return defaultRelayPort
+}
+
+// parseRelayHosts parses the relayHosts argument like ParseRelayHosts, using defaultPort for the entries without
+// a port and policy to resolve host names. If expandHostnames is set, a host name is expanded to all its resolved addresses.
+func parseRelayHosts(relayHosts string, relayLimit uint64, defaultPort int64, policy IPResolutionPolicy, expandHostnames bool) (relayMap, int, error) {
+	slots, err := parseRelaySlots(relayHosts, relayLimit, defaultPort, policy, expandHostnames)
+	if err != nil {
+		return nil, 0, err
+	}
 	overrideRelays := make(relayMap)
 	autoCount := 0
+	for _, slot := range slots {
+		if slot.Auto {
+			autoCount++
+		} else {
+			overrideRelays[slot.IP] = slot.Port
+		}
+	}
+	return overrideRelays, autoCount, nil
+}
+
+// parseRelaySlots parses the relayHosts argument like ParseRelaySlots, using defaultPort for the entries without
+// a port and policy to resolve host names. If expandHostnames is set, a host name is expanded to all its resolved addresses.
+func parseRelaySlots(relayHosts string, relayLimit uint64, defaultPort int64, policy IPResolutionPolicy, expandHostnames bool) ([]RelaySlot, error) {
+	var slots []RelaySlot
+	overrideRelays := make(relayMap)
 
 	if len(relayHosts) == 0 {
-		return nil, 0, fmt.Errorf("no --relays/relay-ip arguments were provided")
+		return nil, fmt.Errorf("no --relays/relay-ip arguments were provided")
 	}
-	for _, relay := range strings.Split(relayHosts, ",") {
+	for _, relay := range cli.SplitList(relayHosts) {
 		// Clean and get the relay string
-		if uint64(len(overrideRelays)+autoCount) == relayLimit { // Only counting unique relays + auto relays
+		if uint64(len(slots)) == relayLimit { // Only counting unique relays + auto relays
 			break
 		}
-		suggestedRelayString := strings.Trim(relay, " ")
-		if suggestedRelayString == "auto" {
-			autoCount++
+		suggestedRelayString := relay
+		if strings.EqualFold(suggestedRelayString, "auto") {
+			slots = append(slots, RelaySlot{Auto: true})
 			continue
 		}
 		if suggestedRelayString == "" {
-			return nil, 0, fmt.Errorf("argument to --relays/relay-ip is empty or has an extra comma")
+			return nil, fmt.Errorf("argument to --relays/relay-ip is empty or has an extra comma")
 		}
 		suggestedRelaySplit := strings.Split(suggestedRelayString, ":")
 		if len(suggestedRelaySplit) > 2 {
-			return nil, 0, fmt.Errorf("relay from --relays/relay-ip was given in the incorrect format '%s', should be IP:Port", relay)
+			return nil, fmt.Errorf("relay from --relays/relay-ip was given in the incorrect format '%s', should be IP:Port", relay)
 		}
 
 		host := suggestedRelaySplit[0]
-		port := 1809
-		var err error
+		port := defaultPort
 		// Parse the relay string
 
 		if len(suggestedRelaySplit) == 2 { // Make sure that port is an integer
-			port, err = strconv.Atoi(suggestedRelaySplit[1])
+			parsedPort, err := strconv.Atoi(suggestedRelaySplit[1])
 			if err != nil {
-				return nil, 0, fmt.Errorf("port provided %v is not valid - %v", suggestedRelaySplit[1], err)
+				return nil, fmt.Errorf("port provided %v is not valid - %v", suggestedRelaySplit[1], err)
 			}
+			port = int64(parsedPort)
 		}
-		ip, err := GetIP(host)
+		ips, err := resolveRelayHost(host, policy, expandHostnames)
 		if err != nil {
 			log.Errorf("relay %s from --relays/relay-ip is not valid - %v", suggestedRelaySplit[0], err)
-			return nil, 0, err
+			return nil, err
 		}
-		if _, ok := overrideRelays[ip]; !ok {
-			overrideRelays[ip] = int64(port)
+		for _, ip := range ips {
+			if uint64(len(slots)) == relayLimit {
+				break
+			}
+			if existingPort, ok := overrideRelays[ip]; ok {
+				log.Warnf("relay %v from --relays/relay-ip resolves to %v which was already specified as %v:%v, ignoring the duplicate",
+					suggestedRelayString, ip, ip, existingPort)
+				continue
+			}
+			overrideRelays[ip] = port
+			slots = append(slots, RelaySlot{IP: ip, Port: port})
 		}
 	}
-	return overrideRelays, autoCount, nil
+	return slots, nil
 }
 
-func (s realSDNHTTP) getAutoConnectedRelays(ignoredRelays IgnoredRelaysMap) map[string]types.RelayInfo {
-	connectedAutoRelays := make(map[string]types.RelayInfo)
-	ignoredRelays.Range(func(key string, value types.RelayInfo) bool {
-		if value.IsConnected && !value.IsStatic {
-			connectedAutoRelays[key] = value
-		}
-		return true
-	})
-	return connectedAutoRelays
+// resolveRelayHost returns the address of a relay host, or all its addresses if expandHostnames is set
+func resolveRelayHost(host string, policy IPResolutionPolicy, expandHostnames bool) ([]string, error) {
+	if expandHostnames {
+		return GetIPsWithPolicy(host, policy)
+	}
+	ip, err := GetIPWithPolicy(host, policy)
+	if err != nil {
+		return nil, err
+	}
+	return []string{ip}, nil
+}
+
+// CanonicalizeRelays parses the relayHosts argument the same way DirectRelayConnections does and returns
+// the effective relay set as a sorted, comma separated list of ip:port entries followed by one "auto" per auto relay.
+// IPv6 addresses are in brackets, e.g. [2001:db8::1]:1809.
+func CanonicalizeRelays(relayHosts string, relayLimit uint64) (string, error) {
+	overrideRelays, autoCount, err := ParseRelayHosts(relayHosts, relayLimit)
+	if err != nil {
+		return "", err
+	}
+
+	relays := make([]string, 0, len(overrideRelays)+autoCount)
+	for ip, port := range overrideRelays {
+		relays = append(relays, net.JoinHostPort(ip, strconv.FormatInt(port, 10)))
+	}
+	sort.Strings(relays)
+	for i := 0; i < autoCount; i++ {
+		relays = append(relays, "auto")
+	}
+	return strings.Join(relays, ","), nil
+}
+
+func (s *realSDNHTTP) getAutoConnectedRelays(ignoredRelays IgnoredRelaysMap) map[string]types.RelayInfo {
+	return s.relayTracker(ignoredRelays).connectedAutoRelayInfos()
 }
 
-func (s realSDNHTTP) findFastestAvailableRelays(pingLatencies []nodeLatencyInfo, connectedAutoRelays map[string]types.RelayInfo) []nodeLatencyInfo {
+func (s *realSDNHTTP) findFastestAvailableRelays(pingLatencies []nodeLatencyInfo, connectedAutoRelays map[string]types.RelayInfo) []nodeLatencyInfo {
 	var fastestAvailableRelays = make([]nodeLatencyInfo, 0)
 
 	for _, pingLatency := range pingLatencies {
@@ -366,16 +1162,44 @@ func (s realSDNHTTP) findFastestAvailableRelays(pingLatencies []nodeLatencyInfo,
 		}
 		fastestAvailableRelays = append(fastestAvailableRelays, pingLatency)
 	}
+	s.sortByPreference(fastestAvailableRelays)
 	return fastestAvailableRelays
 }
 
-func (s realSDNHTTP) findRelaysToSwitch(connectedAutoRelays map[string]types.RelayInfo, fastestAvailableRelays []nodeLatencyInfo) map[relayToSwitch][]nodeLatencyInfo {
+// rankedLatency returns the latency of the relay at ip reduced by the latency margin of its priority,
+// which is the latency the relays are ranked by
+func (s *realSDNHTTP) rankedLatency(ip string, latency float64) float64 {
+	return latency - float64(s.relayPriorities[ip])*s.relayPriorityMargin
+}
+
+// sortByPreference orders the relays by ascending ranked latency, the ones on the node continent first
+// among the relays ranked the same, keeping the order of the others
+func (s *realSDNHTTP) sortByPreference(pingLatencies []nodeLatencyInfo) {
+	var continent string
+	if nodeModel := s.NodeModel(); nodeModel != nil {
+		continent = nodeModel.Continent
+	}
+	if len(s.relayPriorities) == 0 && continent == "" {
+		return
+	}
+	sort.SliceStable(pingLatencies, func(i, j int) bool {
+		rankedLatencyI := s.rankedLatency(pingLatencies[i].IP, pingLatencies[i].Latency)
+		rankedLatencyJ := s.rankedLatency(pingLatencies[j].IP, pingLatencies[j].Latency)
+		if rankedLatencyI != rankedLatencyJ {
+			return rankedLatencyI < rankedLatencyJ
+		}
+		return continent != "" && pingLatencies[i].Continent == continent && pingLatencies[j].Continent != continent
+	})
+}
+
+func (s *realSDNHTTP) findRelaysToSwitch(connectedAutoRelays map[string]types.RelayInfo, fastestAvailableRelays []nodeLatencyInfo) map[relayToSwitch][]nodeLatencyInfo {
 	relaysToSwitch := make(map[relayToSwitch][]nodeLatencyInfo) // map[oldIP and Port][]newRelayNodeLatencyInfo
 
 OuterLoop:
-	for _, relay := range convertMapToSortedSlice(connectedAutoRelays) {
+	for _, relay := range s.convertMapToSortedSlice(connectedAutoRelays) {
 		for _, pingLatency := range fastestAvailableRelays {
-			if relay.relayInfo.Latency < pingLatency.Latency+latencyThreshold {
+			// the median of the recent latencies is used, so a relay is not switched after a single latency spike
+			if s.rankedLatency(relay.ip, relay.relayInfo.MedianLatency()) < s.rankedLatency(pingLatency.IP, pingLatency.Latency)+s.latencyThreshold {
 				continue OuterLoop
 			}
 			relaysToSwitch[relayToSwitch{ip: relay.ip, port: relay.relayInfo.Port}] = append(relaysToSwitch[relayToSwitch{ip: relay.ip, port: relay.relayInfo.Port}], pingLatency)
@@ -384,116 +1208,472 @@ OuterLoop:
 	return relaysToSwitch
 }
 
+// findRelaysToDisconnect returns the connected auto relays which are slower than the configured slow relay latency
+// and have no faster relay to switch to. Static relays are never returned.
+func (s *realSDNHTTP) findRelaysToDisconnect(connectedAutoRelays map[string]types.RelayInfo, relaysToSwitch map[relayToSwitch][]nodeLatencyInfo) []relayToSwitch {
+	if s.slowRelayLatency <= 0 {
+		return nil
+	}
+
+	var relaysToDisconnect []relayToSwitch
+	for _, relay := range s.convertMapToSortedSlice(connectedAutoRelays) {
+		if relay.relayInfo.IsStatic || relay.relayInfo.MedianLatency() <= s.slowRelayLatency {
+			continue
+		}
+		slowRelay := relayToSwitch{ip: relay.ip, port: relay.relayInfo.Port}
+		if _, ok := relaysToSwitch[slowRelay]; ok {
+			continue
+		}
+		relaysToDisconnect = append(relaysToDisconnect, slowRelay)
+	}
+	return relaysToDisconnect
+}
+
 type autoRelay struct {
 	ip        string
 	relayInfo types.RelayInfo
 }
 
-func convertMapToSortedSlice(connectedAutoRelays map[string]types.RelayInfo) []autoRelay {
+// convertMapToSortedSlice returns the connected auto relays by descending ranked latency, the least preferred first.
+// Relays with the same ranked latency are in descending IP order, the reverse of sortByLatency.
+func (s *realSDNHTTP) convertMapToSortedSlice(connectedAutoRelays map[string]types.RelayInfo) []autoRelay {
 	relaySlice := make([]autoRelay, 0, len(connectedAutoRelays))
 	for k, v := range connectedAutoRelays {
 		relaySlice = append(relaySlice, autoRelay{k, v})
 	}
 	sort.Slice(relaySlice, func(i, j int) bool {
-		return relaySlice[i].relayInfo.Latency > relaySlice[j].relayInfo.Latency
+		latencyI := s.rankedLatency(relaySlice[i].ip, relaySlice[i].relayInfo.MedianLatency())
+		latencyJ := s.rankedLatency(relaySlice[j].ip, relaySlice[j].relayInfo.MedianLatency())
+		if latencyI != latencyJ {
+			return latencyI > latencyJ
+		}
+		return relaySlice[i].ip > relaySlice[j].ip
 	})
 	return relaySlice
 }
 
-func (s realSDNHTTP) FindFastestRelays(relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) {
-	relays, err := s.getRelays(s.nodeModel.NodeID, s.nodeModel.BlockchainNetworkNum)
+func (s *realSDNHTTP) FindFastestRelays(relayInstructions chan<- RelayInstruction, ignoredRelays IgnoredRelaysMap) {
+	relays, err := s.getRelays(s.NodeModel().NodeID, s.NetworkNum())
 	if err != nil {
 		log.Errorf("failed to extract relyInfo list: %v", err)
 		return
 	}
-	pingLatencies := s.getPingLatencies(relays) // list of SDN relays sorted by ascending order of Latency
+	ctx := s.clientContext()
+	pingLatencies := s.pingRelays(ctx, relays) // list of SDN relays sorted by ascending order of Latency
+	if s.sdnOrderFallback && !latencyMeasured(pingLatencies) {
+		s.mu.RLock()
+		autoRelayCount := s.autoRelayCount
+		s.mu.RUnlock()
+		s.replenishAutoRelaysInSDNOrder(ctx, autoRelayCount, relayInstructions, relays, ignoredRelays)
+		return
+	}
 	if len(pingLatencies) == 0 {
 		log.Errorf("ping latencies not found for relays from SDN")
 		return
 	}
-	connectedAutoRelays := s.getAutoConnectedRelays(ignoredRelays)
-	fastestAvailableRelays := s.findFastestAvailableRelays(pingLatencies, connectedAutoRelays)
-	relaysToSwitch := s.findRelaysToSwitch(connectedAutoRelays, fastestAvailableRelays)
-
-	for oldRelay, newRelays := range relaysToSwitch {
-		relayInstructions <- RelayInstruction{IP: oldRelay.ip, Port: oldRelay.port, Type: Switch, RelaysToSwitch: newRelays}
-	}
+	s.switchAutoRelays(ctx, relayInstructions, pingLatencies, ignoredRelays)
 }
 
-func (s realSDNHTTP) manageAutoRelays(autoRelayCount int, relayInstructions chan<- RelayInstruction, relays message.Peers, ignoredRelays IgnoredRelaysMap) {
-	pingLatencies := s.getPingLatencies(relays) // list of SDN relays sorted by ascending order of latency
-	if len(pingLatencies) == 0 {
-		log.Errorf("ping latencies not found for relays from SDN")
-		return
+// PingNetworksRelays fetches and pings the potential relays of each network concurrently, at most concurrency
+// networks at a time (4 if concurrency is not positive), stopping when ctx is done. It returns the relays of each
+// network sorted by ascending latency, and the errors of the networks whose relays could not be fetched.
+func (s *realSDNHTTP) PingNetworksRelays(ctx context.Context, networkNums []types.NetworkNum, concurrency int) (map[types.NetworkNum][]RelayCandidate, error) {
+	if concurrency <= 0 {
+		concurrency = defaultNetworkPingConcurrency
 	}
+	ctx, cancel := s.withClientContext(ctx)
+	defer cancel()
 
-	autoRelayCounter := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	results := make(map[types.NetworkNum][]RelayCandidate, len(networkNums))
+	slots := make(chan struct{}, concurrency)
+	nodeID := s.NodeModel().NodeID
+	for _, networkNum := range networkNums {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("network %v: %w", networkNum, ctx.Err()))
+				mu.Unlock()
+				return
+			}
 
-	for idx, pingLatency := range pingLatencies {
-		newRelayIP, err := GetIP(pingLatency.IP)
-		if err != nil {
-			log.Errorf("relay %s from the SDN does not have a valid IP address: %v", pingLatency.IP, err)
+			relays, err := s.getRelays(nodeID, networkNum)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("network %v: failed to extract relay list: %w", networkNum, err))
+				mu.Unlock()
+				return
+			}
+			pingLatencies := s.pingRelays(ctx, relays)
+			candidates := make([]RelayCandidate, 0, len(pingLatencies))
+			for _, pingLatency := range pingLatencies {
+				candidates = append(candidates, RelayCandidate(pingLatency))
+			}
+			mu.Lock()
+			results[networkNum] = candidates
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results, errors.Join(errs...)
+}
+
+// PotentialRelays fetches and pings the potential relays of the node network and returns them in the order
+// auto relays are considered, by ascending latency, same continent and relay priorities, without connecting
+// to any of them, e.g. to let users pick relays. The relays have no TimeAdded.
+func (s *realSDNHTTP) PotentialRelays() ([]RelayStatus, error) {
+	relays, err := s.getRelays(s.NodeModel().NodeID, s.NetworkNum())
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract relay list: %w", err)
+	}
+	pingLatencies := s.pingRelays(s.clientContext(), relays)
+	s.sortCandidates(pingLatencies)
+	potentialRelays := make([]RelayStatus, 0, len(pingLatencies))
+	for _, pingLatency := range pingLatencies {
+		potentialRelays = append(potentialRelays, RelayStatus{IP: pingLatency.IP, Port: pingLatency.Port, Latency: pingLatency.Latency})
+	}
+	return potentialRelays, nil
+}
+
+// switchAutoRelays sends Switch instructions for connected auto relays that have a faster relay available,
+// and Disconnect instructions for slow auto relays without one if enabled.
+// A Switch instruction is not sent again while the gateway did not act on it. Relays in ignoredRelays which are
+// not connected auto relays are not suggested as a replacement, unless they were marked disconnected
+// at least disconnectedRelayRetryDelay ago. It stops when ctx is done.
+func (s *realSDNHTTP) switchAutoRelays(ctx context.Context, relayInstructions chan<- RelayInstruction, pingLatencies []nodeLatencyInfo, ignoredRelays IgnoredRelaysMap) {
+	tracker := s.relayTracker(ignoredRelays)
+	for _, pingLatency := range pingLatencies {
+		tracker.RecordLatency(pingLatency.IP, pingLatency.Latency)
+	}
+	connectedAutoRelays := tracker.connectedAutoRelayInfos()
+	candidates := make([]nodeLatencyInfo, 0, len(pingLatencies))
+	for _, pingLatency := range pingLatencies {
+		if _, connected := connectedAutoRelays[pingLatency.IP]; !connected && (!tracker.canReconnect(pingLatency.IP) || s.lossyRelay(pingLatency)) {
+			continue
+		}
+		candidates = append(candidates, pingLatency)
+	}
+	fastestAvailableRelays := s.findFastestAvailableRelays(candidates, connectedAutoRelays)
+	relaysToSwitch := s.findRelaysToSwitch(connectedAutoRelays, fastestAvailableRelays)
+
+	// switch the slowest relays first, so they get the fastest replacements if the gateway follows the instructions in order
+	now := s.timeSource().Now()
+	for _, relay := range s.convertMapToSortedSlice(connectedAutoRelays) {
+		oldRelay := relayToSwitch{ip: relay.ip, port: relay.relayInfo.Port}
+		newRelays, ok := relaysToSwitch[oldRelay]
+		if !ok {
 			continue
 		}
-		// only connect to the relay if not already connected to or still connected
-		if _, ok := ignoredRelays.LoadOrStore(newRelayIP, types.RelayInfo{TimeAdded: time.Now(), IsConnected: true, Port: pingLatency.Port}); ok {
+		if !s.pendingSwitches.add(oldRelay, connectedAutoRelays, now) {
+			log.WithFields(relayLogFields(oldRelay.ip, oldRelay.port, Switch)).
+				Debugf("switch of auto relay %v:%v is still pending, not sending it again", oldRelay.ip, oldRelay.port)
 			continue
 		}
-		logLowestLatency(pingLatencies[idx])
-		relayInstructions <- RelayInstruction{IP: newRelayIP, Port: pingLatency.Port, Type: Connect}
+		log.WithFields(relayLogFields(oldRelay.ip, oldRelay.port, Switch)).
+			WithFields(log.Fields{"latency_ms": connectedAutoRelays[oldRelay.ip].Latency, "new_relay_ip": newRelays[0].IP, "new_relay_latency_ms": newRelays[0].Latency}).
+			Infof("switching auto relay %v:%v to a faster relay", oldRelay.ip, oldRelay.port)
+		if !sendRelayInstruction(ctx, relayInstructions, RelayInstruction{IP: oldRelay.ip, Port: oldRelay.port, Type: Switch, RelaysToSwitch: newRelays}) {
+			return
+		}
+	}
 
-		autoRelayCounter++
-		if autoRelayCounter == autoRelayCount {
-			// we found all autoRelays so we are done
+	for _, slowRelay := range s.findRelaysToDisconnect(connectedAutoRelays, relaysToSwitch) {
+		log.WithFields(relayLogFields(slowRelay.ip, slowRelay.port, Disconnect)).
+			WithField("latency_ms", connectedAutoRelays[slowRelay.ip].Latency).
+			Warnf("auto relay %v:%v is slower than %v ms and no faster relay is available, disconnecting",
+				slowRelay.ip, slowRelay.port, s.slowRelayLatency)
+		tracker.MarkDisconnected(slowRelay.ip, slowRelay.port)
+		if !sendRelayInstruction(ctx, relayInstructions, RelayInstruction{IP: slowRelay.ip, Port: slowRelay.port, Type: Disconnect}) {
 			return
 		}
 	}
+}
+
+func (s *realSDNHTTP) manageAutoRelays(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, relays message.Peers, ignoredRelays IgnoredRelaysMap) {
+	pingLatencies := s.pingRelays(ctx, relays) // list of SDN relays sorted by ascending order of latency
+	if s.sdnOrderFallback && !latencyMeasured(pingLatencies) {
+		s.connectRelaysInSDNOrder(ctx, autoRelayCount, relayInstructions, relays, ignoredRelays)
+		return
+	}
+	if len(pingLatencies) == 0 {
+		log.Errorf("ping latencies not found for relays from SDN")
+		s.reportRelayShortfall(autoRelayCount, 0)
+		return
+	}
+	s.connectAutoRelays(ctx, autoRelayCount, relayInstructions, pingLatencies, ignoredRelays)
+}
+
+// sortCandidates orders the pinged relays, sorted by ascending latency, in the order auto relays are considered:
+// by ranked latency, relays on the node continent first among the ones ranked the same,
+// the relays losing too many ping packets coming last
+func (s *realSDNHTTP) sortCandidates(pingLatencies []nodeLatencyInfo) {
+	s.sortByPreference(pingLatencies)
+	sort.SliceStable(pingLatencies, func(i, j int) bool {
+		return !s.lossyRelay(pingLatencies[i]) && s.lossyRelay(pingLatencies[j])
+	})
+}
+
+// lossyRelay returns whether the packet loss of a pinged relay exceeds the max packet loss
+func (s *realSDNHTTP) lossyRelay(pingLatency nodeLatencyInfo) bool {
+	maxPacketLoss := float64(defaultMaxPacketLoss)
+	if s.maxPacketLoss != nil {
+		maxPacketLoss = *s.maxPacketLoss
+	}
+	return pingLatency.PacketLoss > maxPacketLoss
+}
+
+// connectAutoRelays sends Connect instructions for autoRelayCount relays which are not ignored,
+// in the order chosen by the relay selector, the fastest relays first by default
+func (s *realSDNHTTP) connectAutoRelays(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, pingLatencies []nodeLatencyInfo, ignoredRelays IgnoredRelaysMap) {
+	s.sortCandidates(pingLatencies)
+	candidates := make([]RelayCandidate, 0, len(pingLatencies))
+	for _, pingLatency := range pingLatencies {
+		candidates = append(candidates, RelayCandidate(pingLatency))
+	}
+	selector := s.relaySelector
+	if selector == nil {
+		selector = LatencyRelaySelector{}
+	}
+
+	s.connectCandidates(ctx, autoRelayCount, relayInstructions, selector.SelectRelays(candidates, autoRelayCount), ignoredRelays, true)
+}
+
+// connectRelaysInSDNOrder sends Connect instructions for autoRelayCount relays which are not ignored, in the order
+// of the SDN relay list, when no relay latency could be measured and the SDN order fallback is enabled
+func (s *realSDNHTTP) connectRelaysInSDNOrder(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, relays message.Peers, ignoredRelays IgnoredRelaysMap) {
+	log.Warnf("no relay latency could be measured, connecting to %v auto relays in the order of the SDN relay list", autoRelayCount)
+	candidates := make([]RelayCandidate, 0, len(relays))
+	for _, relay := range relays {
+		candidates = append(candidates, RelayCandidate{
+			IP:        relay.IP,
+			Port:      relay.Port,
+			Latency:   PingTimeout,
+			Continent: relay.Attributes.Continent,
+			Country:   relay.Attributes.Country,
+			Region:    relay.Attributes.Region,
+		})
+	}
+	s.connectCandidates(ctx, autoRelayCount, relayInstructions, candidates, ignoredRelays, false)
+}
+
+// connectCandidates sends Connect instructions for the first autoRelayCount candidates which are not ignored,
+// logging the latency of the first one if measured. It stops when ctx is done.
+func (s *realSDNHTTP) connectCandidates(ctx context.Context, autoRelayCount int, relayInstructions chan<- RelayInstruction, candidates []RelayCandidate, ignoredRelays IgnoredRelaysMap, measured bool) {
+	tracker := s.relayTracker(ignoredRelays)
+	autoRelayCounter := 0
+
+	for _, candidate := range candidates {
+		newRelayIPs, err := resolveRelayHost(candidate.IP, s.ipResolutionPolicy, s.expandRelayHostnames)
+		if err != nil {
+			log.Errorf("relay %s from the SDN does not have a valid IP address: %v", candidate.IP, err)
+			continue
+		}
+		for _, newRelayIP := range newRelayIPs {
+			// only connect to the relay if not connected and not disconnected recently
+			if !tracker.canReconnect(newRelayIP) {
+				continue
+			}
+			if !s.relayPortAccepting(newRelayIP, candidate.Port) || !tracker.markAutoReconnected(newRelayIP, candidate.Port) {
+				continue
+			}
+			if measured {
+				logLowestLatency(nodeLatencyInfo(candidate), s.highLatencyWarningThreshold())
+			}
+			if !sendRelayInstruction(ctx, relayInstructions, RelayInstruction{IP: newRelayIP, Port: candidate.Port, Type: Connect}) {
+				return
+			}
+			s.relayConnected.signal()
+
+			autoRelayCounter++
+			if autoRelayCounter == autoRelayCount {
+				// we found all autoRelays so we are done
+				return
+			}
+		}
+	}
 	// if we are here we failed to find all needed auto relays
 	log.Errorf("available SDN relays %v; requested auto count %v", autoRelayCounter, autoRelayCount)
+	s.reportRelayShortfall(autoRelayCount, autoRelayCounter)
+}
+
+// reportRelayShortfall calls the relay shortfall handler, if any, with the number of auto relays requested and connected
+func (s *realSDNHTTP) reportRelayShortfall(requested, connected int) {
+	if s.relayShortfallHandler == nil || connected >= requested {
+		return
+	}
+	s.relayShortfallHandler(RelayShortfall{Requested: requested, Connected: connected})
+}
+
+// relayPortAccepting returns whether the relay at ip accepts TCP connections on port within the relay port check
+// timeout, or true if the relay port check is disabled
+func (s *realSDNHTTP) relayPortAccepting(ip string, port int64) bool {
+	if s.relayPortCheckTimeout <= 0 {
+		return true
+	}
+	dialer := net.Dialer{Timeout: s.relayPortCheckTimeout}
+	conn, err := dialer.DialContext(s.clientContext(), "tcp", net.JoinHostPort(ip, strconv.FormatInt(port, 10)))
+	if err != nil {
+		log.Warnf("skipping relay %v:%v which does not accept connections: %v", ip, port, err)
+		return false
+	}
+	_ = conn.Close()
+	return true
 }
 
-func (s realSDNHTTP) FindNewRelay(ctx context.Context, oldRelayIP string, oldRelayIPPort int64, relayInstructions chan RelayInstruction, ignoredRelays IgnoredRelaysMap) {
+func (s *realSDNHTTP) FindNewRelay(ctx context.Context, oldRelayIP string, oldRelayIPPort int64, relayInstructions chan RelayInstruction, ignoredRelays IgnoredRelaysMap) {
 	log.Errorf("relay %v is not reachable, switching relay", oldRelayIP)
-	ignoredRelays.Store(oldRelayIP, types.RelayInfo{TimeAdded: time.Now(), Port: oldRelayIPPort, IsConnected: false})
+	s.relayTracker(ignoredRelays).MarkDisconnected(oldRelayIP, oldRelayIPPort)
+
+	ctx, cancel := s.withClientContext(ctx)
+	defer cancel()
+
+	backoff := s.findNewRelayBackoff
+	if backoff <= 0 {
+		backoff = types.RelayMonitorInterval
+	}
+	backoff = min(backoff, findNewRelayMaxBackoff)
 	for {
-		err := s.connectToNewRelay(relayInstructions, ignoredRelays)
+		err := s.connectToNewRelay(ctx, relayInstructions, ignoredRelays)
 		if err == nil {
+			s.relayReconnectFailures.Store(0)
 			return // Exit the function if successful
 		}
-		log.Errorf("error while trying to reconnect to other relay: %v", err)
+		failures := s.relayReconnectFailures.Add(1)
+		// jitter the retry so gateways don't retry in lockstep after an SDN outage
+		retryIn := backoff + rand.N(backoff/5+1)
+		if retryAfter, ok := RetryAfter(err); ok {
+			// the SDN asked to wait for a specific interval, which is bounded like the backoff
+			retryIn = min(retryAfter, findNewRelayMaxBackoff)
+		}
+		if failures <= findNewRelayErrorLogAttempts {
+			log.Errorf("error while trying to reconnect to other relay (attempt %v), retrying in %v: %v", failures, retryIn, err)
+		} else {
+			log.Debugf("error while trying to reconnect to other relay (attempt %v), retrying in %v: %v", failures, retryIn, err)
+		}
 
+		timer := s.timeSource().Timer(retryIn)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
-		case <-time.After(types.RelayMonitorInterval):
+		case <-timer.Alert():
 		}
+		backoff = min(2*backoff, findNewRelayMaxBackoff)
 	}
 }
 
+// RelayReconnectFailures returns the number of consecutive failed FindNewRelay attempts to connect to a new relay
+func (s *realSDNHTTP) RelayReconnectFailures() int64 {
+	return s.relayReconnectFailures.Load()
+}
+
 // NodeModel returns the node model returned by the SDN
-func (s realSDNHTTP) NodeModel() *message.NodeModel {
+func (s *realSDNHTTP) NodeModel() *message.NodeModel {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.nodeModel
 }
 
-// AccountTier returns the account tier name
-func (s realSDNHTTP) AccountTier() message.AccountTier {
+// updateNodeModel applies update to a copy of the node model and replaces it,
+// so node models previously returned by NodeModel are never modified concurrently
+func (s *realSDNHTTP) updateNodeModel(update func(nodeModel *message.NodeModel)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodeModel := *s.nodeModel
+	update(&nodeModel)
+	s.nodeModel = &nodeModel
+}
+
+// AccountTier returns the account tier name, empty if the account model has not been loaded
+func (s *realSDNHTTP) AccountTier() message.AccountTier {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.accountModel == nil {
+		return ""
+	}
 	return s.accountModel.TierName
 }
 
-// AccountModel returns the account model
-func (s realSDNHTTP) AccountModel() message.Account {
+// AccountModel returns the account model, a zero account model if it has not been loaded by InitGateway
+// or RefreshAccountModel, which AccountModelLoaded reports
+func (s *realSDNHTTP) AccountModel() message.Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.accountModel == nil {
+		return message.Account{}
+	}
 	return *s.accountModel
 }
 
+// AccountModelLoaded returns whether the account model of the node has been loaded from the SDN or the cache files
+func (s *realSDNHTTP) AccountModelLoaded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.accountModel != nil
+}
+
+// ExternalIP returns the external IP the node registered with, or the one it will register with if it did not
+// register yet, i.e. the IP given in the node model or the one autodiscovered by NewSDNHTTP if none was given
+func (s *realSDNHTTP) ExternalIP() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.externalIP == "" && s.nodeModel != nil {
+		return s.nodeModel.ExternalIP
+	}
+	return s.externalIP
+}
+
 // NetworkNum returns the registered network number of the node model
-func (s realSDNHTTP) NetworkNum() types.NetworkNum {
+func (s *realSDNHTTP) NetworkNum() types.NetworkNum {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.nodeModel.BlockchainNetworkNum
 }
 
-func (s realSDNHTTP) httpClient() (*http.Client, error) {
+func (s *realSDNHTTP) httpClient() (*http.Client, error) {
+	transport, err := s.sharedTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if s.transportWrapper != nil {
+		roundTripper = s.transportWrapper(roundTripper)
+	}
+
+	client := &http.Client{
+		Transport: roundTripper,
+		Timeout:   httpTimeout,
+	}
+
+	return client, nil
+}
+
+// sharedTransport returns the transport shared by the SDN requests, creating it on first use
+// and again once the private certificate replaced the registration certificate
+func (s *realSDNHTTP) sharedTransport() (*http.Transport, error) {
+	s.transportMu.Lock()
+	defer s.transportMu.Unlock()
+	needsPrivateCert := s.sslCerts != nil && s.sslCerts.NeedsPrivateCert()
+	if s.transport != nil && s.transportNeedsPrivateCert == needsPrivateCert {
+		return s.transport, nil
+	}
+
 	var tlsConfig *tls.Config
 	var err error
-	if s.sslCerts.NeedsPrivateCert() {
+	if s.sslCerts == nil {
+		// without SSL certs no client certificate is presented, e.g. to a local SDN
+		tlsConfig = &tls.Config{}
+	} else if needsPrivateCert {
 		tlsConfig, err = s.sslCerts.LoadRegistrationConfig()
 	} else {
 		tlsConfig, err = s.sslCerts.LoadPrivateConfig()
@@ -501,46 +1681,111 @@ func (s realSDNHTTP) httpClient() (*http.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(s.rootCAsPEM) > 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if !rootCAs.AppendCertsFromPEM(s.rootCAsPEM) {
+			return nil, errors.New("could not parse the additional SDN root certificates")
+		}
+		tlsConfig.RootCAs = rootCAs
+		tlsConfig.InsecureSkipVerify = false
+	}
+	if s.insecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-		Timeout: httpTimeout,
+	if s.transport != nil {
+		s.transport.CloseIdleConnections()
+	}
+	s.transport = &http.Transport{
+		TLSClientConfig: tlsConfig,
+		// responses are decompressed by readBody which also limits the decompressed size
+		DisableCompression: true,
 	}
+	s.transportNeedsPrivateCert = needsPrivateCert
+	return s.transport, nil
+}
 
-	return client, nil
+// closeTransport closes the idle connections of the shared transport, which is created again by the next request
+func (s *realSDNHTTP) closeTransport() {
+	s.transportMu.Lock()
+	defer s.transportMu.Unlock()
+	s.resetTransport()
+}
+
+// resetTransport closes the idle connections of the shared transport and discards it, transportMu must be held
+func (s *realSDNHTTP) resetTransport() {
+	if s.transport != nil {
+		s.transport.CloseIdleConnections()
+		s.transport = nil
+	}
+}
+
+// needsPrivateCert returns whether the private certificate was not saved yet
+func (s *realSDNHTTP) needsPrivateCert() bool {
+	s.transportMu.Lock()
+	defer s.transportMu.Unlock()
+	return s.sslCerts.NeedsPrivateCert()
 }
 
 // Register submits a registration request to bxapi. This will return private certificates for the node
-// and assign a node ID.
+// and assign a node ID. It returns ErrCertExpired without contacting bxapi if the certificate has expired.
 func (s *realSDNHTTP) Register() error {
-	if s.sslCerts.NeedsPrivateCert() {
+	if s.localNodeModels != nil {
+		if err := s.NodeModel().CheckExternalPortConflicts(s.localNodeModels()); err != nil {
+			return err
+		}
+	}
+	if err := s.checkCertExpiry(); err != nil {
+		return err
+	}
+
+	sendsCSR := s.needsPrivateCert()
+	if sendsCSR {
 		log.Debug("new private certificate needed, appending csr to node registration")
 		csr, err := s.sslCerts.CreateCSR()
 		if err != nil {
 			return err
 		}
-		s.nodeModel.Csr = string(csr)
+		s.updateNodeModel(func(nodeModel *message.NodeModel) {
+			nodeModel.Csr = string(csr)
+		})
 	} else {
 		nodeID, err := s.sslCerts.GetNodeID()
 		if err != nil {
 			return err
 		}
+		s.mu.Lock()
 		s.nodeID = nodeID
+		s.mu.Unlock()
 	}
 
-	if s.nodeModel.NodeID != "" {
-		log.Debugf("registering SDN for %s with node ID '%v' and version '%v'", s.nodeModel.NodeType, s.nodeModel.NodeID, s.nodeModel.SourceVersion)
+	nodeModel := *s.NodeModel()
+	registeredNodeModel := nodeModel
+	if nodeModel.NodeID != "" {
+		log.Debugf("registering SDN for %s with node ID '%v' and version '%v'", nodeModel.NodeType, nodeModel.NodeID, nodeModel.SourceVersion)
 	} else {
-		log.Debugf("registering SDN for %s with IP '%v' and version '%v'", s.nodeModel.NodeType, s.nodeModel.ExternalIP, s.nodeModel.SourceVersion)
+		log.Debugf("registering SDN for %s with IP '%v' and version '%v'", nodeModel.NodeType, nodeModel.ExternalIP, nodeModel.SourceVersion)
 	}
 
-	resp, err := s.httpWithCache(s.sdnURL+"/nodes", http.MethodPost, nodeModelCacheFileName, bytes.NewBuffer(s.nodeModel.Pack()))
+	cacheFileName := nodeModelCacheFile(nodeModel.Protocol, nodeModel.Network)
+	var resp []byte
+	var err error
+	if sendsCSR {
+		// the cached response holds the certificate issued before, which must not be installed instead of a new one
+		resp, err = s.http(s.sdnURL+"/nodes", http.MethodPost, bytes.NewBuffer(nodeModel.Pack()))
+		if err == nil && s.cacheEnabled(CacheEndpointNodes) {
+			s.updateCache(cacheFileName, resp)
+		}
+	} else {
+		resp, err = s.httpWithCachePolicy(CacheEndpointNodes, s.sdnURL+"/nodes", http.MethodPost, cacheFileName, bytes.NewBuffer(nodeModel.Pack()))
+	}
 	if err != nil {
 		return err
 	}
-	if err = json.Unmarshal(resp, &s.nodeModel); err != nil {
+	if err = json.Unmarshal(resp, &nodeModel); err != nil {
 		return fmt.Errorf("could not deserialize '%s' response into node model: %v", string(resp), err)
 	}
 	accountID, err := s.sslCerts.GetAccountID()
@@ -548,11 +1793,26 @@ func (s *realSDNHTTP) Register() error {
 		return err
 	}
 
-	s.nodeID = s.nodeModel.NodeID
+	s.mu.Lock()
+	s.nodeModel = &nodeModel
+	s.nodeID = nodeModel.NodeID
 	s.accountID = accountID
+	s.externalIP = registeredNodeModel.ExternalIP
+	s.mu.Unlock()
+
+	if changedFields := registeredNodeModel.ChangedFields(nodeModel); len(changedFields) > 0 {
+		log.Debugf("SDN changed the node model fields %v on registration", changedFields)
+		if s.nodeModelChangeHandler != nil {
+			s.nodeModelChangeHandler(registeredNodeModel, nodeModel, changedFields)
+		}
+	}
 
-	if s.sslCerts.NeedsPrivateCert() {
-		err := s.sslCerts.SavePrivateCert(s.nodeModel.Cert)
+	if s.needsPrivateCert() {
+		s.transportMu.Lock()
+		err := s.sslCerts.SavePrivateCert(nodeModel.Cert)
+		// the connections made with the registration certificate are not reused
+		s.resetTransport()
+		s.transportMu.Unlock()
 		// should pretty much never happen unless there are SDN problems, in which
 		// case just abort on startup
 		if err != nil {
@@ -563,9 +1823,60 @@ func (s *realSDNHTTP) Register() error {
 	return nil
 }
 
+// CertExpiry returns the expiry time of the certificate Register uses: the private certificate once loaded,
+// the registration only certificate otherwise
+func (s *realSDNHTTP) CertExpiry() (time.Time, error) {
+	// the private certificate is replaced under transportMu by Register and ForceReRegister
+	s.transportMu.Lock()
+	defer s.transportMu.Unlock()
+	return s.sslCerts.CertExpiry()
+}
+
+// checkCertExpiry returns ErrCertExpired if the certificate Register uses has expired,
+// and warns if it expires within the cert expiry warning window
+func (s *realSDNHTTP) checkCertExpiry() error {
+	expiry, err := s.CertExpiry()
+	if err != nil {
+		log.Debugf("could not check the certificate expiry: %v", err)
+		return nil
+	}
+	now := s.timeSource().Now()
+	if !now.Before(expiry) {
+		return fmt.Errorf("%w on %v, a new certificate is needed to register with the SDN", ErrCertExpired, expiry.UTC())
+	}
+	warning := s.certExpiryWarning
+	if warning <= 0 {
+		warning = defaultCertExpiryWarning
+	}
+	if remaining := expiry.Sub(now); remaining < warning {
+		log.Warnf("certificate expires on %v, in %v, renew it to keep registering with the SDN", expiry.UTC(), remaining.Round(time.Minute))
+	}
+	return nil
+}
+
+// ForceReRegister discards the node ID, the account ID and the private certificate and registers with the SDN again,
+// requesting a new private certificate, e.g. after the certificate was revoked or rotated out-of-band.
+// If the registration fails the node still needs registration.
+func (s *realSDNHTTP) ForceReRegister() error {
+	s.transportMu.Lock()
+	s.sslCerts.ClearPrivateCert()
+	// the connections made with the discarded certificate are not reused
+	s.resetTransport()
+	s.transportMu.Unlock()
+
+	s.mu.Lock()
+	s.nodeID = ""
+	s.accountID = ""
+	s.mu.Unlock()
+	s.updateNodeModel(func(nodeModel *message.NodeModel) {
+		nodeModel.NodeID = ""
+	})
+	return s.Register()
+}
+
 // NeedsRegistration indicates whether proxy must register with the SDN to run
 func (s *realSDNHTTP) NeedsRegistration() bool {
-	return s.nodeID == "" || s.sslCerts.NeedsPrivateCert()
+	return s.NodeID() == "" || s.needsPrivateCert()
 }
 
 func (s *realSDNHTTP) close(resp *http.Response) {
@@ -598,20 +1909,97 @@ func (s *realSDNHTTP) GetQuotaUsage(accountID string) (*QuotaResponseBody, error
 	return &quotaResp, nil
 }
 
-func (s *realSDNHTTP) getAccountModelWithEndpoint(accountID types.AccountID, endpoint string) (message.Account, error) {
+// GetQuotaUsageBatch fetches the quota usage of several accounts in one request, keyed by account ID.
+// If the SDN does not support the batch request, the quota usage of each account is fetched with GetQuotaUsage.
+// If the SDN does not return some of the accounts, the returned quotas are accompanied by an error listing them.
+func (s *realSDNHTTP) GetQuotaUsageBatch(accountIDs []string) (map[string]*QuotaResponseBody, error) {
+	if s.quotaBatchUnsupported.Load() {
+		return s.getQuotaUsageOneByOne(accountIDs)
+	}
+
+	body, err := json.Marshal(quotaBatchRequestBody{AccountIDs: accountIDs})
+	if err != nil {
+		log.Errorf("unable to marshal SDN request: %v", err)
+		return nil, err
+	}
+
+	// unlike Get, http returns a StatusError telling whether the SDN supports the batch endpoint
+	resp, err := s.http(fmt.Sprintf("%v/accounts/quota-status/batch", s.sdnURL), http.MethodGet, bytes.NewReader(body))
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && batchEndpointUnsupported(statusErr) {
+		log.Infof("SDN does not support quota status batches, fetching the quota usage of each account")
+		s.quotaBatchUnsupported.Store(true)
+		return s.getQuotaUsageOneByOne(accountIDs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var quotaResps []QuotaResponseBody
+	if err = json.Unmarshal(resp, &quotaResps); err != nil {
+		return nil, fmt.Errorf("could not deserialize '%s' response into quota responses: %v", string(resp), err)
+	}
+
+	quotas := make(map[string]*QuotaResponseBody, len(quotaResps))
+	for i := range quotaResps {
+		quotas[quotaResps[i].AccountID] = &quotaResps[i]
+	}
+
+	var missing []string
+	for _, accountID := range accountIDs {
+		if _, ok := quotas[accountID]; !ok {
+			missing = append(missing, accountID)
+		}
+	}
+	if len(missing) > 0 {
+		return quotas, fmt.Errorf("quota usage not returned for accounts %v", strings.Join(missing, ", "))
+	}
+	return quotas, nil
+}
+
+// getQuotaUsageOneByOne fetches the quota usage of each account with GetQuotaUsage, keyed by account ID.
+// The quotas which could be fetched are accompanied by an error listing the accounts which failed
+// or whose quota usage the SDN did not return.
+func (s *realSDNHTTP) getQuotaUsageOneByOne(accountIDs []string) (map[string]*QuotaResponseBody, error) {
+	quotas := make(map[string]*QuotaResponseBody, len(accountIDs))
+	var errs []error
+	var missing []string
+	for _, accountID := range accountIDs {
+		quota, err := s.GetQuotaUsage(accountID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not get quota usage of account %v: %w", accountID, err))
+			continue
+		}
+		// GetQuotaUsage returns the SDN response of an unknown account, e.g. an error message, without an error
+		if quota.AccountID != accountID {
+			missing = append(missing, accountID)
+			continue
+		}
+		quotas[accountID] = quota
+	}
+	if len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("quota usage not returned for accounts %v", strings.Join(missing, ", ")))
+	}
+	return quotas, errors.Join(errs...)
+}
+
+// getAccountModelWithEndpoint fetches the account model of accountID from endpoint. If useCache is set the response
+// is cached and served from the cache file as the cache policy of the endpoint allows, otherwise it is never cached.
+func (s *realSDNHTTP) getAccountModelWithEndpoint(accountID types.AccountID, endpoint string, useCache bool) (message.Account, error) {
 	url := fmt.Sprintf("%v/%v/%v", s.sdnURL, endpoint, accountID)
 	accountModel := message.Account{}
-	// for accounts endpoint we do no want to use the cache file.
+	// by default the accounts endpoint does not use the cache file.
 	// in case of SDN error, we set default enterprise account for the customer
+	if endpoint != string(CacheEndpointAccounts) && endpoint != string(CacheEndpointAccount) {
+		log.Panicf("getAccountModelWithEndpoint called with unsuppored endpoint %v", endpoint)
+	}
 	var resp []byte
 	var err error
-	switch endpoint {
-	case "accounts":
+	if useCache {
+		cacheFileName := accountCacheFileName(CacheEndpoint(endpoint), accountID)
+		resp, err = s.httpWithCachePolicy(CacheEndpoint(endpoint), url, http.MethodGet, cacheFileName, nil)
+	} else {
 		resp, err = s.http(url, http.MethodGet, nil)
-	case "account":
-		resp, err = s.httpWithCache(url, http.MethodGet, accountModelsFileName, nil)
-	default:
-		log.Panicf("getAccountModelWithEndpoint called with unsuppored endpoint %v", endpoint)
 	}
 
 	if err != nil {
@@ -619,10 +2007,34 @@ func (s *realSDNHTTP) getAccountModelWithEndpoint(accountID types.AccountID, end
 	}
 
 	if err = json.Unmarshal(resp, &accountModel); err != nil {
-		return accountModel, fmt.Errorf("could not deserialize '%s' response into account model: %v", string(resp), err)
+		return accountModel, fmt.Errorf("could not deserialize '%s' response into account model: %v", message.RedactAccountJSON(resp), err)
 	}
 
-	return s.fillInAccountDefaults(&accountModel, time.Now().UTC())
+	now := s.timeSource().Now().UTC()
+	account, err := s.fillInAccountDefaults(&accountModel, now)
+	if err == nil {
+		logExpiredAccountLimits(account, now)
+	}
+	return account, err
+}
+
+// logExpiredAccountLimits warns if the account or its relay limit has expired
+func logExpiredAccountLimits(account message.Account, now time.Time) {
+	expireDates := []struct{ name, expireDate string }{
+		{"account", account.ExpireDate},
+		{"relay limit", account.RelayLimit.ExpireDateTime.Format(types.TimeDateLayoutISO)},
+	}
+	for _, limit := range expireDates {
+		name, expireDate := limit.name, limit.expireDate
+		expired, err := types.IsExpired(expireDate, now)
+		if err != nil {
+			log.Debugf("could not check the %v expiry of account %v: %v", name, account.AccountID, err)
+			continue
+		}
+		if expired {
+			log.Warnf("the %v of account %v expired on %v", name, account.AccountID, expireDate)
+		}
+	}
 }
 
 func (s *realSDNHTTP) fillInAccountDefaults(accountModel *message.Account, now time.Time) (message.Account, error) {
@@ -636,31 +2048,79 @@ func (s *realSDNHTTP) fillInAccountDefaults(accountModel *message.Account, now t
 	return mappedAccountModel, err
 }
 
+// getAccountModel loads the account model of accountID as the account model of the node.
+// The account model is kept if the fetch fails, so AccountModelLoaded is false until the first successful fetch.
 func (s *realSDNHTTP) getAccountModel(accountID types.AccountID) error {
-	accountModel, err := s.getAccountModelWithEndpoint(accountID, "account")
+	accountModel, err := s.fetchNodeAccountModel(accountID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.accountModel = &accountModel
+	s.mu.Unlock()
+	return nil
+}
+
+// RefreshAccountModel re-fetches the account model of the node from the SDN and replaces the account model,
+// e.g. when the quota is exhausted and the limits may have been raised. The account model is kept if the fetch fails.
+func (s *realSDNHTTP) RefreshAccountModel() (message.Account, error) {
+	accountModel, err := s.fetchNodeAccountModel(s.NodeModel().AccountID)
+	if err != nil {
+		return message.Account{}, err
+	}
+
+	s.mu.Lock()
 	s.accountModel = &accountModel
-	if s.accountModel.RelayLimit.MsgQuota.Limit == 0 {
+	s.mu.Unlock()
+	return accountModel, nil
+}
+
+// GetAccountModel fetches the account model of accountID from the SDN with the same defaults and limit fixups
+// as the account model of the node, without replacing it, e.g. to compare the live account model with the SDN.
+// The response is neither cached nor served from the cache files.
+func (s *realSDNHTTP) GetAccountModel(accountID types.AccountID) (message.Account, error) {
+	return s.fetchAccountModel(accountID, false)
+}
+
+// fetchNodeAccountModel fetches the account model of the node like GetAccountModel,
+// caching the response as the cache policy of CacheEndpointAccount allows
+func (s *realSDNHTTP) fetchNodeAccountModel(accountID types.AccountID) (message.Account, error) {
+	return s.fetchAccountModel(accountID, true)
+}
+
+// fetchAccountModel fetches the account model of accountID from the account endpoint and fixes its limits
+func (s *realSDNHTTP) fetchAccountModel(accountID types.AccountID, useCache bool) (message.Account, error) {
+	accountModel, err := s.getAccountModelWithEndpoint(accountID, string(CacheEndpointAccount), useCache)
+	if err != nil {
+		return message.Account{}, err
+	}
+	fixAccountLimits(&accountModel)
+	return accountModel, nil
+}
+
+// fixAccountLimits sets the relay limit and max allowed nodes limit of an account model to their defaults if they are zero
+func fixAccountLimits(accountModel *message.Account) {
+	if accountModel.RelayLimit.MsgQuota.Limit == 0 {
 		log.Warnf("relay limit was set to 0, setting to 1")
-		s.accountModel.RelayLimit.MsgQuota.Limit = 1
+		accountModel.RelayLimit.MsgQuota.Limit = 1
 	}
 
-	if s.accountModel.MaxAllowedNodes.MsgQuota.Limit == 0 {
+	if accountModel.MaxAllowedNodes.MsgQuota.Limit == 0 {
 		log.Warnf("relay max allowed nodes limit was set to 0, setting to 6")
-		s.accountModel.MaxAllowedNodes.MsgQuota.Limit = 6
+		accountModel.MaxAllowedNodes.MsgQuota.Limit = 6
 	}
-
-	return err
 }
 
 // FetchCustomerAccountModel get customer account model
 func (s *realSDNHTTP) FetchCustomerAccountModel(accountID types.AccountID) (message.Account, error) {
-	return s.getAccountModelWithEndpoint(accountID, "accounts")
+	return s.getAccountModelWithEndpoint(accountID, string(CacheEndpointAccounts), true)
 }
 
 // getRelays gets the potential relays for a gateway
 func (s *realSDNHTTP) getRelays(nodeID types.NodeID, networkNum types.NetworkNum) (message.Peers, error) {
-	url := fmt.Sprintf("%v/nodes/%v/%v/potential-relays", s.sdnURL, nodeID, networkNum)
-	resp, err := s.httpWithCache(url, http.MethodGet, potentialRelaysFileName, nil)
+	url := fmt.Sprintf("%v/nodes/%v/%d/potential-relays", s.sdnURL, nodeID, networkNum)
+	resp, err := s.httpWithCachePolicy(CacheEndpointPotentialRelays, url, http.MethodGet, networkCacheFileName(potentialRelaysFileName, networkNum), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -671,191 +2131,743 @@ func (s *realSDNHTTP) getRelays(nodeID types.NodeID, networkNum types.NetworkNum
 	return relays, nil
 }
 
+// cacheEnabled returns whether the responses of endpoint are cached according to the cache policy
+func (s *realSDNHTTP) cacheEnabled(endpoint CacheEndpoint) bool {
+	if enabled, ok := s.cachePolicy[endpoint]; ok {
+		return enabled
+	}
+	return defaultCachePolicy[endpoint]
+}
+
+// httpWithCachePolicy sends the request with httpWithCache if the responses of endpoint are cached, otherwise with http
+func (s *realSDNHTTP) httpWithCachePolicy(endpoint CacheEndpoint, uri string, method string, fileName string, body io.Reader) ([]byte, error) {
+	if !s.cacheEnabled(endpoint) {
+		return s.http(uri, method, body)
+	}
+	return s.httpWithCache(uri, method, fileName, body)
+}
+
 func (s *realSDNHTTP) httpWithCache(uri string, method string, fileName string, body io.Reader) ([]byte, error) {
-	var err error
 	data, httpErr := s.http(uri, method, body)
 	if httpErr != nil {
-		if errors.Is(httpErr, ErrSDNUnavailable) {
-			// we can't get the data from http - try to read from cache file
-			data, err = LoadCacheFile(s.dataDir, fileName)
-			if err != nil {
-				return nil, fmt.Errorf("got error from http request: %v and can't load cache file %v: %v", httpErr, fileName, err)
-			}
-			// we managed to read the data from cache file - issue a warning
-			log.Warnf("got error from http request: %v but loaded cache file %v", httpErr, fileName)
-			return data, nil
-		}
+		return s.loadCacheFallback(httpErr, fileName)
+	}
+	s.updateCache(fileName, data)
+	return data, nil
+}
+
+// loadCacheFallback returns the cached response in fileName if httpErr reports that the SDN is unavailable,
+// otherwise httpErr
+func (s *realSDNHTTP) loadCacheFallback(httpErr error, fileName string) ([]byte, error) {
+	if !errors.Is(httpErr, ErrSDNUnavailable) {
 		return nil, httpErr
 	}
+	// we can't get the data from http - try to read from cache file
+	envelope, err := loadCacheFileEnvelope(s.cacheFileSystem(), s.dataDir, fileName)
+	if errors.Is(err, ErrCorruptCacheFile) || errors.Is(err, ErrIncompatibleCacheFile) {
+		// the cache file is skipped as if there was none
+		log.Warnf("got error from http request: %v and ignoring the cache file %v: %v", httpErr, fileName, err)
+		return nil, httpErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("got error from http request: %w and can't load cache file %v: %v", httpErr, fileName, err)
+	}
+	// we managed to read the data from cache file - issue a warning
+	log.Warnf("got error from http request: %v but loaded cache file %v saved at %v", httpErr, fileName, envelope.SavedAt)
+	s.cachedResponses.Store(fileName, struct{}{})
+	return envelope.Payload, nil
+}
 
-	err = UpdateCacheFile(s.dataDir, fileName, data)
+// updateCache stores the SDN response data in the cache file fileName
+func (s *realSDNHTTP) updateCache(fileName string, data []byte) {
+	s.cachedResponses.Delete(fileName)
+	dataDirMode := s.dataDirMode
+	if dataDirMode == 0 {
+		dataDirMode = DefaultDataDirMode
+	}
+	err := UpdateCacheFileFS(s.cacheFileSystem(), s.dataDir, fileName, data, dataDirMode)
 	if err != nil {
 		log.Warnf("can not update cache file %v with data %s. error %v", fileName, data, err)
 	}
-	return data, nil
 }
 
+// ResponsesFromCache returns the sorted names of the cache files which served the last response of their SDN request,
+// e.g. potentialrelays_5.json, because the SDN was unavailable. It is empty while the SDN data is live,
+// so a gateway can surface a degraded status to operators while it is not.
+func (s *realSDNHTTP) ResponsesFromCache() []string {
+	var fileNames []string
+	s.cachedResponses.Range(func(key, _ any) bool {
+		fileNames = append(fileNames, key.(string))
+		return true
+	})
+	sort.Strings(fileNames)
+	return fileNames
+}
+
+// cacheFileSystem returns the storage of the cache files, the OS filesystem by default
+func (s *realSDNHTTP) cacheFileSystem() CacheFS {
+	if s.cacheFS == nil {
+		return OSCacheFS
+	}
+	return s.cacheFS
+}
+
+// http sends a request to uri. If fallback SDN URLs are configured and uri is an SDN URL, the request is sent
+// to the healthy SDN URL first, and to the next SDN URLs in order if an SDN does not respond or fails with a 5xx.
 func (s *realSDNHTTP) http(uri string, method string, body io.Reader) ([]byte, error) {
+	return s.httpContext(s.clientContext(), uri, method, body)
+}
+
+// httpContext sends a request to uri like http, stopping when ctx is done
+func (s *realSDNHTTP) httpContext(ctx context.Context, uri string, method string, body io.Reader) ([]byte, error) {
+	var data []byte
+	err := s.withSDNFailover(ctx, uri, body, func(uri string, body io.Reader) (statusCode int, err error) {
+		data, statusCode, err = s.httpOnce(ctx, uri, method, body)
+		return statusCode, err
+	})
+	return data, err
+}
+
+// httpStream sends a request to uri like http, but returns the decoded response body for the caller to read,
+// so large responses can be decoded without buffering them. The caller must close the returned body.
+func (s *realSDNHTTP) httpStream(uri string, method string, body io.Reader) (io.ReadCloser, error) {
+	var respBody io.ReadCloser
+	ctx := s.clientContext()
+	err := s.withSDNFailover(ctx, uri, body, func(uri string, body io.Reader) (statusCode int, err error) {
+		respBody, statusCode, err = s.httpStreamOnce(ctx, uri, method, body)
+		return statusCode, err
+	})
+	return respBody, err
+}
+
+// withSDNFailover calls send with uri, or if fallback SDN URLs are configured and uri is an SDN URL, with uri
+// on the healthy SDN URL first and on the next SDN URLs in order while an SDN does not respond or fails with a 5xx,
+// until ctx is done
+func (s *realSDNHTTP) withSDNFailover(ctx context.Context, uri string, body io.Reader, send func(uri string, body io.Reader) (int, error)) error {
+	sdnURLs := s.sdnURLs()
+	endpoint, ok := s.trimSDNURL(uri)
+	if !ok || len(sdnURLs) == 1 {
+		_, err := send(uri, body)
+		return err
+	}
+
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		if bodyBytes, err = io.ReadAll(body); err != nil {
+			return err
+		}
+	}
+
+	healthy := int(s.healthySDNURL.Load())
+	var err, unavailableErr error
+	for i := range sdnURLs {
+		index := (healthy + i) % len(sdnURLs)
+		var attemptBody io.Reader
+		if body != nil {
+			attemptBody = bytes.NewReader(bodyBytes)
+		}
+		var statusCode int
+		statusCode, err = send(sdnURLs[index]+endpoint, attemptBody)
+		if err == nil {
+			if index != healthy {
+				log.Infof("switching to SDN at %v", sdnURLs[index])
+				s.healthySDNURL.Store(int32(index))
+			}
+			return nil
+		}
+		if statusCode != 0 && statusCode < http.StatusInternalServerError || ctx.Err() != nil {
+			return err
+		}
+		if errors.Is(err, ErrSDNUnavailable) {
+			unavailableErr = err
+		}
+		if i < len(sdnURLs)-1 {
+			log.Warnf("request to SDN at %v failed: %v, trying SDN at %v", sdnURLs[index], err, sdnURLs[(index+1)%len(sdnURLs)])
+		}
+	}
+	if unavailableErr != nil {
+		// the cached response is used if an SDN reported it is unavailable
+		return unavailableErr
+	}
+	return err
+}
+
+// sdnURLs returns the SDN URL followed by the fallback SDN URLs
+func (s *realSDNHTTP) sdnURLs() []string {
+	return append([]string{s.sdnURL}, s.fallbackSDNURLs...)
+}
+
+// currentSDNURL returns the SDN URL which served the last successful request
+func (s *realSDNHTTP) currentSDNURL() string {
+	sdnURLs := s.sdnURLs()
+	return sdnURLs[int(s.healthySDNURL.Load())%len(sdnURLs)]
+}
+
+// trimSDNURL returns uri without its SDN URL, and whether uri is on one of the SDN URLs, i.e. it is an SDN URL
+// or continues it with a path, query or fragment. The longest matching SDN URL is trimmed, so an SDN URL
+// is not mistaken for another one it starts with, e.g. https://sdn.example.com for https://sdn.example.com.au.
+func (s *realSDNHTTP) trimSDNURL(uri string) (string, bool) {
+	matched := ""
+	for _, sdnURL := range s.sdnURLs() {
+		if sdnURL == "" || len(sdnURL) <= len(matched) || !strings.HasPrefix(uri, sdnURL) {
+			continue
+		}
+		rest := uri[len(sdnURL):]
+		if rest == "" || strings.HasSuffix(sdnURL, "/") || strings.ContainsAny(rest[:1], "/?#") {
+			matched = sdnURL
+		}
+	}
+	if matched == "" {
+		return uri, false
+	}
+	return uri[len(matched):], true
+}
+
+// setRequestHeaders sets the User-Agent and a new request ID on an SDN request, returning the request ID
+func (s *realSDNHTTP) setRequestHeaders(req *http.Request) string {
+	requestID := uuid.NewString()
+	req.Header.Set("User-Agent", s.userAgent())
+	req.Header.Set(RequestIDHeader, requestID)
+	return requestID
+}
+
+// userAgent returns the User-Agent of SDN requests, e.g. "bxcommon-go/2.1.0 (EXTERNAL_GATEWAY)"
+func (s *realSDNHTTP) userAgent() string {
+	prefix := s.userAgentPrefix
+	if prefix == "" {
+		prefix = DefaultUserAgentPrefix
+	}
+	var sourceVersion, nodeType string
+	if nodeModel := s.NodeModel(); nodeModel != nil {
+		sourceVersion = nodeModel.SourceVersion
+		nodeType = nodeModel.NodeType
+	}
+
+	userAgent := prefix
+	if sourceVersion != "" {
+		userAgent += "/" + sourceVersion
+	}
+	if nodeType != "" {
+		userAgent += " (" + nodeType + ")"
+	}
+	return userAgent
+}
+
+// httpOnce sends a single request to uri, returning the response status code if a response was received
+func (s *realSDNHTTP) httpOnce(ctx context.Context, uri string, method string, body io.Reader) (_ []byte, statusCode int, err error) {
+	start := time.Now()
+	defer func() { s.observeRequest(uri, method, statusCode, start, err) }()
+
+	resp, statusCode, err := s.send(ctx, uri, method, body)
+	if err != nil {
+		return nil, statusCode, err
+	}
+	defer s.close(resp)
+
+	b, errMsg := s.readBody(resp)
+	if errMsg != nil {
+		return nil, statusCode, fmt.Errorf("%v on %v could not read response %v, error %w", method, uri, resp.Status, errMsg)
+	}
+	return b, statusCode, nil
+}
+
+// httpStreamOnce sends a single request to uri like httpOnce, but returns the decoded response body
+func (s *realSDNHTTP) httpStreamOnce(ctx context.Context, uri string, method string, body io.Reader) (_ io.ReadCloser, statusCode int, err error) {
+	start := time.Now()
+	defer func() { s.observeRequest(uri, method, statusCode, start, err) }()
+
+	resp, statusCode, err := s.send(ctx, uri, method, body)
+	if err != nil {
+		return nil, statusCode, err
+	}
+	respBody, err := s.decodedBody(resp)
+	if err != nil {
+		s.close(resp)
+		return nil, statusCode, fmt.Errorf("%v on %v could not read response %v, error %w", method, uri, resp.Status, err)
+	}
+	return respBody, statusCode, nil
+}
+
+// send sends a single request to uri and returns the response if its status is 200 OK,
+// ErrSDNUnavailable if it is 503 Service Unavailable, or a StatusError for any other status
+func (s *realSDNHTTP) send(ctx context.Context, uri string, method string, body io.Reader) (_ *http.Response, _ int, err error) {
 	client, err := s.httpClient()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, uri, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
 	}
-	var resp *http.Response
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	requestID := s.setRequestHeaders(req)
+	// the callers report the error, the request ID is logged to correlate it with the SDN logs
 	defer func() {
-		if resp != nil {
-			s.close(resp)
+		if err != nil && !errors.Is(err, ErrSDNUnavailable) {
+			log.Debugf("%v request %v to %v failed: %v", method, requestID, uri, err)
 		}
 	}()
-	switch method {
-	case http.MethodGet:
-		resp, err = client.Get(uri)
-	case http.MethodPost:
-		resp, err = client.Post(uri, "application/json", body)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	statusCode := resp.StatusCode
+	if resp.StatusCode == 200 {
+		return resp, statusCode, nil
+	}
+	defer s.close(resp)
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		log.Debugf("got error from http request %v: SDN is down", requestID)
+		return nil, statusCode, s.unavailableError(resp)
 	}
+	statusErr := &StatusError{Method: method, URL: uri, StatusCode: statusCode}
+	if resp.Body != nil {
+		b, errMsg := s.readBody(resp)
+		if errMsg != nil {
+			statusErr.Err = fmt.Errorf("%v on %v could not read response %v, error %w", method, uri, resp.Status, errMsg)
+			return nil, statusCode, statusErr
+		}
+		var errorMessage message.ErrorMessage
+		if err = json.Unmarshal(b, &errorMessage); err != nil {
+			statusErr.Err = fmt.Errorf("could not deserialize '%s' response into error message: %v", string(b), err)
+			return nil, statusCode, statusErr
+		}
+		statusErr.Details = errorMessage.Details
+		statusErr.Err = fmt.Errorf("%v to %v received a [%v]: %v", method, uri, resp.Status, errorMessage.Details)
+	} else {
+		statusErr.Err = fmt.Errorf("%v on %v recv and error %v", method, uri, resp.Status)
+	}
+	return nil, statusCode, statusErr
+}
+
+// observeRequest reports the outcome of an SDN request to the request observer, if any
+func (s *realSDNHTTP) observeRequest(uri string, method string, statusCode int, start time.Time, err error) {
+	if s.requestObserver == nil {
+		return
+	}
+	endpoint, _ := s.trimSDNURL(uri)
+	s.requestObserver(RequestOutcome{
+		Endpoint:   endpoint,
+		Method:     method,
+		StatusCode: statusCode,
+		Duration:   time.Since(start),
+		Err:        err,
+	})
+}
+
+// readBody reads the response body, decoding it according to its Content-Encoding
+func (s *realSDNHTTP) readBody(resp *http.Response) ([]byte, error) {
+	body, err := s.decodedBody(resp)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != 200 {
-		if resp.StatusCode == http.StatusServiceUnavailable {
-			log.Debugf("got error from http request: SDN is down")
-			return nil, ErrSDNUnavailable
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// decodedBody returns the response body decoded according to its Content-Encoding, which closes the response body.
+// The body and the decompressed body fail with ErrResponseTooLarge after their max size.
+func (s *realSDNHTTP) decodedBody(resp *http.Response) (io.ReadCloser, error) {
+	maxResponseSize := s.maxResponseSize
+	if maxResponseSize <= 0 {
+		maxResponseSize = defaultMaxResponseSize
+	}
+	body := newLimitedBody(resp.Body, resp.Body.Close, "response", maxResponseSize)
+
+	var decoder io.ReadCloser
+	var err error
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		if decoder, err = gzip.NewReader(body); err != nil {
+			return nil, fmt.Errorf("could not decode gzip response: %w", err)
 		}
-		if resp.Body != nil {
-			b, errMsg := io.ReadAll(resp.Body)
-			if errMsg != nil {
-				return nil, fmt.Errorf("%v on %v could not read response %v, error %v", method, uri, resp.Status, errMsg.Error())
-			}
-			var errorMessage message.ErrorMessage
-			if err = json.Unmarshal(b, &errorMessage); err != nil {
-				return nil, fmt.Errorf("could not deserialize '%s' response into error message: %v", string(b), err)
-			}
-			err = fmt.Errorf("%v to %v received a [%v]: %v", method, uri, resp.Status, errorMessage.Details)
-		} else {
-			err = fmt.Errorf("%v on %v recv and error %v", method, uri, resp.Status)
+	case "deflate":
+		if decoder, err = zlib.NewReader(body); err != nil {
+			return nil, fmt.Errorf("could not decode deflate response: %w", err)
 		}
-		return nil, err
+	default:
+		return body, nil
 	}
 
-	b, errMsg := io.ReadAll(resp.Body)
-	if errMsg != nil {
-		return nil, fmt.Errorf("%v on %v could not read response %v, error %v", method, uri, resp.Status, errMsg.Error())
+	maxSize := s.maxDecompressedSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxDecompressedSize
+	}
+	closeBody := func() error {
+		// closing the decoder only reports the error of the last read, e.g. a too large response
+		_ = decoder.Close()
+		return body.Close()
+	}
+	return newLimitedBody(decoder, closeBody, "decompressed response", maxSize), nil
+}
+
+// limitedBody reads a response body, failing with ErrResponseTooLarge after maxSize bytes
+type limitedBody struct {
+	reader    io.Reader
+	close     func() error
+	name      string
+	maxSize   int64
+	remaining int64
+}
+
+func newLimitedBody(reader io.Reader, close func() error, name string, maxSize int64) *limitedBody {
+	return &limitedBody{reader: reader, close: close, name: name, maxSize: maxSize, remaining: maxSize}
+}
 
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.tooLarge()
+	}
+	// read one byte more than allowed to detect a response exceeding the max size
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
 	}
-	return b, nil
+	n, err := l.reader.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), l.tooLarge()
+	}
+	return n, err
+}
+
+func (l *limitedBody) tooLarge() error {
+	return fmt.Errorf("%w: %v is larger than %v bytes", ErrResponseTooLarge, l.name, l.maxSize)
+}
+
+func (l *limitedBody) Close() error {
+	return l.close()
 }
 
 func (s *realSDNHTTP) getBlockchainNetworks() error {
 	url := fmt.Sprintf("%v/blockchain-networks", s.sdnURL)
-	resp, err := s.httpWithCache(url, http.MethodGet, blockchainNetworksCacheFileName, nil)
-	if err != nil {
-		return err
-	}
 	var networks []*message.BlockchainNetwork
-	if err = json.Unmarshal(resp, &networks); err != nil {
-		return fmt.Errorf("could not deserialize '%s' response into blockchain networks: %v", string(resp), err)
+	cacheEnabled := s.cacheEnabled(CacheEndpointBlockchainNetworks)
+	respBody, httpErr := s.httpStream(url, http.MethodGet, nil)
+	if httpErr != nil && !cacheEnabled {
+		return httpErr
+	}
+	if httpErr != nil {
+		resp, err := s.loadCacheFallback(httpErr, blockchainNetworksCacheFileName)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(resp, &networks); err != nil {
+			return fmt.Errorf("could not deserialize '%s' response into blockchain networks: %v", truncatedBody(resp), err)
+		}
+	} else if cacheEnabled {
+		// the raw response is written to the cache file, so it is read in full
+		defer respBody.Close()
+		resp, err := io.ReadAll(respBody)
+		if err != nil {
+			return fmt.Errorf("could not read blockchain networks response: %w", err)
+		}
+		if err = json.Unmarshal(resp, &networks); err != nil {
+			return fmt.Errorf("could not deserialize '%s' response into blockchain networks: %v", truncatedBody(resp), err)
+		}
+		s.updateCache(blockchainNetworksCacheFileName, resp)
+	} else {
+		// the response is decoded while it is read, without buffering it
+		defer respBody.Close()
+		if err := json.NewDecoder(respBody).Decode(&networks); err != nil {
+			return fmt.Errorf("could not deserialize response into blockchain networks: %v", err)
+		}
 	}
-	s.networks = message.BlockchainNetworks{}
+	blockchainNetworks := message.BlockchainNetworks{}
 	for _, network := range networks {
-		s.networks[network.NetworkNum] = network
+		if network == nil {
+			continue
+		}
+		if err := network.ApplyDefaults(); err != nil {
+			log.Errorf("ignoring invalid blockchain network %v: %v", network.NetworkNum, err)
+			continue
+		}
+		blockchainNetworks[network.NetworkNum] = network
+	}
+
+	blockchainNetworks.Each(func(networkNum types.NetworkNum, network *message.BlockchainNetwork) {
+		log.Debugf("fetched blockchain network %v: %v %v", networkNum, network.Protocol, network.Network)
+	})
+
+	s.mu.RLock()
+	diff := s.networks.Diff(blockchainNetworks)
+	s.mu.RUnlock()
+	s.SetNetworks(blockchainNetworks)
+
+	if !diff.IsEmpty() {
+		log.Debugf("blockchain networks refreshed, added %v, removed %v, changed %v", diff.Added, diff.Removed, diff.Changed)
+		if s.networksChangeHandler != nil {
+			s.networksChangeHandler(diff)
+		}
 	}
 	return nil
 }
 
 // FindNetwork finds a BlockchainNetwork instance by its number and allow update
 func (s *realSDNHTTP) FindNetwork(networkNum types.NetworkNum) (*message.BlockchainNetwork, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.networks.FindNetwork(networkNum)
 }
 
 // MinTxAge returns MinTxAge for the current blockchain number the node model registered
 func (s *realSDNHTTP) MinTxAge() time.Duration {
-	blockchainNetwork, err := s.FindNetwork(s.NetworkNum())
+	minTxAge, err := s.MinTxAgeForNetwork(s.NetworkNum())
 	if err != nil {
 		log.Warnf("could not get blockchainNetwork: %v, returning default 2 seconds for MinTxAgeSecond", err)
 		return 2 * time.Second
 	}
-	return time.Duration(float64(time.Second) * blockchainNetwork.MinTxAgeSeconds)
+	return minTxAge
+}
+
+// MinTxAgeForNetwork returns MinTxAge for the given blockchain network number
+func (s *realSDNHTTP) MinTxAgeForNetwork(networkNum types.NetworkNum) (time.Duration, error) {
+	blockchainNetwork, err := s.FindNetwork(networkNum)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(float64(time.Second) * blockchainNetwork.MinTxAgeSeconds), nil
 }
 
-// getPingLatencies pings list of SDN peers and returns sorted list of nodeLatencyInfo for each successful peer ping
-func getPingLatencies(peers message.Peers) []nodeLatencyInfo {
+// pingRelays pings the relays and exports the results to the latency sink if one is configured.
+// Relays which did not respond within the ping relays timeout or before ctx is done have the PingTimeout latency.
+func (s *realSDNHTTP) pingRelays(ctx context.Context, relays message.Peers) []nodeLatencyInfo {
+	timeout := s.pingRelaysTimeout
+	if timeout <= 0 {
+		// the ping packets are sent one second apart
+		timeout = defaultPingRelaysTimeout + time.Duration(max(s.pingCount, 1)-1)*time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	pingLatencies := s.getPingLatencies(ctx, relays)
+	sortByLatency(pingLatencies)
+	if s.latencySink != nil {
+		now := s.timeSource().Now()
+		for _, pingLatency := range pingLatencies {
+			s.latencySink(LatencySample{
+				IP:        pingLatency.IP,
+				Port:      pingLatency.Port,
+				Latency:   pingLatency.Latency,
+				Timestamp: now,
+				Reachable: pingLatency.Latency < PingTimeout,
+			})
+		}
+	}
+	if s.excludeUnreachableRelays {
+		return reachableRelays(pingLatencies)
+	}
+	return pingLatencies
+}
+
+// sortByLatency orders the relays by ascending latency, and relays with the same latency by IP and port,
+// so relays tying on latency are chosen in the same order every polling cycle instead of flapping
+func sortByLatency(pingLatencies []nodeLatencyInfo) {
+	sort.Slice(pingLatencies, func(i, j int) bool {
+		if pingLatencies[i].Latency != pingLatencies[j].Latency {
+			return pingLatencies[i].Latency < pingLatencies[j].Latency
+		}
+		if pingLatencies[i].IP != pingLatencies[j].IP {
+			return pingLatencies[i].IP < pingLatencies[j].IP
+		}
+		return pingLatencies[i].Port < pingLatencies[j].Port
+	})
+}
+
+// latencyMeasured returns whether any of the pinged relays answered the ping
+func latencyMeasured(pingLatencies []nodeLatencyInfo) bool {
+	for _, pingLatency := range pingLatencies {
+		if pingLatency.Latency < PingTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// reachableRelays returns the relays which answered the ping, keeping their order
+func reachableRelays(pingLatencies []nodeLatencyInfo) []nodeLatencyInfo {
+	reachable := make([]nodeLatencyInfo, 0, len(pingLatencies))
+	for _, pingLatency := range pingLatencies {
+		if pingLatency.Latency < PingTimeout {
+			reachable = append(reachable, pingLatency)
+		} else {
+			log.Debugf("excluding relay %v:%v which did not answer the ping", pingLatency.IP, pingLatency.Port)
+		}
+	}
+	return reachable
+}
+
+// getPingLatencies pings list of SDN peers and returns sorted list of nodeLatencyInfo for each successful peer ping.
+// Each peer is pinged with a single packet.
+func getPingLatencies(ctx context.Context, peers message.Peers) []nodeLatencyInfo {
+	return getPingLatenciesWithCount(ctx, peers, 1)
+}
+
+// getPingLatenciesWithCount pings each of the SDN peers with count packets and returns the sorted list of
+// nodeLatencyInfo with the average latency and the packet loss of each peer
+func getPingLatenciesWithCount(ctx context.Context, peers message.Peers, count int) []nodeLatencyInfo {
 	potentialRelaysCount := len(peers)
 	pingResults := make([]nodeLatencyInfo, potentialRelaysCount)
-	var wg sync.WaitGroup
-	wg.Add(potentialRelaysCount)
+	type pingLatency struct {
+		index      int
+		latency    float64
+		packetLoss float64
+	}
+	latencies := make(chan pingLatency, potentialRelaysCount)
 
 	for peerCount, peer := range peers {
-		pingResults[peerCount] = nodeLatencyInfo{peer.IP, peer.Port, PingTimeout}
-		go func(pingResult *nodeLatencyInfo) {
-			defer wg.Done()
-			cmd := exec.Command("ping", (*pingResult).IP, "-c1", "-W2")
+		pingResults[peerCount] = nodeLatencyInfo{
+			IP:         peer.IP,
+			Port:       peer.Port,
+			Latency:    PingTimeout,
+			PacketLoss: 100,
+			Continent:  peer.Attributes.Continent,
+			Country:    peer.Attributes.Country,
+			Region:     peer.Attributes.Region,
+		}
+		go func(index int, ip string) {
+			result := pingLatency{index: index, latency: PingTimeout, packetLoss: 100}
+			defer func() { latencies <- result }()
+			cmd := exec.CommandContext(ctx, "ping", ip, fmt.Sprintf("-c%d", count), "-W2")
 			var out bytes.Buffer
 			var stderr bytes.Buffer
 			cmd.Stdout = &out
 			cmd.Stderr = &stderr
 			if err := cmd.Run(); err != nil {
-				log.Errorf("error executing (%v) %v: %v", cmd, err, stderr)
+				if ctx.Err() == nil {
+					log.Errorf("error executing (%v) %v: %v", cmd, err, stderr)
+				}
 				return
 			}
-			log.Tracef("ping results from %v: %q", (*pingResult).IP, out)
-			re := regexp.MustCompile(TimeRegEx)
-			latencyTimeList := re.FindStringSubmatch(out.String())
-			if len(latencyTimeList) > 0 {
-				latencyTime, _ := strconv.ParseFloat(latencyTimeList[1], 64)
-				if latencyTime > 0 {
-					(*pingResult).Latency = latencyTime
-				}
+			log.Tracef("ping results from %v: %q", ip, out)
+			if latency, packetLoss, ok := parsePingOutput(out.String()); ok {
+				result.latency, result.packetLoss = latency, packetLoss
 			}
-		}(&pingResults[peerCount])
+		}(peerCount, peer.IP)
+	}
+
+collectLatencies:
+	for received := 0; received < potentialRelaysCount; received++ {
+		select {
+		case result := <-latencies:
+			pingResults[result.index].Latency = result.latency
+			pingResults[result.index].PacketLoss = result.packetLoss
+		case <-ctx.Done():
+			log.Warnf("pinging potential relays timed out after %v of %v responses: %v", received, potentialRelaysCount, ctx.Err())
+			break collectLatencies
+		}
 	}
-	wg.Wait()
 
-	sort.Slice(pingResults, func(i int, j int) bool { return pingResults[i].Latency < pingResults[j].Latency })
+	sortByLatency(pingResults)
 	log.Infof("latency results for potential relays: %v", pingResults)
 	return pingResults
 }
 
-// SendNodeEvent sends node event to SDN through http
+var (
+	pingAverageRegEx    = regexp.MustCompile(`= [^/]*/([^/]*)/`)
+	pingPacketLossRegEx = regexp.MustCompile(`([0-9.]+)% packet loss`)
+)
+
+// parsePingOutput extracts the average latency (ms) and the packet loss (%) from the output of ping.
+// It returns false if no latency was found, e.g. because no packet was answered.
+func parsePingOutput(output string) (float64, float64, bool) {
+	var latency float64
+	if average := pingAverageRegEx.FindStringSubmatch(output); len(average) > 1 {
+		latency, _ = strconv.ParseFloat(average[1], 64)
+	} else if minimum := regexp.MustCompile(TimeRegEx).FindStringSubmatch(output); len(minimum) > 1 {
+		latency, _ = strconv.ParseFloat(minimum[1], 64)
+	}
+	if latency <= 0 {
+		return 0, 0, false
+	}
+	var packetLoss float64
+	if loss := pingPacketLossRegEx.FindStringSubmatch(output); len(loss) > 1 {
+		packetLoss, _ = strconv.ParseFloat(loss[1], 64)
+	}
+	return latency, packetLoss, true
+}
+
+// SendNodeEvent sends node event to SDN through http. Errors are logged, use SendNodeEventSync
+// for events whose delivery must be confirmed. Events of an unknown type are sent with a warning.
 func (s *realSDNHTTP) SendNodeEvent(event message.NodeEvent, id types.NodeID) {
+	if err := s.SendNodeEventSync(s.clientContext(), event, id); err != nil {
+		log.Errorf("could not send node event %v to SDN: %v", event.EventType, err)
+	}
+}
+
+// SendNodeEventSync sends node event to SDN through http and returns the outcome, stopping when ctx is done.
+// It returns ErrSDNUnavailable if the SDN is unavailable, or a StatusError if the SDN rejected the event.
+func (s *realSDNHTTP) SendNodeEventSync(ctx context.Context, event message.NodeEvent, id types.NodeID) error {
+	warnUnknownNodeEventType(event)
+	return s.postNodeEvent(ctx, event, id)
+}
+
+// postNodeEvent sends node event to the SDN events endpoint
+func (s *realSDNHTTP) postNodeEvent(ctx context.Context, event message.NodeEvent, id types.NodeID) error {
 	url := fmt.Sprintf("%v/nodes/%v/events", s.sdnURL, id)
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
-		log.Errorf("could not serialize node event %v: %v", event, err)
-		return
+		return fmt.Errorf("could not serialize node event %v: %v", event, err)
 	}
-	resp, err := s.http(url, http.MethodPost, bytes.NewBuffer(eventBytes))
+	resp, err := s.httpContext(ctx, url, http.MethodPost, bytes.NewBuffer(eventBytes))
 	if err != nil {
-		log.Errorf("could not send node event %v to SDN: %v", event.EventType, err)
-		return
+		return err
 	}
 	log.Infof("node event %v sent to SDN, resp: %s", event.EventType, string(resp))
+	return nil
 }
 
-// SDNURL getter for the private sdnURL field
+// SDNURL getter for the private sdnURL field, the primary SDN URL
 func (s *realSDNHTTP) SDNURL() string {
 	return s.sdnURL
 }
 
 // NodeID getter for the private nodeID field
 func (s *realSDNHTTP) NodeID() types.NodeID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.nodeID
 }
 
-// Networks getter for the private networks field
+// Networks getter for the private networks field.
+// The returned map is not safe to use concurrently with network fetches, use SnapshotNetworks instead.
 func (s *realSDNHTTP) Networks() *message.BlockchainNetworks {
 	return &s.networks
 }
 
+// SnapshotNetworks returns a deep copy of the blockchain networks which is safe to read without locking.
+// Interface typed attributes such as the chain difficulties are shared with the original networks.
+func (s *realSDNHTTP) SnapshotNetworks() message.BlockchainNetworks {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(message.BlockchainNetworks, len(s.networks))
+	if err := copier.CopyWithOption(&snapshot, s.networks, copier.Option{DeepCopy: true}); err != nil {
+		log.Errorf("could not copy blockchain networks: %v", err)
+	}
+	return snapshot
+}
+
 // SetNetworks setter for the private networks field
 func (s *realSDNHTTP) SetNetworks(networks message.BlockchainNetworks) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.networks = networks
 }
 
 var (
 	errAuthHeaderNotBase65   = errors.New("auth header is not base64 encoded")
 	errAuthHeaderWrongFormat = errors.New("account_id and hash could not be generated from auth header")
+	errAuthHeaderNoAccountID = errors.New("auth header has an empty account_id")
+	errAuthHeaderNoHash      = errors.New("auth header has an empty hash")
+	errAuthHeaderBadAccount  = errors.New("auth header account_id is not a UUID")
 )
 
-// GetAccountIDSecretHashFromHeader extracts accountID and secret values from an authorization header
+// GetAccountIDSecretHashFromHeader extracts accountID and secret values from an authorization header.
+// The account ID must be a UUID, or types.BloxrouteAccountID, and the secret hash must not be empty.
 func GetAccountIDSecretHashFromHeader(authHeader string) (types.AccountID, string, error) {
 	payload, err := base64.StdEncoding.DecodeString(authHeader)
 	if err != nil {
@@ -867,5 +2879,20 @@ func GetAccountIDSecretHashFromHeader(authHeader string) (types.AccountID, strin
 	}
 	accountID := types.AccountID(accountIDAndHash[0])
 	secretHash := accountIDAndHash[1]
+	if accountID == "" {
+		return "", "", errAuthHeaderNoAccountID
+	}
+	if secretHash == "" {
+		return "", "", fmt.Errorf("%w for account %v", errAuthHeaderNoHash, accountID)
+	}
+	if accountID != types.BloxrouteAccountID && uuid.Validate(string(accountID)) != nil {
+		return "", "", fmt.Errorf("%w: %v", errAuthHeaderBadAccount, accountID)
+	}
 	return accountID, secretHash, nil
 }
+
+// BuildAuthHeader returns the authorization header for accountID and secretHash,
+// the base64 encoded "accountID:secretHash" value parsed by GetAccountIDSecretHashFromHeader
+func BuildAuthHeader(accountID types.AccountID, secretHash string) string {
+	return base64.StdEncoding.EncodeToString([]byte(string(accountID) + ":" + secretHash))
+}
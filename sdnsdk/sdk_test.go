@@ -2,22 +2,44 @@ package sdnsdk
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/bloXroute-Labs/bxcommon-go/cache"
 	"github.com/bloXroute-Labs/bxcommon-go/cert"
 	"github.com/bloXroute-Labs/bxcommon-go/clock"
+	log "github.com/bloXroute-Labs/bxcommon-go/logger"
 	"github.com/bloXroute-Labs/bxcommon-go/syncmap"
 	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
 	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
@@ -72,6 +94,32 @@ func cleanupFiles() {
 	_ = os.Remove(nodeModelCacheFileName)
 	_ = os.Remove(potentialRelaysFileName)
 	_ = os.Remove(accountModelsFileName)
+	for _, fileName := range []string{blockchainNetworkCacheFileName, nodeModelCacheFileName, potentialRelaysFileName, accountModelsFileName, customerAccountModelsFileName} {
+		ext := filepath.Ext(fileName)
+		networkFileNames, _ := filepath.Glob(strings.TrimSuffix(fileName, ext) + "_*" + ext)
+		for _, networkFileName := range networkFileNames {
+			_ = os.Remove(networkFileName)
+		}
+	}
+}
+
+func TestNetworkCacheFileName(t *testing.T) {
+	assert.Equal(t, "potentialrelays.json", networkCacheFileName(potentialRelaysFileName, 0))
+	assert.Equal(t, "potentialrelays_5.json", networkCacheFileName(potentialRelaysFileName, 5))
+	assert.Equal(t, "nodemodel_36.json", networkCacheFileName(nodeModelCacheFileName, 36))
+}
+
+func TestNodeModelCacheFile(t *testing.T) {
+	assert.Equal(t, "nodemodel.json", nodeModelCacheFile("", ""))
+	assert.Equal(t, "nodemodel_ethereum_mainnet.json", nodeModelCacheFile("Ethereum", "Mainnet"))
+	assert.Equal(t, "nodemodel_ethereum_bsc-mainnet.json", nodeModelCacheFile("Ethereum", "BSC-Mainnet"))
+	assert.Equal(t, "nodemodel_ethereum_-test-net.json", nodeModelCacheFile("Ethereum", "/test net"))
+}
+
+func TestAccountCacheFileName(t *testing.T) {
+	assert.Equal(t, "accountmodel.json", accountCacheFileName(CacheEndpointAccount, ""))
+	assert.Equal(t, "accountmodel_a1.json", accountCacheFileName(CacheEndpointAccount, "a1"))
+	assert.Equal(t, "customeraccountmodel_a1.json", accountCacheFileName(CacheEndpointAccounts, "a1"))
 }
 
 func testSDNHTTP() realSDNHTTP {
@@ -80,7 +128,7 @@ func testSDNHTTP() realSDNHTTP {
 			{IP: "1.1.1.1", Port: 1},
 			{IP: "2.2.2.2", Port: 2},
 		},
-		getPingLatencies: func(peers message.Peers) []nodeLatencyInfo {
+		getPingLatencies: func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
 			var nlis []nodeLatencyInfo
 			for _, peer := range peers {
 				nlis = append(nlis, nodeLatencyInfo{
@@ -94,6 +142,7 @@ func testSDNHTTP() realSDNHTTP {
 			NodeID:               "35299c61-55ad-4565-85a3-0cd985953fac",
 			BlockchainNetworkNum: LocalInitiatedPort,
 		},
+		latencyThreshold: defaultLatencyThreshold,
 	}
 }
 
@@ -130,6 +179,7 @@ func TestRegister_BlockchainNetworkNumberUpdated(t *testing.T) {
 				server.Close()
 			}()
 			testCerts := SetupTestCerts()
+			var changedFields []string
 			s := realSDNHTTP{
 				sdnURL:   server.URL,
 				sslCerts: &testCerts,
@@ -137,6 +187,11 @@ func TestRegister_BlockchainNetworkNumberUpdated(t *testing.T) {
 					Protocol: testCase.nodeModel.Protocol,
 					Network:  testCase.nodeModel.Network,
 				},
+				nodeModelChangeHandler: func(before, after message.NodeModel, changed []string) {
+					assert.Equal(t, types.NetworkNum(0), before.BlockchainNetworkNum)
+					assert.Equal(t, testCase.networkNumber, after.BlockchainNetworkNum)
+					changedFields = changed
+				},
 			}
 
 			err := s.Register()
@@ -145,10 +200,185 @@ func TestRegister_BlockchainNetworkNumberUpdated(t *testing.T) {
 			assert.Equal(t, testCase.nodeModel.Network, s.nodeModel.Network)
 			assert.Equal(t, testCase.nodeModel.Protocol, s.nodeModel.Protocol)
 			assert.Equal(t, testCase.networkNumber, s.nodeModel.BlockchainNetworkNum)
+			assert.ElementsMatch(t, []string{"external_ip", "node_id", "blockchain_network_num"}, changedFields)
 		})
 	}
 }
 
+func TestSDNHTTP_Register_FromCache(t *testing.T) {
+	nodeModel := message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet"}
+	handler := mockNodesServer(t, nodeModel.NodeID, nodeModel.ExternalPort, nodeModel.ExternalIP, nodeModel.Protocol, nodeModel.Network, 5, "")
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: handler}})
+	defer server.Close()
+	unavailable := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}}})
+	defer unavailable.Close()
+
+	dataDir := t.TempDir()
+	testCerts := SetupTestCerts()
+	s := realSDNHTTP{sdnURL: server.URL, sslCerts: &testCerts, dataDir: dataDir, nodeModel: &message.NodeModel{Protocol: "Ethereum", Network: "Mainnet"}}
+	require.NoError(t, s.Register())
+	assert.FileExists(t, path.Join(dataDir, "nodemodel_ethereum_mainnet.json"))
+
+	// the network number is not known before the registration, the cache file is found by the network name
+	restarted := realSDNHTTP{sdnURL: unavailable.URL, sslCerts: &testCerts, dataDir: dataDir, nodeModel: &message.NodeModel{Protocol: "Ethereum", Network: "Mainnet"}}
+	require.NoError(t, restarted.Register())
+	assert.Equal(t, types.NetworkNum(5), restarted.NodeModel().BlockchainNetworkNum)
+	assert.Equal(t, []string{"nodemodel_ethereum_mainnet.json"}, restarted.ResponsesFromCache())
+
+	// the node model of another network is not served from the cache
+	other := realSDNHTTP{sdnURL: unavailable.URL, sslCerts: &testCerts, dataDir: dataDir, nodeModel: &message.NodeModel{Protocol: "Ethereum", Network: "Holesky"}}
+	assert.Error(t, other.Register())
+}
+
+func TestSDNHTTP_ForceReRegister(t *testing.T) {
+	defer cleanupFiles()
+	SetupSSLFiles("test")
+	defer CleanupSSLCerts()
+	testCerts := NewTestCertsWithoutSetup()
+	nodeID, err := testCerts.GetNodeID()
+	require.NoError(t, err)
+
+	var requests []message.NodeModel
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: func(w http.ResponseWriter, r *http.Request) {
+		var nodeModel message.NodeModel
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&nodeModel))
+		requests = append(requests, nodeModel)
+		nodeModel.NodeID = nodeID
+		nodeModel.Cert = PrivateCert
+		_ = json.NewEncoder(w).Encode(nodeModel)
+	}}})
+	defer server.Close()
+
+	s := realSDNHTTP{sdnURL: server.URL, sslCerts: &testCerts, nodeModel: &message.NodeModel{Protocol: "Ethereum", Network: "Mainnet"}}
+	require.NoError(t, s.Register())
+	assert.False(t, s.NeedsRegistration())
+	require.Len(t, requests, 1)
+	assert.Empty(t, requests[0].Csr)
+
+	// the SDN requests and certificate checks made meanwhile do not race with discarding the certificate
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_, _ = s.sharedTransport()
+			_, _ = s.CertExpiry()
+		}
+	}()
+	require.NoError(t, s.ForceReRegister())
+	close(stop)
+	<-done
+	assert.False(t, s.NeedsRegistration())
+	assert.Equal(t, nodeID, s.NodeID())
+	// a new private certificate was requested without the discarded node ID
+	require.Len(t, requests, 2)
+	assert.NotEmpty(t, requests[1].Csr)
+	assert.Empty(t, requests[1].NodeID)
+
+	server.Close()
+	assert.Error(t, s.ForceReRegister())
+	assert.True(t, s.NeedsRegistration())
+	assert.Empty(t, s.NodeModel().NodeID)
+	assert.Empty(t, s.accountID)
+}
+
+func TestSDNHTTP_ForceReRegister_SDNUnavailable(t *testing.T) {
+	defer cleanupFiles()
+	SetupSSLFiles("test")
+	defer CleanupSSLCerts()
+	testCerts := NewTestCertsWithoutSetup()
+	nodeID, err := testCerts.GetNodeID()
+	require.NoError(t, err)
+
+	var unavailable atomic.Bool
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: func(w http.ResponseWriter, r *http.Request) {
+		if unavailable.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"message": "503 Service Unavailable" }`))
+			return
+		}
+		var nodeModel message.NodeModel
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&nodeModel))
+		nodeModel.NodeID = nodeID
+		nodeModel.Cert = PrivateCert
+		_ = json.NewEncoder(w).Encode(nodeModel)
+	}}})
+	defer server.Close()
+
+	s := realSDNHTTP{sdnURL: server.URL, sslCerts: &testCerts, nodeModel: &message.NodeModel{Protocol: "Ethereum", Network: "Mainnet"}}
+	require.NoError(t, s.Register())
+	cacheFileName := nodeModelCacheFile("Ethereum", "Mainnet")
+	_, err = LoadCacheFile("", cacheFileName)
+	require.NoError(t, err)
+
+	// the cached node model holds the discarded certificate, so it is not used for the re-registration
+	unavailable.Store(true)
+	assert.ErrorIs(t, s.ForceReRegister(), ErrSDNUnavailable)
+	assert.True(t, s.NeedsRegistration())
+	assert.Empty(t, s.ResponsesFromCache())
+
+	// the cache file is kept for the registrations without a csr
+	_, err = LoadCacheFile("", cacheFileName)
+	require.NoError(t, err)
+}
+
+func TestSDNHTTP_Register_ExternalPortConflict(t *testing.T) {
+	var requests int
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	nodeModel := message.NodeModel{ExternalIP: "172.0.0.1", ExternalPort: 1801, Protocol: "Ethereum", Network: "Mainnet"}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "", WithLocalNodeModels(func() []message.NodeModel {
+		return []message.NodeModel{{NodeID: "other-gateway", ExternalIP: "172.0.0.1", ExternalPort: 1801}}
+	})).(*realSDNHTTP)
+
+	// the conflict is detected before contacting the SDN
+	assert.ErrorIs(t, sdn.Register(), message.ErrExternalPortConflict)
+	assert.Zero(t, requests)
+}
+
+func TestSDNHTTP_Register_CertExpiry(t *testing.T) {
+	var requests int
+	server := mockRouter([]handlerArgs{{method: "POST", pattern: "/nodes", handler: func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}}})
+	defer server.Close()
+
+	sslCerts := SetupTestCerts()
+	mockClock := clock.NewMockClock()
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "",
+		WithClock(mockClock), WithCertExpiryWarning(48*time.Hour)).(*realSDNHTTP)
+
+	expiry, err := sdn.CertExpiry()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2033, 10, 13, 0, 0, 0, 0, time.UTC), expiry.UTC())
+
+	globalLogger := log.NewGlobal()
+	mockClock.SetTime(expiry.Add(-72 * time.Hour))
+	require.NoError(t, sdn.checkCertExpiry())
+	assert.Empty(t, globalLogger.AllEntries())
+
+	// a warning is logged within the expiry warning window
+	mockClock.SetTime(expiry.Add(-24 * time.Hour))
+	require.NoError(t, sdn.checkCertExpiry())
+	require.Len(t, globalLogger.AllEntries(), 1)
+	assert.Contains(t, globalLogger.AllEntries()[0].Message, "certificate expires on")
+
+	// an expired certificate is reported before contacting the SDN
+	mockClock.SetTime(expiry)
+	assert.ErrorIs(t, sdn.Register(), ErrCertExpired)
+	assert.Zero(t, requests)
+}
+
 func TestDirectRelayConnections_IfPingOver40MSLogsWarning(t *testing.T) {
 	jsonRespRelays := `[{"ip":"8.208.101.30", "port":1809}, {"ip":"47.90.133.153", "port":1809}]`
 	nodeModel := message.NodeModel{
@@ -212,7 +442,7 @@ func TestDirectRelayConnections_IfPingOver40MSLogsWarning(t *testing.T) {
 
 			sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "").(*realSDNHTTP)
 
-			getPingLatenciesFunction := func(peers message.Peers) []nodeLatencyInfo {
+			getPingLatenciesFunction := func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
 				return testCase.latencies
 			}
 			sdn.getPingLatencies = getPingLatenciesFunction
@@ -275,10 +505,440 @@ func TestDirectRelayConnections_IncorrectArgs(t *testing.T) {
 		t.Run(fmt.Sprint(testCase.name), func(t *testing.T) {
 			err := s.DirectRelayConnections(testCase.relaysString, 2, make(chan RelayInstruction), syncmap.NewStringMapOf[types.RelayInfo]())
 			assert.Equal(t, testCase.expectedError, err)
+
+			_, _, err = ParseRelayHosts(testCase.relaysString, 2)
+			assert.Equal(t, testCase.expectedError, err)
+		})
+	}
+}
+
+func TestParseRelayHosts(t *testing.T) {
+	relays, autoCount, err := ParseRelayHosts("1.1.1.1, auto, 2.2.2.2:34, 1.1.1.1:56, 3.3.3.3", 3)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"1.1.1.1": 1809, "2.2.2.2": 34}, relays)
+	assert.Equal(t, 1, autoCount)
+
+	_, _, err = ParseRelayHosts("1.1.1.1:port", 3)
+	require.Error(t, err)
+}
+
+func TestParseRelaySlots(t *testing.T) {
+	slots, err := ParseRelaySlots("1.1.1.1, auto, 2.2.2.2:34, 1.1.1.1:56, AUTO, 3.3.3.3", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []RelaySlot{
+		{IP: "1.1.1.1", Port: 1809},
+		{Auto: true},
+		{IP: "2.2.2.2", Port: 34},
+		{Auto: true},
+	}, slots)
+
+	_, err = ParseRelaySlots("1.1.1.1, ,auto", 3)
+	require.Error(t, err)
+}
+
+func TestParseRelayHosts_AutoVariants(t *testing.T) {
+	testTable := []struct {
+		name              string
+		relaysString      string
+		expectedRelays    relayMap
+		expectedAutoCount int
+	}{
+		{name: "capitalized", relaysString: "Auto", expectedRelays: relayMap{}, expectedAutoCount: 1},
+		{name: "upper case with spaces", relaysString: " AUTO ", expectedRelays: relayMap{}, expectedAutoCount: 1},
+		{name: "tab padded", relaysString: "\tauto\t,1.1.1.1", expectedRelays: relayMap{"1.1.1.1": 1809}, expectedAutoCount: 1},
+		{name: "mixed whitespace", relaysString: "\t AuTo \n,\t1.1.1.1:34\t", expectedRelays: relayMap{"1.1.1.1": 34}, expectedAutoCount: 1},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			relays, autoCount, err := parseRelayHosts(testCase.relaysString, 2, defaultRelayPort, IPResolutionFirst, false)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedRelays, relays)
+			assert.Equal(t, testCase.expectedAutoCount, autoCount)
+		})
+	}
+}
+
+func TestParseRelayHosts_DuplicateWarnings(t *testing.T) {
+	testTable := []struct {
+		name             string
+		relaysString     string
+		expectedWarnings []string
+	}{
+		{
+			name:         "duplicate relay ips",
+			relaysString: "1.1.1.1, 1.1.1.1:34",
+			expectedWarnings: []string{
+				"relay 1.1.1.1:34 from --relays/relay-ip resolves to 1.1.1.1 which was already specified as 1.1.1.1:1809, ignoring the duplicate",
+			},
+		},
+		{
+			name:         "duplicate relay ips #2",
+			relaysString: "1.1.1.1:1, 1.1.1.1:2, 2.2.2.2:3, 2.2.2.2:4",
+			expectedWarnings: []string{
+				"relay 1.1.1.1:2 from --relays/relay-ip resolves to 1.1.1.1 which was already specified as 1.1.1.1:1, ignoring the duplicate",
+				"relay 2.2.2.2:4 from --relays/relay-ip resolves to 2.2.2.2 which was already specified as 2.2.2.2:3, ignoring the duplicate",
+			},
+		},
+		{
+			name:         "no duplicates",
+			relaysString: "1.1.1.1, 2.2.2.2",
+		},
+	}
+
+	globalLogger := log.NewGlobal()
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			globalLogger.Reset()
+			_, _, err := parseRelayHosts(testCase.relaysString, 3, defaultRelayPort, IPResolutionFirst, false)
+			require.NoError(t, err)
+
+			var warnings []string
+			for _, entry := range globalLogger.AllEntries() {
+				warnings = append(warnings, entry.Message)
+			}
+			assert.Equal(t, testCase.expectedWarnings, warnings)
+		})
+	}
+}
+
+func TestLogLowestLatency_HighLatencyWarning(t *testing.T) {
+	testTable := []struct {
+		name            string
+		opts            []Option
+		latency         float64
+		expectedWarning bool
+	}{
+		{name: "below default", latency: 40},
+		{name: "above default", latency: 41, expectedWarning: true},
+		{name: "below configured", opts: []Option{WithHighLatencyWarning(150)}, latency: 120},
+		{name: "above configured", opts: []Option{WithHighLatencyWarning(150)}, latency: 151, expectedWarning: true},
+	}
+
+	globalLogger := log.NewGlobal()
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			globalLogger.Reset()
+			sdn := NewSDNHTTP(nil, "", message.NodeModel{ExternalIP: "172.0.0.1"}, "", testCase.opts...).(*realSDNHTTP)
+			logLowestLatency(nodeLatencyInfo{IP: "1.1.1.1", Port: 1809, Latency: testCase.latency}, sdn.highLatencyWarningThreshold())
+
+			var messages []string
+			for _, entry := range globalLogger.AllEntries() {
+				messages = append(messages, entry.Message)
+			}
+			warning := fmt.Sprintf("ping latency of the fastest relay 1.1.1.1:1809 is %v ms, which is more than %v ms", testCase.latency, sdn.highLatencyWarningThreshold())
+			if testCase.expectedWarning {
+				assert.Contains(t, messages, warning)
+			} else {
+				assert.NotContains(t, messages, warning)
+			}
+		})
+	}
+}
+
+func TestGetIPWithPolicy(t *testing.T) {
+	defer func() {
+		lookupHost = net.LookupHost
+		resolvedHosts.reset()
+	}()
+
+	testTable := []struct {
+		name       string
+		resolved   []string
+		policy     IPResolutionPolicy
+		expectedIP string
+	}{
+		{name: "first", resolved: []string{"2001:db8::1", "1.2.3.4", "2001:db8::2"}, policy: IPResolutionFirst, expectedIP: "2001:db8::1"},
+		{name: "prefer ipv4", resolved: []string{"2001:db8::1", "1.2.3.4", "5.6.7.8"}, policy: IPResolutionPreferIPv4, expectedIP: "1.2.3.4"},
+		{name: "prefer ipv6", resolved: []string{"1.2.3.4", "2001:db8::1", "2001:db8::2"}, policy: IPResolutionPreferIPv6, expectedIP: "2001:db8::1"},
+		{name: "prefer ipv4 without ipv4", resolved: []string{"2001:db8::1", "2001:db8::2"}, policy: IPResolutionPreferIPv4, expectedIP: "2001:db8::1"},
+		{name: "prefer ipv6 without ipv6", resolved: []string{"1.2.3.4", "5.6.7.8"}, policy: IPResolutionPreferIPv6, expectedIP: "1.2.3.4"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			resolvedHosts.reset()
+			lookupHost = func(host string) ([]string, error) {
+				return testCase.resolved, nil
+			}
+			ip, err := GetIPWithPolicy("relay.example.com", testCase.policy)
+			require.NoError(t, err)
+			assert.Equal(t, testCase.expectedIP, ip)
+
+			relays, _, err := parseRelayHosts("relay.example.com:1810", 1, defaultRelayPort, testCase.policy, false)
+			require.NoError(t, err)
+			assert.Equal(t, relayMap{testCase.expectedIP: 1810}, relays)
+		})
+	}
+}
+
+func TestResolveHost_Cache(t *testing.T) {
+	defer func() {
+		lookupHost = net.LookupHost
+		resolvedHosts.reset()
+	}()
+	resolvedHosts.reset()
+	lookups := 0
+	lookupHost = func(host string) ([]string, error) {
+		lookups++
+		return []string{"1.2.3.4"}, nil
+	}
+
+	ip, err := ResolveHost("relay.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("1.2.3.4"), ip)
+	ipString, err := GetIP("relay.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.3.4", ipString)
+	assert.Equal(t, 1, lookups)
+
+	// IP addresses are not resolved
+	ip, err = ResolveHost("5.6.7.8")
+	require.NoError(t, err)
+	assert.Equal(t, net.ParseIP("5.6.7.8"), ip)
+	assert.Equal(t, 1, lookups)
+
+	// expired entries are resolved again
+	resolvedHosts.entries["relay.example.com"] = dnsCacheEntry{ips: []string{"1.2.3.4"}, expires: time.Now().Add(-time.Second)}
+	_, err = ResolveHost("relay.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, lookups)
+}
+
+func TestParseRelayHosts_ExpandHostnames(t *testing.T) {
+	defer func() {
+		lookupHost = net.LookupHost
+		resolvedHosts.reset()
+	}()
+	resolvedHosts.reset()
+	lookupHost = func(host string) ([]string, error) {
+		return []string{"2001:db8::1", "1.2.3.4", "5.6.7.8"}, nil
+	}
+
+	ips, err := GetIPsWithPolicy("relay.example.com", IPResolutionPreferIPv4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.2.3.4", "5.6.7.8", "2001:db8::1"}, ips)
+
+	relays, autoCount, err := parseRelayHosts("relay.example.com, auto", 3, defaultRelayPort, IPResolutionPreferIPv4, false)
+	require.NoError(t, err)
+	assert.Equal(t, relayMap{"1.2.3.4": 1809}, relays)
+	assert.Equal(t, 1, autoCount)
+
+	// the expanded addresses are limited by the relay limit
+	relays, autoCount, err = parseRelayHosts("auto, relay.example.com", 3, defaultRelayPort, IPResolutionPreferIPv4, true)
+	require.NoError(t, err)
+	assert.Equal(t, relayMap{"1.2.3.4": 1809, "5.6.7.8": 1809}, relays)
+	assert.Equal(t, 1, autoCount)
+
+	s := testSDNHTTP()
+	s.expandRelayHostnames = true
+	relayInstructions := make(chan RelayInstruction, 3)
+	s.connectAutoRelays(context.Background(), 2, relayInstructions, []nodeLatencyInfo{{IP: "relay.example.com", Port: 1810}}, syncmap.NewStringMapOf[types.RelayInfo]())
+	assert.Equal(t, RelayInstruction{IP: "2001:db8::1", Port: 1810, Type: Connect}, <-relayInstructions)
+	assert.Equal(t, RelayInstruction{IP: "1.2.3.4", Port: 1810, Type: Connect}, <-relayInstructions)
+	assert.Empty(t, relayInstructions)
+}
+
+func TestPlanRelayConnections(t *testing.T) {
+	s := testSDNHTTP()
+
+	instructions, autoCount, err := s.PlanRelayConnections("2.2.2.2:1810, auto, 1.1.1.1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, []RelayInstruction{
+		{IP: "1.1.1.1", Port: 1809, Type: Connect, IsStatic: true},
+		{IP: "2.2.2.2", Port: 1810, Type: Connect, IsStatic: true},
+	}, instructions)
+	assert.Equal(t, 1, autoCount)
+
+	_, _, err = s.PlanRelayConnections("1.1.1.1:port", 3)
+	assert.Error(t, err)
+}
+
+func TestSDNHTTP_ExternalIP(t *testing.T) {
+	IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
+	sslCerts := cert.SSLCerts{}
+
+	sdn := NewSDNHTTP(&sslCerts, "", message.NodeModel{}, "").(*realSDNHTTP)
+	assert.Equal(t, "11.111.111.111", sdn.ExternalIP())
+
+	// the node model may be changed after the IP was resolved
+	sdn.updateNodeModel(func(nodeModel *message.NodeModel) { nodeModel.ExternalIP = "22.222.222.222" })
+	assert.Equal(t, "11.111.111.111", sdn.ExternalIP())
+
+	sdn = NewSDNHTTP(&sslCerts, "", message.NodeModel{ExternalIP: "172.0.0.1"}, "").(*realSDNHTTP)
+	assert.Equal(t, "172.0.0.1", sdn.ExternalIP())
+}
+
+func TestPlanRelayConnections_DefaultRelayPorts(t *testing.T) {
+	s := testSDNHTTP()
+	WithDefaultRelayPorts(map[RelayPortKey]int64{
+		{Protocol: "Ethereum"}:                     1801,
+		{Protocol: "ethereum", Network: "Holesky"}: 1802,
+	})(&s)
+
+	testCases := []struct {
+		protocol string
+		network  string
+		port     int64
+	}{
+		{protocol: "Ethereum", network: "Mainnet", port: 1801},
+		{protocol: "Ethereum", network: "Holesky", port: 1802},
+		{protocol: "BitcoinCash", network: "Mainnet", port: 1809},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.protocol+"/"+testCase.network, func(t *testing.T) {
+			s.nodeModel = &message.NodeModel{Protocol: testCase.protocol, Network: testCase.network}
+			instructions, _, err := s.PlanRelayConnections("1.1.1.1, 2.2.2.2:1810", 2)
+			require.NoError(t, err)
+			assert.Equal(t, []RelayInstruction{
+				{IP: "1.1.1.1", Port: testCase.port, Type: Connect, IsStatic: true},
+				{IP: "2.2.2.2", Port: 1810, Type: Connect, IsStatic: true},
+			}, instructions)
+		})
+	}
+}
+
+func TestConnInstructionType_String(t *testing.T) {
+	assert.Equal(t, "CONNECT", Connect.String())
+	assert.Equal(t, "DISCONNECT", Disconnect.String())
+	assert.Equal(t, "SWITCH", Switch.String())
+	assert.Equal(t, "UNKNOWN", ConnInstructionType(42).String())
+	assert.Equal(t, "SWITCH", relayLogFields("1.1.1.1", 1809, Switch)["instruction_type"])
+}
+
+func TestCanonicalizeRelays(t *testing.T) {
+	testTable := []struct {
+		name           string
+		relaysString   string
+		relayLimit     uint64
+		expectedRelays string
+		expectedError  error
+	}{
+		{name: "one auto", relaysString: "auto", relayLimit: 2, expectedRelays: "auto"},
+		{name: "two autos", relaysString: "auto, auto", relayLimit: 2, expectedRelays: "auto,auto"},
+		{name: "an auto and a relay", relaysString: "auto, 1.1.1.1", relayLimit: 2, expectedRelays: "1.1.1.1:1809,auto"},
+		{name: "two relays, only one has port", relaysString: "2.2.2.2, 1.1.1.1:34", relayLimit: 2, expectedRelays: "1.1.1.1:34,2.2.2.2:1809"},
+		{name: "three relays over limit", relaysString: "4.4.4.4, 2.2.2.2:22, 1.1.1.1", relayLimit: 2, expectedRelays: "2.2.2.2:22,4.4.4.4:1809"},
+		{name: "duplicate relay ips", relaysString: "1.1.1.1:1, 1.1.1.1:2, 2.2.2.2:3, 2.2.2.2:4", relayLimit: 2, expectedRelays: "1.1.1.1:1,2.2.2.2:3"},
+		{name: "duplicate relay ips with auto after", relaysString: "1.1.1.1, 1.1.1.1:2, auto", relayLimit: 2, expectedRelays: "1.1.1.1:1809,auto"},
+		{
+			name:          "incorrect port",
+			relaysString:  "1.1.1.1, 2.2.2.2:abc",
+			relayLimit:    2,
+			expectedError: fmt.Errorf("port provided abc is not valid - strconv.Atoi: parsing \"abc\": invalid syntax"),
+		},
+		{
+			name:          "incorrect host",
+			relaysString:  "1:1:1, 1.1.1.1",
+			relayLimit:    2,
+			expectedError: fmt.Errorf("relay from --relays/relay-ip was given in the incorrect format '1:1:1', should be IP:Port"),
+		},
+		{
+			name:          "no relay after comma",
+			relaysString:  "127.0.0.1,",
+			relayLimit:    2,
+			expectedError: fmt.Errorf("argument to --relays/relay-ip is empty or has an extra comma"),
+		},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			relays, err := CanonicalizeRelays(testCase.relaysString, testCase.relayLimit)
+			assert.Equal(t, testCase.expectedError, err)
+			assert.Equal(t, testCase.expectedRelays, relays)
 		})
 	}
 }
 
+func TestCanonicalizeRelays_IPv6(t *testing.T) {
+	defer func() {
+		lookupHost = net.LookupHost
+		resolvedHosts.reset()
+	}()
+	resolvedHosts.reset()
+	lookupHost = func(host string) ([]string, error) {
+		return []string{"2001:db8::1"}, nil
+	}
+
+	relays, err := CanonicalizeRelays("relay.example.com:1810, 1.1.1.1, auto", 3)
+	require.NoError(t, err)
+	// the IPv6 address is bracketed so its port is not ambiguous
+	assert.Equal(t, "1.1.1.1:1809,[2001:db8::1]:1810,auto", relays)
+}
+
+func TestManageAutoRelays_PreferSameContinentOnTies(t *testing.T) {
+	s := testSDNHTTP()
+	s.nodeModel.Continent = "EU"
+	s.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{
+			{IP: "1.1.1.1", Port: 1, Latency: 5, Continent: "NA"},
+			{IP: "2.2.2.2", Port: 2, Latency: 5, Continent: "EU"},
+			{IP: "3.3.3.3", Port: 3, Latency: 4, Continent: "AS"},
+		}
+	}
+
+	relayInstructions := make(chan RelayInstruction, 2)
+	s.manageAutoRelays(context.Background(), 2, relayInstructions, s.relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	close(relayInstructions)
+
+	var connected []string
+	for instruction := range relayInstructions {
+		connected = append(connected, instruction.IP)
+	}
+	// a lower latency still wins over the same continent
+	assert.Equal(t, []string{"3.3.3.3", "2.2.2.2"}, connected)
+}
+
+func TestManageAutoRelays_PreferSameContinentWithPriorities(t *testing.T) {
+	s := testSDNHTTP()
+	s.nodeModel.Continent = "EU"
+	// the priority of 2.2.2.2 makes it rank the same as 1.1.1.1, so the continent breaks the tie
+	WithRelayPriorities(map[string]int{"2.2.2.2": 1}, 10)(&s)
+	s.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{
+			{IP: "1.1.1.1", Port: 1, Latency: 5, Continent: "NA"},
+			{IP: "2.2.2.2", Port: 2, Latency: 15, Continent: "EU"},
+			{IP: "4.4.4.4", Port: 4, Latency: 30, Continent: "AS"},
+		}
+	}
+
+	relayInstructions := make(chan RelayInstruction, 3)
+	s.manageAutoRelays(context.Background(), 3, relayInstructions, s.relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	close(relayInstructions)
+
+	var connected []string
+	for instruction := range relayInstructions {
+		connected = append(connected, instruction.IP)
+	}
+	assert.Equal(t, []string{"2.2.2.2", "1.1.1.1", "4.4.4.4"}, connected)
+}
+
+func TestFindFastestAvailableRelays_PreferSameContinent(t *testing.T) {
+	s := testSDNHTTP()
+	s.nodeModel.Continent = "EU"
+	WithRelayPriorities(map[string]int{"3": 1}, 10)(&s)
+	latencies := []nodeLatencyInfo{
+		{Latency: 5, IP: "1", Port: 1809, Continent: "NA"},
+		{Latency: 5, IP: "2", Port: 1809, Continent: "EU"},
+		{Latency: 15, IP: "3", Port: 1809, Continent: "NA"},
+	}
+
+	fastestAvailableRelays := s.findFastestAvailableRelays(latencies, map[string]types.RelayInfo{})
+	require.Len(t, fastestAvailableRelays, 3)
+	// 3 ranks the same as the others thanks to its priority, but only 2 is on the node continent
+	assert.Equal(t, "2", fastestAvailableRelays[0].IP)
+	assert.Equal(t, "1", fastestAvailableRelays[1].IP)
+	assert.Equal(t, "3", fastestAvailableRelays[2].IP)
+}
+
+func TestPeers_UnmarshalWithoutAttributes(t *testing.T) {
+	var peers message.Peers
+	require.NoError(t, json.Unmarshal([]byte(`[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809, "attributes": {"continent": "EU"}}]`), &peers))
+	require.Len(t, peers, 2)
+	assert.Empty(t, peers[0].Attributes.Continent)
+	assert.Equal(t, "EU", peers[1].Attributes.Continent)
+}
+
 func TestSDNHTTP_GetAutoConnectedRelays(t *testing.T) {
 	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
 	// static and connected should not return as auto relay
@@ -330,62 +990,400 @@ func TestFindRelaysToSwitch(t *testing.T) {
 
 }
 
-func TestDirectRelayConnections_RelayLimit2(t *testing.T) {
-	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`
-	latencies := []nodeLatencyInfo{{Latency: 5, IP: "1.1.1.1", Port: 1809}, {Latency: 6, IP: "2.2.2.2", Port: 1809}}
+func TestFindRelaysToSwitch_ConfiguredThreshold(t *testing.T) {
+	autoRelay := make(map[string]types.RelayInfo)
+	autoRelay["1"] = types.RelayInfo{IsConnected: true, Latency: 40, Port: 1809}
+	autoRelay["2"] = types.RelayInfo{IsConnected: true, Latency: 60, Port: 1809}
+	fastestAvailableRelays := []nodeLatencyInfo{{Latency: 15, IP: "3", Port: 1809}}
+
+	testTable := []struct {
+		name             string
+		threshold        float64
+		expectedSwitched []string
+	}{
+		{name: "colocated threshold", threshold: 3, expectedSwitched: []string{"1", "2"}},
+		{name: "default threshold", threshold: defaultLatencyThreshold, expectedSwitched: []string{"1", "2"}},
+		{name: "only relay outside threshold is switched", threshold: 30, expectedSwitched: []string{"2"}},
+		{name: "relays within threshold are kept", threshold: 50, expectedSwitched: []string{}},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := testSDNHTTP()
+			WithLatencyThreshold(testCase.threshold)(&s)
+			relaysToSwitch := s.findRelaysToSwitch(autoRelay, fastestAvailableRelays)
+			assert.Len(t, relaysToSwitch, len(testCase.expectedSwitched))
+			for _, ip := range testCase.expectedSwitched {
+				assert.Contains(t, relaysToSwitch, relayToSwitch{ip: ip, port: 1809})
+			}
+		})
+	}
+}
+
+func TestFindRelaysToSwitch_RelayPriorities(t *testing.T) {
+	s := testSDNHTTP()
+	WithLatencyThreshold(3)(&s)
+	WithRelayPriorities(map[string]int{"1": 1, "5": 1}, 10)(&s)
+
+	latencies := []nodeLatencyInfo{{Latency: 3, IP: "4", Port: 1809}, {Latency: 8, IP: "5", Port: 1809}, {Latency: 9, IP: "1", Port: 1809}, {Latency: 25, IP: "2", Port: 1809}}
+	autoRelay := map[string]types.RelayInfo{"1": {IsConnected: true, Port: 1809}, "2": {IsConnected: true, Port: 1809}}
+	fastestAvailableRelays := s.findFastestAvailableRelays(latencies, autoRelay)
+	// the preferred relay 5 is ranked before the slightly faster relay 4
+	require.Len(t, fastestAvailableRelays, 2)
+	assert.Equal(t, "5", fastestAvailableRelays[0].IP)
+	assert.Equal(t, "4", fastestAvailableRelays[1].IP)
+
+	// the least preferred connected relay is first
+	sortedRelays := s.convertMapToSortedSlice(autoRelay)
+	assert.Equal(t, "2", sortedRelays[0].ip)
+
+	relaysToSwitch := s.findRelaysToSwitch(autoRelay, fastestAvailableRelays)
+	// the preferred relay 1 is kept, the relay 2 is switched to the preferred relay 5 first
+	assert.Len(t, relaysToSwitch, 1)
+	key := relayToSwitch{ip: "2", port: 1809}
+	require.Contains(t, relaysToSwitch, key)
+	assert.Equal(t, "5", relaysToSwitch[key][0].IP)
+}
+
+func TestFindRelaysToSwitch_LatencySpike(t *testing.T) {
+	s := testSDNHTTP()
+	spiking := types.RelayInfo{IsConnected: true, Port: 1809}
+	slow := types.RelayInfo{IsConnected: true, Port: 1809}
+	for _, latency := range []float64{5, 5, 5, 5, 60} {
+		spiking.AddLatency(latency)
+		slow.AddLatency(latency + 55)
+	}
+	autoRelay := map[string]types.RelayInfo{"1": spiking, "2": slow}
+	fastestAvailableRelays := []nodeLatencyInfo{{Latency: 6, IP: "3", Port: 1809}}
+
+	relaysToSwitch := s.findRelaysToSwitch(autoRelay, fastestAvailableRelays)
+	// the relay 1 is kept after a single latency spike, the consistently slow relay 2 is switched
+	assert.Len(t, relaysToSwitch, 1)
+	assert.Contains(t, relaysToSwitch, relayToSwitch{ip: "2", port: 1809})
+}
+
+func TestFindFastestRelays_DisconnectSlowRelays(t *testing.T) {
+	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}, {"ip":"3.3.3.3", "port":1809}]`
+	latencies := []nodeLatencyInfo{{Latency: 5, IP: "3.3.3.3", Port: 1809}, {Latency: 90, IP: "2.2.2.2", Port: 1809}, {Latency: 95, IP: "1.1.1.1", Port: 1809}}
 	nodeModel := message.NodeModel{
 		NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
 		ExternalIP: "11.113.164.111",
 		Protocol:   "Ethereum",
 		Network:    "Mainnet",
 	}
-	IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
 
 	testTable := []struct {
-		name           string
-		relaysString   string
-		expectedRelays relayMap
-		expectedError  error
+		name               string
+		slowRelayLatency   float64
+		expectedDisconnect bool
 	}{
-		{
-			name:           "one auto",
-			relaysString:   "auto",
-			expectedRelays: relayMap{"1.1.1.1": 1809},
-		},
-		{
-			name:           "two autos",
-			relaysString:   "auto, auto",
-			expectedRelays: relayMap{"1.1.1.1": 1809, "2.2.2.2": 1809},
-		},
-		{
-			name:           "an auto and a relay",
-			relaysString:   "auto, 1.1.1.1",
-			expectedRelays: relayMap{"1.1.1.1": 1809, "2.2.2.2": 1809},
-		},
-		{
-			name:           "one relay",
-			relaysString:   "1.1.1.1",
-			expectedRelays: relayMap{"1.1.1.1": 1809},
-		},
-		{
-			name:           "two relays",
-			relaysString:   "1.1.1.1, 2.2.2.2",
-			expectedRelays: relayMap{"1.1.1.1": 1809, "2.2.2.2": 1809},
-		},
-		{
-			name:           "two relays, only one has port",
-			relaysString:   "1.1.1.1:34, 2.2.2.2",
-			expectedRelays: relayMap{"1.1.1.1": 34, "2.2.2.2": 1809},
-		},
-		{
-			name:           "two relays, both have ports",
-			relaysString:   "1.1.1.1:34, 2.2.2.2:56",
-			expectedRelays: relayMap{"1.1.1.1": 34, "2.2.2.2": 56},
-		},
-		{
-			name:           "three relays",
-			relaysString:   "4.4.4.4, 2.2.2.2:22, 1.1.1.1",
-			expectedRelays: relayMap{"4.4.4.4": 1809, "2.2.2.2": 22},
+		{name: "disabled", slowRelayLatency: 0},
+		{name: "enabled", slowRelayLatency: 50, expectedDisconnect: true},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			defer cleanupFiles()
+			sslCerts := cert.SSLCerts{}
+			handler, _ := mockRelaysServer(t, jsonRespRelays)
+			server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+			defer server.Close()
+
+			sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "", WithSlowRelayDisconnect(testCase.slowRelayLatency)).(*realSDNHTTP)
+			sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+				return latencies
+			}
+
+			ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+			// static relays are never disconnected
+			ignoredRelays.Store("1.1.1.1", types.RelayInfo{IsConnected: true, IsStatic: true, Port: 1809})
+			// 3.3.3.3 is connected so 2.2.2.2 has no faster relay to switch to
+			ignoredRelays.Store("2.2.2.2", types.RelayInfo{IsConnected: true, Port: 1809})
+			ignoredRelays.Store("3.3.3.3", types.RelayInfo{IsConnected: true, Port: 1809})
+
+			relayInstructions := make(chan RelayInstruction, 3)
+			sdn.FindFastestRelays(relayInstructions, ignoredRelays)
+			close(relayInstructions)
+
+			var instructions []RelayInstruction
+			for instruction := range relayInstructions {
+				instructions = append(instructions, instruction)
+			}
+
+			if !testCase.expectedDisconnect {
+				assert.Empty(t, instructions)
+				return
+			}
+			require.Len(t, instructions, 1)
+			assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Disconnect}, instructions[0])
+			info, ok := ignoredRelays.Load("2.2.2.2")
+			require.True(t, ok)
+			assert.False(t, info.IsConnected)
+		})
+	}
+}
+
+func TestDirectRelayConnectionsContext_ReevaluatesAutoRelays(t *testing.T) {
+	defer cleanupFiles()
+	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`
+	initialLatencies := []nodeLatencyInfo{{Latency: 5, IP: "1.1.1.1", Port: 1809}, {Latency: 50, IP: "2.2.2.2", Port: 1809}}
+	updatedLatencies := []nodeLatencyInfo{{Latency: 5, IP: "2.2.2.2", Port: 1809}, {Latency: 50, IP: "1.1.1.1", Port: 1809}}
+	nodeModel := message.NodeModel{
+		NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
+		ExternalIP: "11.113.164.111",
+		Protocol:   "Ethereum",
+		Network:    "Mainnet",
+	}
+
+	sslCerts := cert.SSLCerts{}
+	handler, _ := mockRelaysServer(t, jsonRespRelays)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+	defer server.Close()
+
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "", WithRelayReevaluationInterval(10*time.Millisecond)).(*realSDNHTTP)
+	latencyChanged := make(chan struct{})
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		select {
+		case <-latencyChanged:
+			return updatedLatencies
+		default:
+			return initialLatencies
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relayInstructions := make(chan RelayInstruction, 10)
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	require.NoError(t, sdn.DirectRelayConnectionsContext(ctx, "auto", 1, relayInstructions, ignoredRelays))
+
+	select {
+	case instruction := <-relayInstructions:
+		assert.Equal(t, RelayInstruction{IP: "1.1.1.1", Port: 1809, Type: Connect}, instruction)
+	case <-time.After(time.Second):
+		require.Fail(t, "expected connect instruction")
+	}
+
+	close(latencyChanged)
+	select {
+	case instruction := <-relayInstructions:
+		assert.Equal(t, Switch, instruction.Type)
+		assert.Equal(t, "1.1.1.1", instruction.IP)
+		require.Len(t, instruction.RelaysToSwitch, 1)
+		assert.Equal(t, "2.2.2.2", instruction.RelaysToSwitch[0].IP)
+	case <-time.After(time.Second):
+		require.Fail(t, "expected switch instruction")
+	}
+
+	// the gateway has not acted on the switch yet, so the loop stops once ctx is done
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	for len(relayInstructions) > 0 {
+		<-relayInstructions
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, relayInstructions)
+}
+
+func TestClose_StopsGoroutines(t *testing.T) {
+	defer cleanupFiles()
+	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}]`
+	nodeModel := message.NodeModel{
+		NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
+		ExternalIP: "11.113.164.111",
+		Protocol:   "Ethereum",
+		Network:    "Mainnet",
+	}
+
+	sslCerts := cert.SSLCerts{}
+	handler, _ := mockRelaysServer(t, jsonRespRelays)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+	defer server.Close()
+	baseline := runtime.NumGoroutine()
+
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "", WithRelayReevaluationInterval(10*time.Millisecond)).(*realSDNHTTP)
+	sdn.findNewRelayBackoff = 10 * time.Millisecond
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{{Latency: 5, IP: "1.1.1.1", Port: 1809}}
+	}
+
+	relayInstructions := make(chan RelayInstruction, 10)
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	require.NoError(t, sdn.DirectRelayConnectionsContext(context.Background(), "auto", 1, relayInstructions, ignoredRelays))
+	select {
+	case <-relayInstructions:
+	case <-time.After(time.Second):
+		require.Fail(t, "expected connect instruction")
+	}
+	// the only relay is connected, so FindNewRelay keeps retrying until the client is closed
+	findNewRelayDone := make(chan struct{})
+	go func() {
+		defer close(findNewRelayDone)
+		sdn.FindNewRelay(context.Background(), "2.2.2.2", 1809, make(chan RelayInstruction, 10), ignoredRelays)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Greater(t, runtime.NumGoroutine(), baseline)
+
+	require.NoError(t, sdn.Close())
+	select {
+	case <-findNewRelayDone:
+	case <-time.After(time.Second):
+		require.Fail(t, "expected FindNewRelay to return after Close")
+	}
+	// not assert.Eventually, which runs the condition in its own goroutine
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), baseline, "goroutines leaked after Close")
+}
+
+func TestHttpClient_SharedTransport(t *testing.T) {
+	sdn := &realSDNHTTP{sslCerts: &cert.SSLCerts{}}
+	client, err := sdn.httpClient()
+	require.NoError(t, err)
+	other, err := sdn.httpClient()
+	require.NoError(t, err)
+	assert.Same(t, client.Transport, other.Transport)
+
+	sdn.closeTransport()
+	other, err = sdn.httpClient()
+	require.NoError(t, err)
+	assert.NotSame(t, client.Transport, other.Transport)
+}
+
+func TestWaitForRelayConnection(t *testing.T) {
+	defer cleanupFiles()
+	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}]`
+	nodeModel := message.NodeModel{
+		NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
+		ExternalIP: "11.113.164.111",
+		Protocol:   "Ethereum",
+		Network:    "Mainnet",
+	}
+
+	sslCerts := cert.SSLCerts{}
+	handler, _ := mockRelaysServer(t, jsonRespRelays)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+	defer server.Close()
+
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "").(*realSDNHTTP)
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{{Latency: 5, IP: "1.1.1.1", Port: 1809}}
+	}
+
+	// no relay was selected yet
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, sdn.WaitForRelayConnection(ctx), context.DeadlineExceeded)
+
+	relayInstructions := make(chan RelayInstruction)
+	require.NoError(t, sdn.DirectRelayConnections("auto", 1, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]()))
+
+	waitErr := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		waitErr <- sdn.WaitForRelayConnection(ctx)
+	}()
+
+	// the instruction is unbuffered, so the wait unblocks only after the gateway received it
+	assert.Equal(t, "1.1.1.1", (<-relayInstructions).IP)
+	assert.NoError(t, <-waitErr)
+}
+
+func TestFindFastestRelays_LatencySink(t *testing.T) {
+	defer cleanupFiles()
+	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1810}]`
+	latencies := []nodeLatencyInfo{{Latency: 5, IP: "1.1.1.1", Port: 1809}, {Latency: PingTimeout, IP: "2.2.2.2", Port: 1810}}
+	nodeModel := message.NodeModel{
+		NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
+		ExternalIP: "11.113.164.111",
+		Protocol:   "Ethereum",
+		Network:    "Mainnet",
+	}
+
+	sslCerts := cert.SSLCerts{}
+	handler, _ := mockRelaysServer(t, jsonRespRelays)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+	defer server.Close()
+
+	var samples []LatencySample
+	sink := func(sample LatencySample) { samples = append(samples, sample) }
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "", WithLatencySink(sink)).(*realSDNHTTP)
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return latencies
+	}
+
+	sdn.FindFastestRelays(make(chan RelayInstruction, 2), syncmap.NewStringMapOf[types.RelayInfo]())
+
+	require.Len(t, samples, 2)
+	assert.Equal(t, "1.1.1.1", samples[0].IP)
+	assert.Equal(t, int64(1809), samples[0].Port)
+	assert.Equal(t, 5.0, samples[0].Latency)
+	assert.True(t, samples[0].Reachable)
+	assert.False(t, samples[0].Timestamp.IsZero())
+	assert.Equal(t, "2.2.2.2", samples[1].IP)
+	assert.Equal(t, int64(1810), samples[1].Port)
+	assert.False(t, samples[1].Reachable)
+}
+
+func TestDirectRelayConnections_RelayLimit2(t *testing.T) {
+	jsonRespRelays := `[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`
+	latencies := []nodeLatencyInfo{{Latency: 5, IP: "1.1.1.1", Port: 1809}, {Latency: 6, IP: "2.2.2.2", Port: 1809}}
+	nodeModel := message.NodeModel{
+		NodeID:     "35299c61-55ad-4565-85a3-0cd985953fac",
+		ExternalIP: "11.113.164.111",
+		Protocol:   "Ethereum",
+		Network:    "Mainnet",
+	}
+	IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
+
+	testTable := []struct {
+		name           string
+		relaysString   string
+		expectedRelays relayMap
+		expectedError  error
+	}{
+		{
+			name:           "one auto",
+			relaysString:   "auto",
+			expectedRelays: relayMap{"1.1.1.1": 1809},
+		},
+		{
+			name:           "two autos",
+			relaysString:   "auto, auto",
+			expectedRelays: relayMap{"1.1.1.1": 1809, "2.2.2.2": 1809},
+		},
+		{
+			name:           "an auto and a relay",
+			relaysString:   "auto, 1.1.1.1",
+			expectedRelays: relayMap{"1.1.1.1": 1809, "2.2.2.2": 1809},
+		},
+		{
+			name:           "one relay",
+			relaysString:   "1.1.1.1",
+			expectedRelays: relayMap{"1.1.1.1": 1809},
+		},
+		{
+			name:           "two relays",
+			relaysString:   "1.1.1.1, 2.2.2.2",
+			expectedRelays: relayMap{"1.1.1.1": 1809, "2.2.2.2": 1809},
+		},
+		{
+			name:           "two relays, only one has port",
+			relaysString:   "1.1.1.1:34, 2.2.2.2",
+			expectedRelays: relayMap{"1.1.1.1": 34, "2.2.2.2": 1809},
+		},
+		{
+			name:           "two relays, both have ports",
+			relaysString:   "1.1.1.1:34, 2.2.2.2:56",
+			expectedRelays: relayMap{"1.1.1.1": 34, "2.2.2.2": 56},
+		},
+		{
+			name:           "three relays",
+			relaysString:   "4.4.4.4, 2.2.2.2:22, 1.1.1.1",
+			expectedRelays: relayMap{"4.4.4.4": 1809, "2.2.2.2": 22},
 		},
 		{
 			name:          "incorrect port",
@@ -439,7 +1437,7 @@ func TestDirectRelayConnections_RelayLimit2(t *testing.T) {
 			}()
 
 			sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "").(*realSDNHTTP)
-			getPingLatenciesFunction := func(peers message.Peers) []nodeLatencyInfo {
+			getPingLatenciesFunction := func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
 				return latencies
 			}
 			sdn.getPingLatencies = getPingLatenciesFunction
@@ -565,7 +1563,7 @@ func TestDirectRelayConnections_RelayLimit1(t *testing.T) {
 			}()
 
 			sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "").(*realSDNHTTP)
-			getPingLatenciesFunction := func(peers message.Peers) []nodeLatencyInfo {
+			getPingLatenciesFunction := func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
 				return latencies
 			}
 			sdn.getPingLatencies = getPingLatenciesFunction
@@ -602,7 +1600,6 @@ func TestDirectRelayConnections_RelayLimit1(t *testing.T) {
 }
 
 func TestDirectRelayConnections_UpdateAutoRelays(t *testing.T) {
-	t.Skip()
 	testTable := []struct {
 		name                      string
 		relaysArgument            string
@@ -689,7 +1686,6 @@ func TestDirectRelayConnections_UpdateAutoRelays(t *testing.T) {
 			},
 			expectedInitialAutoRelays: relayMap{
 				"10.10.10.10": 10,
-				"":            0,
 			},
 			addPingLatencies: []nodeLatencyInfo{
 				{IP: "7.7.7.7", Port: 7, Latency: 7},
@@ -704,30 +1700,13 @@ func TestDirectRelayConnections_UpdateAutoRelays(t *testing.T) {
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			s := testSDNHTTP()
-			s.getPingLatencies = func(peers message.Peers) []nodeLatencyInfo {
-				return testCase.initialPingLatencies
-			}
-
-			relayInstructions := make(chan RelayInstruction)
-			go func() {
-				for {
-					<-relayInstructions
-				}
-			}()
-
-			err := s.DirectRelayConnections(testCase.relaysArgument, 2, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]())
-			require.Nil(t, err)
-			time.Sleep(time.Millisecond * 2)
-
-			testCase.initialPingLatencies = append(testCase.addPingLatencies, testCase.initialPingLatencies...)
-			time.Sleep(time.Millisecond * 5)
+			testAutoRelayRounds(t, testCase.relaysArgument, testCase.initialPingLatencies, testCase.expectedInitialAutoRelays,
+				autoRelayTestRound{addPingLatencies: testCase.addPingLatencies, expectedAutoRelays: testCase.expectedFinalAutoRelays})
 		})
 	}
 }
 
 func TestDirectRelayConnections_UpdateAutoRelaysTwice(t *testing.T) {
-	t.Skip()
 	testTable := []struct {
 		name                    string
 		relaysArgument          string
@@ -769,28 +1748,95 @@ func TestDirectRelayConnections_UpdateAutoRelaysTwice(t *testing.T) {
 
 	for _, testCase := range testTable {
 		t.Run(testCase.name, func(t *testing.T) {
-			s := testSDNHTTP()
-			s.getPingLatencies = func(peers message.Peers) []nodeLatencyInfo {
-				return testCase.initialPingLatencies
-			}
+			testAutoRelayRounds(t, testCase.relaysArgument, testCase.initialPingLatencies, testCase.expectedAutoRelays1,
+				autoRelayTestRound{addPingLatencies: testCase.addPingLatencies1, expectedAutoRelays: testCase.expectedAutoRelays2},
+				autoRelayTestRound{addPingLatencies: testCase.addPingLatencies2, expectedAutoRelays: testCase.expectedFinalAutoRelays})
+		})
+	}
+}
 
-			relayInstructions := make(chan RelayInstruction)
-			go func() {
-				for {
-					<-relayInstructions
-				}
-			}()
+// autoRelayTestRound is a re-evaluation of the auto relays after faster relays become available
+type autoRelayTestRound struct {
+	addPingLatencies   []nodeLatencyInfo
+	expectedAutoRelays relayMap
+}
+
+// testAutoRelayRounds connects the auto relays of relaysArgument and re-evaluates them once per round,
+// driven by a mock clock, with a gateway switching each relay to the first suggested relay it is not connected to
+func testAutoRelayRounds(t *testing.T, relaysArgument string, initialPingLatencies []nodeLatencyInfo, expectedInitialAutoRelays relayMap, rounds ...autoRelayTestRound) {
+	defer cleanupFiles()
+	handler, _ := mockRelaysServer(t, `[{"ip":"1.1.1.1", "port":1809}]`)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+	defer server.Close()
+
+	const interval = time.Minute
+	mockClock := clock.NewMockClock()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockClock.SetTime(start)
+	sslCerts := cert.SSLCerts{}
+	nodeModel := message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111"}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "",
+		WithClock(mockClock), WithRelayReevaluationInterval(interval), WithLatencyThreshold(0)).(*realSDNHTTP)
+	defer func() { _ = sdn.Close() }()
+
+	var latenciesMu sync.Mutex
+	latencies := initialPingLatencies
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		latenciesMu.Lock()
+		defer latenciesMu.Unlock()
+		return slices.Clone(latencies)
+	}
 
-			err := s.DirectRelayConnections(testCase.relaysArgument, 2, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]())
-			require.Nil(t, err)
-			time.Sleep(time.Millisecond * 2)
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	tracker := NewRelayConnectionTracker(ignoredRelays)
+	relayInstructions := make(chan RelayInstruction)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case instruction := <-relayInstructions:
+				if instruction.Type != Switch {
+					continue
+				}
+				for _, newRelay := range instruction.RelaysToSwitch {
+					if tracker.IsTracked(newRelay.IP) {
+						continue
+					}
+					tracker.MarkDisconnected(instruction.IP, instruction.Port)
+					tracker.MarkAutoConnected(newRelay.IP, newRelay.Port)
+					break
+				}
+			}
+		}
+	}()
+	connectedAutoRelays := func() relayMap {
+		relays := make(relayMap)
+		for ip, relayInfo := range tracker.connectedAutoRelayInfos() {
+			relays[ip] = relayInfo.Port
+		}
+		return relays
+	}
 
-			testCase.initialPingLatencies = append(testCase.addPingLatencies1, testCase.initialPingLatencies...)
-			time.Sleep(time.Millisecond * 5)
+	require.NoError(t, sdn.DirectRelayConnectionsContext(ctx, relaysArgument, 2, relayInstructions, ignoredRelays))
+	require.Eventually(t, func() bool { return reflect.DeepEqual(expectedInitialAutoRelays, connectedAutoRelays()) },
+		time.Second, time.Millisecond)
+	for ip := range expectedInitialAutoRelays {
+		relayInfo, _ := tracker.Load(ip)
+		assert.Equal(t, start, relayInfo.TimeAdded)
+	}
 
-			testCase.initialPingLatencies = append(testCase.addPingLatencies2, testCase.initialPingLatencies...)
-			time.Sleep(time.Millisecond * 5)
-		})
+	for _, round := range rounds {
+		latenciesMu.Lock()
+		latencies = append(slices.Clone(round.addPingLatencies), latencies...)
+		latenciesMu.Unlock()
+		// the clock keeps advancing in case the re-evaluation loop has not started yet
+		require.Eventually(t, func() bool {
+			mockClock.IncTime(interval)
+			return reflect.DeepEqual(round.expectedAutoRelays, connectedAutoRelays())
+		}, time.Second, 5*time.Millisecond)
 	}
 }
 
@@ -821,7 +1867,7 @@ func TestSDNHTTP_CacheFiles_ServiceUnavailable_SDN_BlockchainNetworks(t *testing
 		IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
 		// using bad sdn url so get/post to bxapi will fail
 		sdn := NewSDNHTTP(&sslCerts, server.URL, testCase.nodeModel, "").(*realSDNHTTP)
-		url := fmt.Sprintf("%v/blockchain-networks/%v", sdn.SDNURL(), testCase.networkNumber)
+		url := fmt.Sprintf("%v/blockchain-networks/%d", sdn.SDNURL(), testCase.networkNumber)
 
 		networks := generateNetworks()
 		// generate blockchainNetworks.json file which contains networks using UpdateCacheFile method
@@ -839,6 +1885,311 @@ func TestSDNHTTP_CacheFiles_ServiceUnavailable_SDN_BlockchainNetworks(t *testing
 	})
 }
 
+func TestSDNHTTP_CacheFiles_ServiceUnavailable_CorruptCache(t *testing.T) {
+	defer cleanupFiles()
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: mockServiceError(t, 503, `{"message": "503 Service Unavailable" }`)},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "").(*realSDNHTTP)
+
+	// a cache file truncated by a crash while it was written
+	require.NoError(t, OSCacheFS.WriteFile(blockchainNetworkCacheFileName, []byte(`{"version":1,"payload":{"network":"Mainnet", "netw`), DefaultDataDirMode))
+	_, err := LoadCacheFile("", blockchainNetworkCacheFileName)
+	assert.ErrorIs(t, err, ErrCorruptCacheFile)
+
+	resp, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	assert.Nil(t, resp)
+	assert.ErrorIs(t, err, ErrSDNUnavailable)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	testTable := []struct {
+		name       string
+		retryAfter string
+		expected   time.Duration
+	}{
+		{name: "missing", retryAfter: "", expected: 0},
+		{name: "seconds", retryAfter: "120", expected: 2 * time.Minute},
+		{name: "zero seconds", retryAfter: "0", expected: 0},
+		{name: "negative seconds", retryAfter: "-5", expected: 0},
+		{name: "http date", retryAfter: now.Add(90 * time.Second).Format(http.TimeFormat), expected: 90 * time.Second},
+		{name: "http date in the past", retryAfter: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0},
+		{name: "invalid", retryAfter: "soon", expected: 0},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, parseRetryAfter(testCase.retryAfter, now))
+		})
+	}
+}
+
+func TestSDNHTTP_ServiceUnavailable_RetryAfter(t *testing.T) {
+	retryAfter := ""
+	router := mux.NewRouter()
+	router.HandleFunc("/blockchain-networks/{networkNum}", func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}).Methods("GET")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	testCerts := SetupTestCerts()
+	sdn := realSDNHTTP{sdnURL: server.URL, sslCerts: &testCerts}
+
+	retryAfter = "30"
+	_, err := sdn.http(server.URL+"/blockchain-networks/5", http.MethodGet, nil)
+	assert.ErrorIs(t, err, ErrSDNUnavailable)
+	interval, ok := RetryAfter(err)
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, interval)
+	assert.EqualError(t, err, "SDN service unavailable, retry after 30s")
+
+	retryAfter = ""
+	_, err = sdn.http(server.URL+"/blockchain-networks/5", http.MethodGet, nil)
+	assert.ErrorIs(t, err, ErrSDNUnavailable)
+	_, ok = RetryAfter(err)
+	assert.False(t, ok)
+}
+
+func TestSDNHTTP_CacheFiles_ServiceUnavailable_IncompatibleCache(t *testing.T) {
+	defer cleanupFiles()
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: mockServiceError(t, 503, `{"message": "503 Service Unavailable" }`)},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "").(*realSDNHTTP)
+
+	testTable := []struct {
+		name    string
+		content string
+	}{
+		{name: "written before the envelope", content: `{"network":"Mainnet", "network_num":5}`},
+		{name: "other version", content: `{"version":2,"saved_at":"2024-03-01T12:00:00Z","payload":{"network":"Mainnet", "network_num":5}}`},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			require.NoError(t, OSCacheFS.WriteFile(blockchainNetworkCacheFileName, []byte(testCase.content), DefaultDataDirMode))
+			_, err := LoadCacheFile("", blockchainNetworkCacheFileName)
+			assert.ErrorIs(t, err, ErrIncompatibleCacheFile)
+
+			// the incompatible cache file is treated as no cache
+			resp, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+			assert.Nil(t, resp)
+			assert.ErrorIs(t, err, ErrSDNUnavailable)
+			assert.NotErrorIs(t, err, ErrIncompatibleCacheFile)
+		})
+	}
+}
+
+func TestSDNHTTP_FetchBlockchainNetworkNum(t *testing.T) {
+	defer cleanupFiles()
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"network":"Network%[1]v", "network_num":%[1]v, "protocol":"Ethereum"}`, mux.Vars(r)["networkNum"])
+	}}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1", BlockchainNetworkNum: 5}, "").(*realSDNHTTP)
+
+	// a network the node is not registered on
+	require.NoError(t, sdn.FetchBlockchainNetworkNum(10))
+	require.NoError(t, sdn.FetchBlockchainNetwork())
+	for _, networkNum := range []types.NetworkNum{5, 10} {
+		network, err := sdn.FindNetwork(networkNum)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("Network%d", networkNum), network.Network)
+		_, err = LoadCacheFile("", networkCacheFileName(blockchainNetworkCacheFileName, networkNum))
+		assert.NoError(t, err)
+	}
+}
+
+func TestSDNHTTP_CacheFiles_CreatesDataDir(t *testing.T) {
+	handler, _ := mockBlockchainNetworkServer(t, `{"network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler}})
+	defer server.Close()
+
+	dataDir := path.Join(t.TempDir(), "nested", "datadir")
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, dataDir, WithDataDirMode(0700)).(*realSDNHTTP)
+
+	resp, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	require.NoError(t, err)
+
+	cached, err := LoadCacheFile(dataDir, blockchainNetworkCacheFileName)
+	require.NoError(t, err)
+	assert.Equal(t, resp, cached)
+
+	info, err := os.Stat(dataDir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
+
+func TestSDNHTTP_RequestObserver(t *testing.T) {
+	defer cleanupFiles()
+	handler, _ := mockBlockchainNetworkServer(t, `{"network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`)
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler},
+		{method: "POST", pattern: "/nodes", handler: mockServiceError(t, 503, `{"message": "503 Service Unavailable" }`)},
+	})
+	defer server.Close()
+
+	var outcomes []RequestOutcome
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "",
+		WithRequestObserver(func(outcome RequestOutcome) { outcomes = append(outcomes, outcome) })).(*realSDNHTTP)
+
+	_, err := sdn.httpWithCache(server.URL+"/blockchain-networks/5", http.MethodGet, blockchainNetworkCacheFileName, nil)
+	require.NoError(t, err)
+
+	// the node model is served from the cache file because the SDN is unavailable
+	writeToFile(t, generateNodeModel(), nodeModelCacheFileName)
+	_, err = sdn.httpWithCache(server.URL+"/nodes", http.MethodPost, nodeModelCacheFileName, bytes.NewBuffer(sdn.NodeModel().Pack()))
+	require.NoError(t, err)
+
+	require.Len(t, outcomes, 2)
+	assert.Equal(t, "/blockchain-networks/5", outcomes[0].Endpoint)
+	assert.Equal(t, http.MethodGet, outcomes[0].Method)
+	assert.Equal(t, http.StatusOK, outcomes[0].StatusCode)
+	assert.NoError(t, outcomes[0].Err)
+	assert.Positive(t, outcomes[0].Duration)
+
+	assert.Equal(t, "/nodes", outcomes[1].Endpoint)
+	assert.Equal(t, http.MethodPost, outcomes[1].Method)
+	assert.Equal(t, http.StatusServiceUnavailable, outcomes[1].StatusCode)
+	assert.ErrorIs(t, outcomes[1].Err, ErrSDNUnavailable)
+}
+
+func TestSDNHTTP_FallbackSDNURLs(t *testing.T) {
+	defer cleanupFiles()
+	var primaryRequests, fallbackRequests atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"details": "internal error"}`))
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackRequests.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		_, _ = w.Write(body)
+	}))
+	defer fallback.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, primary.URL, message.NodeModel{}, "", WithFallbackSDNURLs(fallback.URL)).(*realSDNHTTP)
+
+	// the request is retried on the fallback SDN, including the request body
+	resp, err := sdn.http(primary.URL+"/nodes", http.MethodPost, bytes.NewBufferString(`{"node_id":"1"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"node_id":"1"}`, string(resp))
+	assert.Equal(t, int32(1), primaryRequests.Load())
+	assert.Equal(t, int32(1), fallbackRequests.Load())
+	assert.Equal(t, fallback.URL, sdn.currentSDNURL())
+	assert.Equal(t, primary.URL, sdn.SDNURL())
+
+	// the healthy fallback SDN is preferred by subsequent requests
+	_, err = sdn.http(primary.URL+"/blockchain-networks", http.MethodGet, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), primaryRequests.Load())
+	assert.Equal(t, int32(2), fallbackRequests.Load())
+
+	// client errors are not retried on other SDNs
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"details": "not found"}`))
+	}))
+	defer notFound.Close()
+	sdn = NewSDNHTTP(&sslCerts, notFound.URL, message.NodeModel{}, "", WithFallbackSDNURLs(fallback.URL)).(*realSDNHTTP)
+	_, err = sdn.http(notFound.URL+"/nodes", http.MethodGet, nil)
+	require.Error(t, err)
+	assert.Equal(t, int32(2), fallbackRequests.Load())
+}
+
+func TestSDNHTTP_FallbackSDNURLs_Unavailable(t *testing.T) {
+	defer cleanupFiles()
+	unavailable := httptest.NewServer(http.HandlerFunc(mockServiceError(t, 503, `{"message": "503 Service Unavailable" }`)))
+	defer unavailable.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, unavailable.URL, message.NodeModel{}, "", WithFallbackSDNURLs(down.URL)).(*realSDNHTTP)
+
+	// the cache file is used when no SDN is available
+	writeToFile(t, generateNodeModel(), nodeModelCacheFileName)
+	resp, err := sdn.httpWithCache(unavailable.URL+"/nodes", http.MethodPost, nodeModelCacheFileName, bytes.NewBuffer(sdn.NodeModel().Pack()))
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp)
+	assert.Equal(t, unavailable.URL, sdn.currentSDNURL())
+}
+
+func TestSDNHTTP_FallbackSDNURLs_DoAndPing(t *testing.T) {
+	var primaryRequests atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryRequests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"account_id": "a"}`))
+	}))
+	defer fallback.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, primary.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithFallbackSDNURLs(fallback.URL)).(*realSDNHTTP)
+	require.NoError(t, sdn.Ping(context.Background()))
+	assert.Equal(t, int32(1), primaryRequests.Load())
+	assert.Equal(t, fallback.URL, sdn.currentSDNURL())
+
+	sdn = NewSDNHTTP(&sslCerts, primary.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithFallbackSDNURLs(fallback.URL)).(*realSDNHTTP)
+	resp, err := sdn.Get("/accounts/quota-status", []byte(`{}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"account_id": "a"}`, string(resp))
+	assert.Equal(t, int32(2), primaryRequests.Load())
+	assert.Equal(t, fallback.URL, sdn.currentSDNURL())
+
+	// without a fallback SDN the server error response is returned as is
+	sdn = NewSDNHTTP(&sslCerts, primary.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "").(*realSDNHTTP)
+	resp, err = sdn.Get("/accounts/quota-status", nil)
+	require.NoError(t, err)
+	assert.Empty(t, resp)
+}
+
+func TestSDNHTTP_TrimSDNURL(t *testing.T) {
+	sdn := &realSDNHTTP{sdnURL: "https://sdn.example.com", fallbackSDNURLs: []string{"https://sdn.example.com.au", "https://backup.example.com/api/"}}
+
+	testTable := []struct {
+		uri      string
+		endpoint string
+		ok       bool
+	}{
+		{uri: "https://sdn.example.com", endpoint: "", ok: true},
+		{uri: "https://sdn.example.com/nodes", endpoint: "/nodes", ok: true},
+		{uri: "https://sdn.example.com?network=5", endpoint: "?network=5", ok: true},
+		{uri: "https://sdn.example.com.au/nodes", endpoint: "/nodes", ok: true},
+		{uri: "https://backup.example.com/api/nodes", endpoint: "nodes", ok: true},
+		{uri: "https://sdn.example.community/nodes", endpoint: "https://sdn.example.community/nodes"},
+		{uri: "https://relay.example.com/nodes", endpoint: "https://relay.example.com/nodes"},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.uri, func(t *testing.T) {
+			endpoint, ok := sdn.trimSDNURL(testCase.uri)
+			assert.Equal(t, testCase.ok, ok)
+			assert.Equal(t, testCase.endpoint, endpoint)
+		})
+	}
+}
+
 func TestSDNHTTP_CacheFiles_ServiceUnavailable_SDN_Node(t *testing.T) {
 	testCase := struct {
 		nodeModel                  message.NodeModel
@@ -906,20 +2257,27 @@ func TestSDNHTTP_CacheFiles_ServiceUnavailable_SDN_Relays(t *testing.T) {
 		IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
 		// using bad sdn url so get/post to bxapi will fail
 		sdn := NewSDNHTTP(&sslCerts, server.URL, testCase.nodeModel, "").(*realSDNHTTP)
-		url := fmt.Sprintf("%v/nodes/%v/%v/potential-relays", sdn.SDNURL(), sdn.NodeModel().NodeID, sdn.NodeModel().BlockchainNetworkNum)
+		url := fmt.Sprintf("%v/nodes/%v/%d/potential-relays", sdn.SDNURL(), sdn.NodeModel().NodeID, sdn.NodeModel().BlockchainNetworkNum)
 		peers := generatePeers()
-		// generate potentialrelays.json file which contains peers using UpdateCacheFile method
-		writeToFile(t, peers, potentialRelaysFileName)
+		// generate potentialrelays_5.json file which contains peers using UpdateCacheFile method
+		cacheFileName := networkCacheFileName(potentialRelaysFileName, testCase.nodeModel.BlockchainNetworkNum)
+		writeToFile(t, peers, cacheFileName)
+		// the cache file of another network sharing the data directory is not used
+		writeToFile(t, message.Peers{{IP: "9.9.9.9", Port: 1809}}, networkCacheFileName(potentialRelaysFileName, 6))
 
 		// calling to httpWithCache -> tying to get peers from bxapi
 		// bxapi is not responsive
 		// -> trying to load the peers from cache file
-		resp, err := sdn.httpWithCache(url, http.MethodGet, potentialRelaysFileName, nil)
+		resp, err := sdn.httpWithCache(url, http.MethodGet, cacheFileName, nil)
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 		cachedPeers := message.Peers{}
 		assert.Nil(t, json.Unmarshal(resp, &cachedPeers))
 		assert.Equal(t, peers, cachedPeers)
+
+		relays, err := sdn.getRelays(testCase.nodeModel.NodeID, testCase.nodeModel.BlockchainNetworkNum)
+		assert.NoError(t, err)
+		assert.Equal(t, peers, relays)
 	})
 }
 
@@ -961,92 +2319,1141 @@ func TestSDNHTTP_CacheFiles_ServiceUnavailable_SDN_Account(t *testing.T) {
 		assert.NoError(t, err)
 		assert.NotNil(t, resp)
 
-		cachedAccountModel := message.Account{}
-		assert.Nil(t, json.Unmarshal(resp, &cachedAccountModel))
-		assert.Equal(t, accountModel, cachedAccountModel)
-	})
+		cachedAccountModel := message.Account{}
+		assert.Nil(t, json.Unmarshal(resp, &cachedAccountModel))
+		assert.Equal(t, accountModel, cachedAccountModel)
+	})
+}
+
+func TestSDNHTTP_InitGateway(t *testing.T) {
+	testCase := struct {
+		nodeModel          message.NodeModel
+		networkNumber      types.NetworkNum
+		jsonRespNetwork    string
+		jsonRespRelays     string
+		jsonAccount        string
+		expectedRelayLimit message.BDNServiceLimit
+	}{
+		nodeModel:          message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet", AccountID: "e64yrte6547"},
+		networkNumber:      5,
+		jsonRespNetwork:    `{"min_tx_age_seconds":0,"min_tx_network_fee":0, "network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`,
+		jsonRespRelays:     `[{"ip":"8.208.101.30", "port":1809}, {"ip":"47.90.133.153", "port":1809}]`,
+		jsonAccount:        `{"account_id":"e64yrte6547","blockchain_protocol":"","blockchain_network":"","tier_name":"", "relay_limit":{"expire_date":"", "msg_quota": {"limit":0}}, "private_transaction_fee": {"expire_date": "2999-01-01", "msg_quota": {"interval": "WITHOUT_INTERVAL", "service_type": "MSG_QUOTA", "limit": 13614113913969504939, "behavior_limit_ok": "ALERT", "behavior_limit_fail": "BLOCK_ALERT"}}}`,
+		expectedRelayLimit: 2,
+	}
+	t.Run(fmt.Sprint(testCase), func(t *testing.T) {
+		defer cleanupFiles()
+
+		sslCerts := cert.NewSSLCertsPrivateKey(PrivateKey)
+		sslCerts.SavePrivateCert(PrivateCert)
+
+		handler1 := mockNodesServer(t, testCase.nodeModel.NodeID, testCase.nodeModel.ExternalPort, testCase.nodeModel.ExternalIP, testCase.nodeModel.Protocol, testCase.nodeModel.Network, testCase.networkNumber, testCase.nodeModel.AccountID)
+		handler2, _ := mockBlockchainNetworkServer(t, testCase.jsonRespNetwork)
+		handler3, _ := mockRelaysServer(t, testCase.jsonRespRelays)
+		handler4, _ := mockAccountServer(t, testCase.jsonAccount)
+
+		var m []handlerArgs
+		m = append(m, handlerArgs{method: "POST", pattern: "/nodes", handler: handler1})
+		m = append(m, handlerArgs{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler2})
+		m = append(m, handlerArgs{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler3})
+		m = append(m, handlerArgs{method: "GET", pattern: "/account/{accountID}", handler: handler4})
+
+		server := mockRouter(m)
+		defer func() {
+			server.Close()
+		}()
+
+		defer func() {
+			server.Close()
+		}()
+
+		IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
+		sdn := NewSDNHTTP(sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+
+		assert.Nil(t, sdn.InitGateway(types.EthereumProtocol, "Mainnet"))
+		assert.Equal(t, testCase.expectedRelayLimit, sdn.accountModel.RelayLimit.MsgQuota.Limit)
+	})
+}
+
+func TestSDNHTTP_InitGateway_Fail(t *testing.T) {
+	testCase := struct {
+		nodeModel                  message.NodeModel
+		networkNumber              types.NetworkNum
+		jsonRespServiceUnavailable string
+	}{
+		nodeModel:                  message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet", AccountID: "e64yrte6547"},
+		networkNumber:              5,
+		jsonRespServiceUnavailable: `{"message": "503 Service Unavailable" }`,
+	}
+	t.Run(fmt.Sprint(testCase), func(t *testing.T) {
+
+		sslCerts := cert.NewSSLCertsPrivateKey(PrivateKey)
+		sslCerts.SavePrivateCert(PrivateCert)
+
+		handler1 := mockServiceError(t, 503, testCase.jsonRespServiceUnavailable)
+		var m []handlerArgs
+		m = append(m, handlerArgs{method: "POST", pattern: "/nodes", handler: handler1})
+
+		server := mockRouter(m)
+		defer func() {
+			server.Close()
+		}()
+
+		IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
+		sdn := NewSDNHTTP(sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+
+		os.Remove(nodeModelCacheFileName)
+		err := sdn.InitGateway(types.EthereumProtocol, "Mainnet")
+		assert.NotNil(t, err)
+		assert.ErrorIs(t, err, ErrRegistrationFailed)
+	})
+}
+
+func TestSDNHTTP_InitGateway_PartialFailure(t *testing.T) {
+	nodeModel := message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet", AccountID: "e64yrte6547"}
+	jsonRespNetwork := `{"min_tx_age_seconds":0,"min_tx_network_fee":0, "network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`
+
+	testTable := []struct {
+		name          string
+		serveNetwork  bool
+		expectedError error
+	}{
+		{name: "network fetch fails", expectedError: ErrNetworkFetchFailed},
+		{name: "account fetch fails", serveNetwork: true, expectedError: ErrAccountFetchFailed},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			defer cleanupFiles()
+			sslCerts := cert.NewSSLCertsPrivateKey(PrivateKey)
+			sslCerts.SavePrivateCert(PrivateCert)
+
+			m := []handlerArgs{{method: "POST", pattern: "/nodes", handler: mockNodesServer(t, nodeModel.NodeID, nodeModel.ExternalPort, nodeModel.ExternalIP, nodeModel.Protocol, nodeModel.Network, 5, nodeModel.AccountID)}}
+			if testCase.serveNetwork {
+				handler, _ := mockBlockchainNetworkServer(t, jsonRespNetwork)
+				m = append(m, handlerArgs{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler})
+			}
+			server := mockRouter(m)
+			defer server.Close()
+
+			IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
+			sdn := NewSDNHTTP(sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+
+			err := sdn.InitGateway(types.EthereumProtocol, "Mainnet")
+			assert.ErrorIs(t, err, testCase.expectedError)
+			// the node model from the successful registration stays populated
+			assert.Equal(t, nodeModel.NodeID, sdn.NodeModel().NodeID)
+			assert.Equal(t, types.NetworkNum(5), sdn.NetworkNum())
+			if testCase.serveNetwork {
+				_, err = sdn.FindNetwork(5)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSDNHTTP_ConcurrentUse(t *testing.T) {
+	defer cleanupFiles()
+	jsonRespNetwork := `{"min_tx_age_seconds":1,"min_tx_network_fee":0, "network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`
+	handler, _ := mockBlockchainNetworkServer(t, jsonRespNetwork)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", BlockchainNetworkNum: 5}, "").(*realSDNHTTP)
+	sdn.SetNetworks(message.BlockchainNetworks{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.NoError(t, sdn.FetchBlockchainNetwork())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				assert.Equal(t, types.NetworkNum(5), sdn.NetworkNum())
+				assert.NotEmpty(t, sdn.NodeModel().NodeID)
+				_ = sdn.SnapshotNetworks()
+				_ = sdn.MinTxAge()
+			}
+		}()
+	}
+	wg.Wait()
+
+	network, err := sdn.FindNetwork(5)
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, network.MinTxAgeSeconds)
+}
+
+func TestSDNHTTP_FetchBlockchainNetwork_ZeroTerminalTotalDifficulty(t *testing.T) {
+	defer cleanupFiles()
+	handler, _ := mockBlockchainNetworkServer(t, `{"network":"Mainnet", "network_num":5,"protocol":"Ethereum","default_attributes":{"terminal_total_difficulty":0}}`)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1", BlockchainNetworkNum: 5}, "").(*realSDNHTTP)
+	sdn.SetNetworks(message.BlockchainNetworks{})
+
+	require.NoError(t, sdn.FetchBlockchainNetwork())
+	network, err := sdn.FindNetwork(5)
+	require.NoError(t, err)
+	// the sentinel does not depend on the platform word size
+	assert.Equal(t, "9223372036854775807", network.DefaultAttributes.TerminalTotalDifficulty.(*big.Int).String())
+	ttd := network.DefaultAttributes.TerminalTotalDifficulty.(*big.Int)
+
+	// refreshing the network keeps the sentinel without modifying the previous difficulty
+	require.NoError(t, sdn.FetchBlockchainNetwork())
+	network, err = sdn.FindNetwork(5)
+	require.NoError(t, err)
+	assert.Equal(t, message.PostMergeTerminalTotalDifficulty(), network.DefaultAttributes.TerminalTotalDifficulty)
+	assert.Equal(t, message.PostMergeTerminalTotalDifficulty(), ttd)
+}
+
+func TestSDNHTTP_FetchAllBlockchainNetworks_ApplyDefaults(t *testing.T) {
+	defer cleanupFiles()
+	networksJSON := `[{"network":"Mainnet","network_num":5,"protocol":"Ethereum","default_attributes":{"terminal_total_difficulty":0}},` +
+		`{"network":"BSC-Mainnet","network_num":10,"protocol":"Ethereum","min_tx_age_seconds":-1}]`
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/blockchain-networks", handler: func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(networksJSON))
+	}}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+	require.NoError(t, sdn.FetchAllBlockchainNetworks())
+
+	// the terminal total difficulty is set the same way as by FetchBlockchainNetwork
+	network, err := sdn.FindNetwork(5)
+	require.NoError(t, err)
+	assert.Equal(t, message.PostMergeTerminalTotalDifficulty(), network.DefaultAttributes.TerminalTotalDifficulty)
+	// the network with a negative min tx age is ignored
+	_, err = sdn.FindNetwork(10)
+	assert.Error(t, err)
+}
+
+func TestSDNHTTP_RootCAsPEM(t *testing.T) {
+	caPEM, serverCert := generateSelfSignedCA(t)
+	otherCAPEM, _ := generateSelfSignedCA(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	testCerts := SetupTestCerts()
+	nodeModel := message.NodeModel{ExternalIP: "172.0.0.1"}
+
+	sdn := NewSDNHTTP(&testCerts, server.URL, nodeModel, "", WithRootCAsPEM(caPEM)).(*realSDNHTTP)
+	_, err := sdn.http(server.URL, http.MethodGet, nil)
+	assert.NoError(t, err)
+
+	sdn = NewSDNHTTP(&testCerts, server.URL, nodeModel, "", WithRootCAsPEM(otherCAPEM)).(*realSDNHTTP)
+	_, err = sdn.http(server.URL, http.MethodGet, nil)
+	assert.ErrorContains(t, err, "certificate signed by unknown authority")
+
+	sdn = NewSDNHTTP(&testCerts, server.URL, nodeModel, "", WithRootCAsPEM([]byte("not a certificate"))).(*realSDNHTTP)
+	_, err = sdn.http(server.URL, http.MethodGet, nil)
+	assert.ErrorContains(t, err, "could not parse the additional SDN root certificates")
+}
+
+func TestSDNHTTP_InsecureSkipVerify(t *testing.T) {
+	_, serverCert := generateSelfSignedCA(t)
+	otherCAPEM, _ := generateSelfSignedCA(t)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	nodeModel := message.NodeModel{ExternalIP: "172.0.0.1"}
+
+	// without SSL certs the self-signed server certificate is verified
+	sdn := NewSDNHTTP(nil, server.URL, nodeModel, "").(*realSDNHTTP)
+	_, err := sdn.http(server.URL, http.MethodGet, nil)
+	assert.ErrorContains(t, err, "certificate signed by unknown authority")
+
+	sdn = NewSDNHTTP(nil, server.URL, nodeModel, "", WithInsecureSkipVerify(true)).(*realSDNHTTP)
+	_, err = sdn.http(server.URL, http.MethodGet, nil)
+	assert.NoError(t, err)
+
+	// the verification is skipped even with root certificates which did not sign the server certificate
+	testCerts := SetupTestCerts()
+	sdn = NewSDNHTTP(&testCerts, server.URL, nodeModel, "", WithRootCAsPEM(otherCAPEM), WithInsecureSkipVerify(true)).(*realSDNHTTP)
+	_, err = sdn.http(server.URL, http.MethodGet, nil)
+	assert.NoError(t, err)
+}
+
+func generateSelfSignedCA(t *testing.T) ([]byte, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestGetPingLatencies_ContextDone(t *testing.T) {
+	peers := message.Peers{{IP: "1.1.1.1", Port: 1809}, {IP: "2.2.2.2", Port: 1810}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pingLatencies := getPingLatencies(ctx, peers)
+	require.Len(t, pingLatencies, 2)
+	for _, pingLatency := range pingLatencies {
+		assert.Equal(t, PingTimeout, pingLatency.Latency)
+	}
+}
+
+func TestSDNHTTP_PingRelays_Timeout(t *testing.T) {
+	sdn := &realSDNHTTP{pingRelaysTimeout: 20 * time.Millisecond}
+	sdn.getPingLatencies = func(ctx context.Context, peers message.Peers) []nodeLatencyInfo {
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(20*time.Millisecond), deadline, 20*time.Millisecond)
+		<-ctx.Done()
+		return []nodeLatencyInfo{{IP: peers[0].IP, Port: peers[0].Port, Latency: PingTimeout}}
+	}
+
+	start := time.Now()
+	pingLatencies := sdn.pingRelays(context.Background(), message.Peers{{IP: "1.1.1.1", Port: 1809}})
+	assert.Less(t, time.Since(start), time.Second)
+	require.Len(t, pingLatencies, 1)
+	assert.Equal(t, PingTimeout, pingLatencies[0].Latency)
+}
+
+func TestSDNHTTP_PingRelays_PingCountTimeout(t *testing.T) {
+	sdn := &realSDNHTTP{}
+	WithPingCount(5)(sdn)
+	sdn.getPingLatencies = func(ctx context.Context, peers message.Peers) []nodeLatencyInfo {
+		deadline, ok := ctx.Deadline()
+		require.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(defaultPingRelaysTimeout+4*time.Second), deadline, time.Second)
+		return []nodeLatencyInfo{{IP: peers[0].IP, Port: peers[0].Port, Latency: 10}}
+	}
+
+	pingLatencies := sdn.pingRelays(context.Background(), message.Peers{{IP: "1.1.1.1", Port: 1809}})
+	require.Len(t, pingLatencies, 1)
+	assert.Equal(t, float64(10), pingLatencies[0].Latency)
+}
+
+func TestSDNHTTP_PingRelays_UnreachableRelaysExcluded(t *testing.T) {
+	relays := message.Peers{{IP: "1.1.1.1", Port: 1809}, {IP: "2.2.2.2", Port: 1809}, {IP: "3.3.3.3", Port: 1809}}
+	getPingLatencies := func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{
+			{IP: "2.2.2.2", Port: 1809, Latency: 10},
+			{IP: "1.1.1.1", Port: 1809, Latency: PingTimeout},
+			{IP: "3.3.3.3", Port: 1809, Latency: PingTimeout},
+		}
+	}
+
+	sdn := &realSDNHTTP{getPingLatencies: getPingLatencies}
+	assert.Len(t, sdn.pingRelays(context.Background(), relays), 3)
+
+	var samples []LatencySample
+	sdn = &realSDNHTTP{getPingLatencies: getPingLatencies}
+	WithUnreachableRelaysExcluded()(sdn)
+	WithLatencySink(func(sample LatencySample) { samples = append(samples, sample) })(sdn)
+	pingLatencies := sdn.pingRelays(context.Background(), relays)
+	require.Len(t, pingLatencies, 1)
+	assert.Equal(t, "2.2.2.2", pingLatencies[0].IP)
+	assert.Len(t, samples, 3)
+
+	// no auto relay is connected if none of the relays answered
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{{IP: "1.1.1.1", Port: 1809, Latency: PingTimeout}}
+	}
+	relayInstructions := make(chan RelayInstruction, 1)
+	sdn.nodeModel = &message.NodeModel{}
+	sdn.manageAutoRelays(context.Background(), 1, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	assert.Empty(t, relayInstructions)
+}
+
+func TestSDNHTTP_FetchAllBlockchainNetworks_ChangeHandler(t *testing.T) {
+	defer cleanupFiles()
+	var networks atomic.Value
+	networks.Store(`[{"network":"Mainnet","network_num":5,"min_tx_age_seconds":1},{"network":"BSC-Mainnet","network_num":10}]`)
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks", handler: mockChangingRelaysServer(&networks)},
+	})
+	defer server.Close()
+
+	var diffs []message.BlockchainNetworksDiff
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{}, "",
+		WithNetworksChangeHandler(func(diff message.BlockchainNetworksDiff) { diffs = append(diffs, diff) })).(*realSDNHTTP)
+
+	require.NoError(t, sdn.FetchAllBlockchainNetworks())
+	require.Len(t, diffs, 1)
+	assert.Equal(t, []types.NetworkNum{5, 10}, diffs[0].Added)
+	assert.Empty(t, diffs[0].Removed)
+	assert.Empty(t, diffs[0].Changed)
+
+	// unchanged networks are not reported
+	require.NoError(t, sdn.FetchAllBlockchainNetworks())
+	require.Len(t, diffs, 1)
+
+	networks.Store(`[{"network":"Mainnet","network_num":5,"min_tx_age_seconds":2},{"network":"Holesky","network_num":8}]`)
+	require.NoError(t, sdn.FetchAllBlockchainNetworks())
+	require.Len(t, diffs, 2)
+	assert.Equal(t, []types.NetworkNum{8}, diffs[1].Added)
+	assert.Equal(t, []types.NetworkNum{10}, diffs[1].Removed)
+	assert.Equal(t, map[types.NetworkNum][]string{5: {"min_tx_age_seconds"}}, diffs[1].Changed)
+}
+
+func TestSDNHTTP_RequestHeaders(t *testing.T) {
+	var userAgents, requestIDs []string
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks", handler: func(w http.ResponseWriter, r *http.Request) {
+			userAgents = append(userAgents, r.UserAgent())
+			requestIDs = append(requestIDs, r.Header.Get(RequestIDHeader))
+			_, _ = w.Write([]byte(`[]`))
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	nodeModel := message.NodeModel{SourceVersion: "2.1.0", NodeType: "EXTERNAL_GATEWAY"}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, nodeModel, "").(*realSDNHTTP)
+	_, err := sdn.http(server.URL+"/blockchain-networks", http.MethodGet, nil)
+	require.NoError(t, err)
+	_, err = sdn.Get("/blockchain-networks", nil)
+	require.NoError(t, err)
+
+	sdn = NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{}, "", WithUserAgentPrefix("gateway")).(*realSDNHTTP)
+	_, err = sdn.http(server.URL+"/blockchain-networks", http.MethodGet, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"bxcommon-go/2.1.0 (EXTERNAL_GATEWAY)", "bxcommon-go/2.1.0 (EXTERNAL_GATEWAY)", "gateway"}, userAgents)
+	require.Len(t, requestIDs, 3)
+	for _, requestID := range requestIDs {
+		assert.NoError(t, uuid.Validate(requestID))
+	}
+	assert.NotEqual(t, requestIDs[0], requestIDs[1])
+}
+
+func TestSDNHTTP_DoWithHeaders(t *testing.T) {
+	var received http.Header
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/accounts/quota-status", handler: func(w http.ResponseWriter, r *http.Request) {
+			received = r.Header.Clone()
+			_, _ = w.Write([]byte(`{}`))
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+	headers := http.Header{}
+	headers.Set("X-Api-Key", "secret")
+	headers.Add("X-Tenant-Id", "a")
+	headers.Add("X-Tenant-Id", "b")
+	headers.Set("Content-Type", "text/plain")
+	headers.Set(RequestIDHeader, "request")
+	resp, err := sdn.Do(http.MethodPost, "/accounts/quota-status", []byte(`{}`), headers)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(resp))
+
+	assert.Equal(t, "secret", received.Get("X-Api-Key"))
+	assert.Equal(t, []string{"a", "b"}, received.Values("X-Tenant-Id"))
+	// the headers set by the SDN client are kept
+	assert.Equal(t, []string{"application/json"}, received.Values("Content-Type"))
+	assert.NoError(t, uuid.Validate(received.Get(RequestIDHeader)))
+}
+
+func TestSDNHTTP_RefreshAccountModel(t *testing.T) {
+	defer cleanupFiles()
+	var account atomic.Value
+	account.Store(`{"account_id":"e64yrte6547","tier_name":"Enterprise","relay_limit":{"expire_date":"2999-01-01","msg_quota":{"limit":2}}}`)
+	var failing atomic.Bool
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/account/{accountID}", handler: func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"details": "internal error"}`))
+				return
+			}
+			mockChangingRelaysServer(&account)(w, r)
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{AccountID: "e64yrte6547"}, "").(*realSDNHTTP)
+	require.NoError(t, sdn.getAccountModel("e64yrte6547"))
+	assert.Equal(t, message.BDNServiceLimit(2), sdn.AccountModel().RelayLimit.MsgQuota.Limit)
+
+	// the limits were raised
+	account.Store(`{"account_id":"e64yrte6547","tier_name":"Enterprise","relay_limit":{"expire_date":"2999-01-01","msg_quota":{"limit":5}}}`)
+	refreshed, err := sdn.RefreshAccountModel()
+	require.NoError(t, err)
+	assert.Equal(t, message.BDNServiceLimit(5), refreshed.RelayLimit.MsgQuota.Limit)
+	assert.Equal(t, refreshed, sdn.AccountModel())
+
+	// a failed refresh keeps the account model
+	failing.Store(true)
+	_, err = sdn.RefreshAccountModel()
+	require.Error(t, err)
+	assert.Equal(t, refreshed, sdn.AccountModel())
+}
+
+func TestSDNHTTP_GetAccountModel(t *testing.T) {
+	defer cleanupFiles()
+	var account atomic.Value
+	account.Store(`{"account_id":"e64yrte6547","tier_name":"Enterprise","relay_limit":{"expire_date":"2999-01-01","msg_quota":{"limit":2}}}`)
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/account/{accountID}", handler: mockChangingRelaysServer(&account)},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{AccountID: "e64yrte6547"}, "").(*realSDNHTTP)
+	require.NoError(t, sdn.getAccountModel("e64yrte6547"))
+	live := sdn.AccountModel()
+
+	account.Store(`{"account_id":"e64yrte6547","tier_name":"Enterprise","relay_limit":{"expire_date":"2999-01-01","msg_quota":{"limit":5}}}`)
+	fetched, err := sdn.GetAccountModel("e64yrte6547")
+	require.NoError(t, err)
+	assert.Equal(t, message.BDNServiceLimit(5), fetched.RelayLimit.MsgQuota.Limit)
+	// the account model of the node is kept
+	assert.Equal(t, live, sdn.AccountModel())
+
+	// another account does not replace the cached account model of the node
+	account.Store(`{"account_id":"other-account","tier_name":"Developer"}`)
+	_, err = sdn.GetAccountModel("other-account")
+	require.NoError(t, err)
+	cached, err := LoadCacheFile("", accountCacheFileName(CacheEndpointAccount, "e64yrte6547"))
+	require.NoError(t, err)
+	assert.Contains(t, string(cached), `"limit":2`)
+	_, err = LoadCacheFile("", accountCacheFileName(CacheEndpointAccount, "other-account"))
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Empty(t, sdn.ResponsesFromCache())
+}
+
+func TestSDNHTTP_AccountModelLoaded(t *testing.T) {
+	defer cleanupFiles()
+	var failing atomic.Bool
+	failing.Store(true)
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/account/{accountID}", handler: func(w http.ResponseWriter, r *http.Request) {
+			if failing.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"details": "internal error"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"account_id":"e64yrte6547","tier_name":"Enterprise"}`))
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1", AccountID: "e64yrte6547"}, "").(*realSDNHTTP)
+
+	// the getters do not panic before the account model is loaded
+	assert.False(t, sdn.AccountModelLoaded())
+	assert.Equal(t, message.Account{}, sdn.AccountModel())
+	assert.Empty(t, sdn.AccountTier())
+
+	// a failed fetch does not load the account model
+	require.Error(t, sdn.getAccountModel("e64yrte6547"))
+	assert.False(t, sdn.AccountModelLoaded())
+
+	failing.Store(false)
+	require.NoError(t, sdn.getAccountModel("e64yrte6547"))
+	assert.True(t, sdn.AccountModelLoaded())
+	assert.Equal(t, message.AccountTier("Enterprise"), sdn.AccountTier())
+}
+
+func TestFixAccountLimits(t *testing.T) {
+	var accountModel message.Account
+	fixAccountLimits(&accountModel)
+	assert.Equal(t, message.BDNServiceLimit(1), accountModel.RelayLimit.MsgQuota.Limit)
+	assert.Equal(t, message.BDNServiceLimit(6), accountModel.MaxAllowedNodes.MsgQuota.Limit)
+
+	accountModel.RelayLimit.MsgQuota.Limit = 3
+	fixAccountLimits(&accountModel)
+	assert.Equal(t, message.BDNServiceLimit(3), accountModel.RelayLimit.MsgQuota.Limit)
+}
+
+func TestSDNHTTP_SendNodeEventSync(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var received []message.NodeEvent
+	server := mockRouter([]handlerArgs{
+		{method: "POST", pattern: "/nodes/{nodeID}/events", handler: func(w http.ResponseWriter, r *http.Request) {
+			var event message.NodeEvent
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			received = append(received, event)
+			w.WriteHeader(int(status.Load()))
+			_, _ = w.Write([]byte(`{"details": "event rejected"}`))
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+	event := message.NodeEvent{NodeID: "node", EventType: message.NodeEventType("ONLINE")}
+
+	require.NoError(t, sdn.SendNodeEventSync(context.Background(), event, "node"))
+	require.Len(t, received, 1)
+	assert.Equal(t, event.EventType, received[0].EventType)
+
+	status.Store(http.StatusBadRequest)
+	err := sdn.SendNodeEventSync(context.Background(), event, "node")
+	var statusErr *StatusError
+	require.ErrorAs(t, err, &statusErr)
+	assert.Equal(t, http.StatusBadRequest, statusErr.StatusCode)
+	assert.Equal(t, http.MethodPost, statusErr.Method)
+	assert.Contains(t, err.Error(), "event rejected")
+
+	status.Store(http.StatusServiceUnavailable)
+	assert.ErrorIs(t, sdn.SendNodeEventSync(context.Background(), event, "node"), ErrSDNUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, sdn.SendNodeEventSync(ctx, event, "node"), context.Canceled)
+	assert.Len(t, received, 3)
+}
+
+func TestSDNHTTP_FindNewRelay_Backoff(t *testing.T) {
+	cleanupFiles()
+	defer cleanupFiles()
+
+	var sdn *realSDNHTTP
+	var requests int64
+	var failuresSeen []int64
+	relaysHandler := func(w http.ResponseWriter, r *http.Request) {
+		failuresSeen = append(failuresSeen, sdn.RelayReconnectFailures())
+		if requests++; requests <= 4 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"message": "503 Service Unavailable" }`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"ip":"2.2.2.2", "port":1809}]`))
+	}
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: relaysHandler}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn = NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "").(*realSDNHTTP)
+	sdn.getPingLatencies = pingAllRelays
+	sdn.findNewRelayBackoff = time.Millisecond
+
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	relayInstructions := make(chan RelayInstruction, 1)
+	sdn.FindNewRelay(context.Background(), "1.1.1.1", 1809, relayInstructions, ignoredRelays)
+
+	assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, <-relayInstructions)
+	// the consecutive failures are counted until a new relay is found
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, failuresSeen)
+	assert.Equal(t, int64(0), sdn.RelayReconnectFailures())
+}
+
+func TestSDNHTTP_FindNewRelay_RetryAfter(t *testing.T) {
+	testTable := []struct {
+		name       string
+		retryAfter string
+		minWait    time.Duration
+		maxWait    time.Duration
+		step       time.Duration
+	}{
+		// the retry waits for the interval suggested by the SDN instead of the backoff
+		{name: "suggested interval", retryAfter: "60", minWait: time.Minute, maxWait: 2 * time.Minute, step: time.Second},
+		// but not longer than the max backoff
+		{name: "clamped", retryAfter: "86400", minWait: findNewRelayMaxBackoff, maxWait: findNewRelayMaxBackoff + time.Minute, step: 5 * time.Second},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			cleanupFiles()
+			defer cleanupFiles()
+
+			var requests atomic.Int64
+			relaysHandler := func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) == 1 {
+					w.Header().Set("Retry-After", testCase.retryAfter)
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = w.Write([]byte(`[{"ip":"2.2.2.2", "port":1809}]`))
+			}
+			server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: relaysHandler}})
+			defer server.Close()
+
+			mockClock := clock.NewMockClock()
+			start := mockClock.Now()
+			sslCerts := cert.SSLCerts{}
+			sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "", WithClock(mockClock)).(*realSDNHTTP)
+			sdn.getPingLatencies = pingAllRelays
+			sdn.findNewRelayBackoff = time.Hour
+
+			relayInstructions := make(chan RelayInstruction, 1)
+			go sdn.FindNewRelay(context.Background(), "1.1.1.1", 1809, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]())
+
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				select {
+				case instruction := <-relayInstructions:
+					assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, instruction)
+					waited := mockClock.Now().Sub(start)
+					assert.GreaterOrEqual(t, waited, testCase.minWait)
+					assert.Less(t, waited, testCase.maxWait)
+					return
+				case <-time.After(time.Millisecond):
+				}
+				require.True(t, time.Now().Before(deadline), "no relay found after %v", mockClock.Now().Sub(start))
+				mockClock.IncTime(testCase.step)
+			}
+		})
+	}
+}
+
+func TestSDNHTTP_FindNewRelay_RelayMonitorInterval(t *testing.T) {
+	testTable := []struct {
+		name     string
+		interval time.Duration
+		minWait  time.Duration
+		maxWait  time.Duration
+		step     time.Duration
+	}{
+		// the retry waits for the configured interval, with up to 20% jitter, instead of types.RelayMonitorInterval
+		{name: "configured interval", interval: 10 * time.Second, minWait: 10 * time.Second, maxWait: 13 * time.Second, step: 100 * time.Millisecond},
+		// but not longer than the max backoff
+		{name: "clamped", interval: time.Hour, minWait: findNewRelayMaxBackoff, maxWait: findNewRelayMaxBackoff * 13 / 10, step: 5 * time.Second},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			relaysHandler := func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.WriteHeader(http.StatusInternalServerError)
+					_, _ = w.Write([]byte(`{"details": "internal error"}`))
+					return
+				}
+				_, _ = w.Write([]byte(`[{"ip":"2.2.2.2", "port":1809}]`))
+			}
+			server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: relaysHandler}})
+			defer server.Close()
+
+			mockClock := clock.NewMockClock()
+			start := mockClock.Now()
+			sslCerts := cert.SSLCerts{}
+			sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "", WithClock(mockClock), WithRelayMonitorInterval(testCase.interval)).(*realSDNHTTP)
+			sdn.getPingLatencies = pingAllRelays
+
+			relayInstructions := make(chan RelayInstruction, 1)
+			go sdn.FindNewRelay(context.Background(), "1.1.1.1", 1809, relayInstructions, syncmap.NewStringMapOf[types.RelayInfo]())
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				select {
+				case instruction := <-relayInstructions:
+					assert.Equal(t, RelayInstruction{IP: "2.2.2.2", Port: 1809, Type: Connect}, instruction)
+					waited := mockClock.Now().Sub(start)
+					assert.GreaterOrEqual(t, waited, testCase.minWait)
+					assert.LessOrEqual(t, waited, testCase.maxWait)
+					return
+				case <-time.After(time.Millisecond):
+				}
+				require.True(t, time.Now().Before(deadline), "no relay found after %v", mockClock.Now().Sub(start))
+				mockClock.IncTime(testCase.step)
+			}
+		})
+	}
+}
+
+func TestSDNHTTP_ManageAutoRelays_Shortfall(t *testing.T) {
+	relays := message.Peers{{IP: "1.1.1.1", Port: 1809}, {IP: "2.2.2.2", Port: 1809}}
+	var shortfalls []RelayShortfall
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}}
+	sdn.getPingLatencies = pingAllRelays
+	WithRelayShortfallHandler(func(shortfall RelayShortfall) {
+		shortfalls = append(shortfalls, shortfall)
+	})(sdn)
+
+	relayInstructions := make(chan RelayInstruction, 3)
+	sdn.manageAutoRelays(context.Background(), 2, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	assert.Len(t, relayInstructions, 2)
+	assert.Empty(t, shortfalls)
+
+	relayInstructions = make(chan RelayInstruction, 3)
+	sdn.manageAutoRelays(context.Background(), 3, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	assert.Len(t, relayInstructions, 2)
+	assert.Equal(t, []RelayShortfall{{Requested: 3, Connected: 2}}, shortfalls)
+
+	// no relay answered the ping
+	shortfalls = nil
+	sdn.getPingLatencies = func(context.Context, message.Peers) []nodeLatencyInfo { return nil }
+	sdn.manageAutoRelays(context.Background(), 2, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	assert.Equal(t, []RelayShortfall{{Requested: 2, Connected: 0}}, shortfalls)
+}
+
+func TestSDNHTTP_ManageAutoRelays_EqualLatencyOrder(t *testing.T) {
+	relays := message.Peers{{IP: "3.3.3.3", Port: 1809}, {IP: "1.1.1.1", Port: 1810}, {IP: "2.2.2.2", Port: 1809}, {IP: "1.1.1.1", Port: 1809}}
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}}
+	pings := 0
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		// the relays tie on latency and are returned in a different order every ping
+		pings++
+		pingLatencies := make([]nodeLatencyInfo, 0, len(peers))
+		for i := range peers {
+			peer := peers[(i+pings)%len(peers)]
+			pingLatencies = append(pingLatencies, nodeLatencyInfo{IP: peer.IP, Port: peer.Port, Latency: 10})
+		}
+		return pingLatencies
+	}
+
+	for range 5 {
+		pingLatencies := sdn.pingRelays(context.Background(), relays)
+		assert.Equal(t, []nodeLatencyInfo{{IP: "1.1.1.1", Port: 1809, Latency: 10}, {IP: "1.1.1.1", Port: 1810, Latency: 10},
+			{IP: "2.2.2.2", Port: 1809, Latency: 10}, {IP: "3.3.3.3", Port: 1809, Latency: 10}}, pingLatencies)
+
+		relayInstructions := make(chan RelayInstruction, 2)
+		sdn.manageAutoRelays(context.Background(), 2, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+		require.Len(t, relayInstructions, 2)
+		assert.Equal(t, "1.1.1.1", (<-relayInstructions).IP)
+		assert.Equal(t, "2.2.2.2", (<-relayInstructions).IP)
+	}
+
+	// the equal latency connected relays are in the reverse order, the least preferred first
+	s := testSDNHTTP()
+	connectedAutoRelays := map[string]types.RelayInfo{"1.1.1.1": {Latency: 10}, "3.3.3.3": {Latency: 10}, "2.2.2.2": {Latency: 10}}
+	for range 5 {
+		var ips []string
+		for _, relay := range s.convertMapToSortedSlice(connectedAutoRelays) {
+			ips = append(ips, relay.ip)
+		}
+		assert.Equal(t, []string{"3.3.3.3", "2.2.2.2", "1.1.1.1"}, ips)
+	}
+}
+
+func TestSDNHTTP_ManageAutoRelays_RelayPortCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.2:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	openPort := int64(listener.Addr().(*net.TCPAddr).Port)
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedPort := int64(closedListener.Addr().(*net.TCPAddr).Port)
+	require.NoError(t, closedListener.Close())
+
+	// the relay with the closed port is the fastest
+	relays := message.Peers{{IP: "127.0.0.1", Port: closedPort}, {IP: "127.0.0.2", Port: openPort}}
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}}
+	sdn.getPingLatencies = pingAllRelays
+
+	relayInstructions := make(chan RelayInstruction, 2)
+	sdn.manageAutoRelays(context.Background(), 1, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+	require.Len(t, relayInstructions, 1)
+	assert.Equal(t, "127.0.0.1", (<-relayInstructions).IP)
+
+	WithRelayPortCheck(time.Second)(sdn)
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	sdn.manageAutoRelays(context.Background(), 1, relayInstructions, relays, ignoredRelays)
+	require.Len(t, relayInstructions, 1)
+	assert.Equal(t, RelayInstruction{IP: "127.0.0.2", Port: openPort, Type: Connect}, <-relayInstructions)
+	// the skipped relay is not tracked, so it is tried again once its port accepts connections
+	_, tracked := ignoredRelays.Load("127.0.0.1")
+	assert.False(t, tracked)
+}
+
+func TestSDNHTTP_PotentialRelays(t *testing.T) {
+	cleanupFiles()
+	defer cleanupFiles()
+	var failing atomic.Bool
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}, {"ip":"3.3.3.3", "port":1810}]`))
+	}}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "", WithRelayPriorities(map[string]int{"3.3.3.3": 1}, 10)).(*realSDNHTTP)
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		return []nodeLatencyInfo{{IP: "2.2.2.2", Port: 1809, Latency: 5}, {IP: "1.1.1.1", Port: 1809, Latency: 8}, {IP: "3.3.3.3", Port: 1810, Latency: 12}}
+	}
+
+	potentialRelays, err := sdn.PotentialRelays()
+	require.NoError(t, err)
+	// all the relays are returned, the preferred relay 3.3.3.3 first
+	assert.Equal(t, []RelayStatus{{IP: "3.3.3.3", Port: 1810, Latency: 12}, {IP: "2.2.2.2", Port: 1809, Latency: 5}, {IP: "1.1.1.1", Port: 1809, Latency: 8}}, potentialRelays)
+	// no relay connection was suggested
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.Error(t, sdn.WaitForRelayConnection(ctx))
+
+	failing.Store(true)
+	_, err = sdn.PotentialRelays()
+	assert.Error(t, err)
+}
+
+func TestParsePingOutput(t *testing.T) {
+	testCases := []struct {
+		name       string
+		output     string
+		latency    float64
+		packetLoss float64
+		ok         bool
+	}{
+		{
+			name: "single packet",
+			output: `PING 1.1.1.1 (1.1.1.1) 56(84) bytes of data.
+64 bytes from 1.1.1.1: icmp_seq=1 ttl=57 time=12.3 ms
+
+--- 1.1.1.1 ping statistics ---
+1 packets transmitted, 1 received, 0% packet loss, time 0ms
+rtt min/avg/max/mdev = 12.300/12.300/12.300/0.000 ms`,
+			latency: 12.3,
+			ok:      true,
+		},
+		{
+			name: "lossy packets",
+			output: `PING 1.1.1.1 (1.1.1.1) 56(84) bytes of data.
+64 bytes from 1.1.1.1: icmp_seq=2 ttl=57 time=10.0 ms
+64 bytes from 1.1.1.1: icmp_seq=4 ttl=57 time=30.0 ms
+
+--- 1.1.1.1 ping statistics ---
+4 packets transmitted, 2 received, 50% packet loss, time 3004ms
+rtt min/avg/max/mdev = 10.000/20.000/30.000/10.000 ms`,
+			latency:    20,
+			packetLoss: 50,
+			ok:         true,
+		},
+		{
+			name: "macOS",
+			output: `--- 1.1.1.1 ping statistics ---
+3 packets transmitted, 3 packets received, 0.0% packet loss
+round-trip min/avg/max/stddev = 8.1/9.2/10.3/0.9 ms`,
+			latency: 9.2,
+			ok:      true,
+		},
+		{
+			name: "no reply",
+			output: `--- 1.1.1.1 ping statistics ---
+1 packets transmitted, 0 received, 100% packet loss, time 0ms`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			latency, packetLoss, ok := parsePingOutput(testCase.output)
+			assert.Equal(t, testCase.ok, ok)
+			assert.Equal(t, testCase.latency, latency)
+			assert.Equal(t, testCase.packetLoss, packetLoss)
+		})
+	}
+}
+
+func TestSDNHTTP_ConnectAutoRelays_PacketLoss(t *testing.T) {
+	s := testSDNHTTP()
+	WithMaxPacketLoss(30)(&s)
+	pingLatencies := []nodeLatencyInfo{
+		{IP: "1.1.1.1", Port: 1809, Latency: 5, PacketLoss: 40},
+		{IP: "2.2.2.2", Port: 1809, Latency: 8, PacketLoss: 30},
+		{IP: "3.3.3.3", Port: 1809, Latency: 12},
+	}
+	relayInstructions := make(chan RelayInstruction, 3)
+	s.connectAutoRelays(context.Background(), 3, relayInstructions, pingLatencies, syncmap.NewStringMapOf[types.RelayInfo]())
+
+	// the fastest relay loses too many packets, so it is connected last
+	assert.Equal(t, "2.2.2.2", (<-relayInstructions).IP)
+	assert.Equal(t, "3.3.3.3", (<-relayInstructions).IP)
+	assert.Equal(t, "1.1.1.1", (<-relayInstructions).IP)
 }
 
-func TestSDNHTTP_InitGateway(t *testing.T) {
-	testCase := struct {
-		nodeModel          message.NodeModel
-		networkNumber      types.NetworkNum
-		jsonRespNetwork    string
-		jsonRespRelays     string
-		jsonAccount        string
-		expectedRelayLimit message.BDNServiceLimit
+func TestSDNHTTP_LossyRelay(t *testing.T) {
+	testCases := []struct {
+		name       string
+		options    []Option
+		packetLoss float64
+		lossy      bool
 	}{
-		nodeModel:          message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet", AccountID: "e64yrte6547"},
-		networkNumber:      5,
-		jsonRespNetwork:    `{"min_tx_age_seconds":0,"min_tx_network_fee":0, "network":"Mainnet", "network_num":5,"protocol":"Ethereum"}`,
-		jsonRespRelays:     `[{"ip":"8.208.101.30", "port":1809}, {"ip":"47.90.133.153", "port":1809}]`,
-		jsonAccount:        `{"account_id":"e64yrte6547","blockchain_protocol":"","blockchain_network":"","tier_name":"", "relay_limit":{"expire_date":"", "msg_quota": {"limit":0}}, "private_transaction_fee": {"expire_date": "2999-01-01", "msg_quota": {"interval": "WITHOUT_INTERVAL", "service_type": "MSG_QUOTA", "limit": 13614113913969504939, "behavior_limit_ok": "ALERT", "behavior_limit_fail": "BLOCK_ALERT"}}}`,
-		expectedRelayLimit: 2,
+		{name: "default below", packetLoss: 20},
+		{name: "default above", packetLoss: 25, lossy: true},
+		{name: "zero no loss", options: []Option{WithMaxPacketLoss(0)}},
+		{name: "zero any loss", options: []Option{WithMaxPacketLoss(0)}, packetLoss: 10, lossy: true},
 	}
-	t.Run(fmt.Sprint(testCase), func(t *testing.T) {
-		defer cleanupFiles()
-
-		sslCerts := cert.NewSSLCertsPrivateKey(PrivateKey)
-		sslCerts.SavePrivateCert(PrivateCert)
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := testSDNHTTP()
+			for _, option := range testCase.options {
+				option(&s)
+			}
+			assert.Equal(t, testCase.lossy, s.lossyRelay(nodeLatencyInfo{IP: "1.1.1.1", Latency: 5, PacketLoss: testCase.packetLoss}))
+		})
+	}
+}
 
-		handler1 := mockNodesServer(t, testCase.nodeModel.NodeID, testCase.nodeModel.ExternalPort, testCase.nodeModel.ExternalIP, testCase.nodeModel.Protocol, testCase.nodeModel.Network, testCase.networkNumber, testCase.nodeModel.AccountID)
-		handler2, _ := mockBlockchainNetworkServer(t, testCase.jsonRespNetwork)
-		handler3, _ := mockRelaysServer(t, testCase.jsonRespRelays)
-		handler4, _ := mockAccountServer(t, testCase.jsonAccount)
+func TestSDNHTTP_ManageAutoRelays_SDNOrderFallback(t *testing.T) {
+	relays := message.Peers{{IP: "3.3.3.3", Port: 1809}, {IP: "1.1.1.1", Port: 1810}, {IP: "2.2.2.2", Port: 1809}}
+	unreachable := func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		var nlis []nodeLatencyInfo
+		for _, peer := range peers {
+			nlis = append(nlis, nodeLatencyInfo{IP: peer.IP, Port: peer.Port, Latency: PingTimeout})
+		}
+		return nlis
+	}
 
-		var m []handlerArgs
-		m = append(m, handlerArgs{method: "POST", pattern: "/nodes", handler: handler1})
-		m = append(m, handlerArgs{method: "GET", pattern: "/blockchain-networks/{networkNum}", handler: handler2})
-		m = append(m, handlerArgs{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler3})
-		m = append(m, handlerArgs{method: "GET", pattern: "/account/{accountID}", handler: handler4})
+	testTable := []struct {
+		name             string
+		opts             []Option
+		getPingLatencies func(ctx context.Context, peers message.Peers) []nodeLatencyInfo
+		expectedIPs      []string
+	}{
+		{
+			name:             "no fallback, no latency",
+			opts:             []Option{WithUnreachableRelaysExcluded()},
+			getPingLatencies: unreachable,
+		},
+		{
+			name:             "fallback, no latency",
+			opts:             []Option{WithUnreachableRelaysExcluded(), WithSDNOrderFallback()},
+			getPingLatencies: unreachable,
+			expectedIPs:      []string{"3.3.3.3", "1.1.1.1"},
+		},
+		{
+			name:             "fallback, all unreachable",
+			opts:             []Option{WithSDNOrderFallback()},
+			getPingLatencies: unreachable,
+			expectedIPs:      []string{"3.3.3.3", "1.1.1.1"},
+		},
+		{
+			name: "fallback, latency measured",
+			opts: []Option{WithSDNOrderFallback()},
+			getPingLatencies: func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+				return []nodeLatencyInfo{{IP: "2.2.2.2", Port: 1809, Latency: 5}, {IP: "1.1.1.1", Port: 1810, Latency: 8}, {IP: "3.3.3.3", Port: 1809, Latency: 12}}
+			},
+			expectedIPs: []string{"2.2.2.2", "1.1.1.1"},
+		},
+	}
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			sslCerts := cert.SSLCerts{}
+			sdn := NewSDNHTTP(&sslCerts, "", relayEventsNodeModel, "", testCase.opts...).(*realSDNHTTP)
+			sdn.getPingLatencies = testCase.getPingLatencies
+			relayInstructions := make(chan RelayInstruction, len(relays))
+			sdn.manageAutoRelays(context.Background(), 2, relayInstructions, relays, syncmap.NewStringMapOf[types.RelayInfo]())
+			close(relayInstructions)
+
+			var ips []string
+			for instruction := range relayInstructions {
+				assert.Equal(t, Connect, instruction.Type)
+				ips = append(ips, instruction.IP)
+			}
+			assert.Equal(t, testCase.expectedIPs, ips)
+		})
+	}
+}
 
-		server := mockRouter(m)
-		defer func() {
-			server.Close()
-		}()
+func TestFindFastestRelays_SDNOrderFallback(t *testing.T) {
+	defer cleanupFiles()
+	handler, _ := mockRelaysServer(t, `[{"ip":"3.3.3.3", "port":1809}, {"ip":"1.1.1.1", "port":1809}, {"ip":"2.2.2.2", "port":1809}]`)
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: handler}})
+	defer server.Close()
 
-		defer func() {
-			server.Close()
-		}()
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "", WithUnreachableRelaysExcluded(), WithSDNOrderFallback()).(*realSDNHTTP)
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo { return nil }
+	sdn.autoRelayCount = 2
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	sdn.relayTracker(ignoredRelays).MarkAutoConnected("1.1.1.1", 1809)
 
-		IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
-		sdn := NewSDNHTTP(sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+	// without latencies the missing auto relay is connected in the order of the SDN relay list
+	relayInstructions := make(chan RelayInstruction, 3)
+	sdn.FindFastestRelays(relayInstructions, ignoredRelays)
+	require.Len(t, relayInstructions, 1)
+	assert.Equal(t, RelayInstruction{IP: "3.3.3.3", Port: 1809, Type: Connect}, <-relayInstructions)
 
-		assert.Nil(t, sdn.InitGateway(types.EthereumProtocol, "Mainnet"))
-		assert.Equal(t, testCase.expectedRelayLimit, sdn.accountModel.RelayLimit.MsgQuota.Limit)
-	})
+	// the auto relays are complete
+	sdn.FindFastestRelays(relayInstructions, ignoredRelays)
+	assert.Empty(t, relayInstructions)
 }
 
-func TestSDNHTTP_InitGateway_Fail(t *testing.T) {
-	testCase := struct {
-		nodeModel                  message.NodeModel
-		networkNumber              types.NetworkNum
-		jsonRespServiceUnavailable string
-	}{
-		nodeModel:                  message.NodeModel{NodeID: "35299c61-55ad-4565-85a3-0cd985953fac", ExternalIP: "11.113.164.111", Protocol: "Ethereum", Network: "Mainnet", AccountID: "e64yrte6547"},
-		networkNumber:              5,
-		jsonRespServiceUnavailable: `{"message": "503 Service Unavailable" }`,
+func TestSDNHTTP_PingNetworksRelays(t *testing.T) {
+	cleanupFiles()
+	defer cleanupFiles()
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays", handler: func(w http.ResponseWriter, r *http.Request) {
+		networkNum := mux.Vars(r)["networkNum"]
+		if networkNum == "7" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `[{"ip":"1.1.1.%[1]v", "port":1809}, {"ip":"2.2.2.%[1]v", "port":1809}]`, networkNum)
+	}}})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "").(*realSDNHTTP)
+	var running, maxRunning atomic.Int32
+	sdn.getPingLatencies = func(_ context.Context, peers message.Peers) []nodeLatencyInfo {
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			previous := maxRunning.Load()
+			if current <= previous || maxRunning.CompareAndSwap(previous, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		// the relays of each network answer in reverse order
+		return []nodeLatencyInfo{{IP: peers[1].IP, Port: peers[1].Port, Latency: 5}, {IP: peers[0].IP, Port: peers[0].Port, Latency: 8}}
 	}
-	t.Run(fmt.Sprint(testCase), func(t *testing.T) {
 
-		sslCerts := cert.NewSSLCertsPrivateKey(PrivateKey)
-		sslCerts.SavePrivateCert(PrivateCert)
+	results, err := sdn.PingNetworksRelays(context.Background(), []types.NetworkNum{5, 6, 7, 8, 9}, 2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "(7)")
+	assert.Len(t, results, 4)
+	assert.Equal(t, []RelayCandidate{{IP: "2.2.2.5", Port: 1809, Latency: 5}, {IP: "1.1.1.5", Port: 1809, Latency: 8}}, results[5])
+	assert.NotContains(t, results, types.NetworkNum(7))
+	assert.LessOrEqual(t, maxRunning.Load(), int32(2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err = sdn.PingNetworksRelays(ctx, []types.NetworkNum{5, 6}, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, results)
+}
 
-		handler1 := mockServiceError(t, 503, testCase.jsonRespServiceUnavailable)
-		var m []handlerArgs
-		m = append(m, handlerArgs{method: "POST", pattern: "/nodes", handler: handler1})
+func TestSDNHTTP_FindNewRelay_StopsOnContextDone(t *testing.T) {
+	cleanupFiles()
+	defer cleanupFiles()
+	server := mockRouter([]handlerArgs{{method: "GET", pattern: "/nodes/{nodeID}/{networkNum}/potential-relays",
+		handler: mockServiceError(t, http.StatusServiceUnavailable, `{"message": "503 Service Unavailable" }`)}})
+	defer server.Close()
 
-		server := mockRouter(m)
-		defer func() {
-			server.Close()
-		}()
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, relayEventsNodeModel, "").(*realSDNHTTP)
+	sdn.findNewRelayBackoff = time.Millisecond
 
-		IPResolverHolder = &MockIPResolver{IP: "11.111.111.111"}
-		sdn := NewSDNHTTP(sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	sdn.FindNewRelay(ctx, "1.1.1.1", 1809, make(chan RelayInstruction, 1), syncmap.NewStringMapOf[types.RelayInfo]())
 
-		os.Remove(nodeModelCacheFileName)
-		assert.NotNil(t, sdn.InitGateway(types.EthereumProtocol, "Mainnet"))
-	})
+	// the backoff doubles after every attempt, so only a few attempts fit in the timeout
+	failures := sdn.RelayReconnectFailures()
+	assert.GreaterOrEqual(t, failures, int64(2))
+	assert.LessOrEqual(t, failures, int64(8))
 }
 
 func TestSDNHTTP_HttpPostBadRequestDetailsResponse(t *testing.T) {
@@ -1167,6 +3574,325 @@ func TestSDNHTTP_HttpPostBodyError(t *testing.T) {
 	})
 }
 
+func TestSDNHTTP_HttpGzipResponse(t *testing.T) {
+	jsonResp := `{"message": "ok", "details": "gzip"}`
+
+	testTable := []struct {
+		name                string
+		gzipped             bool
+		maxDecompressedSize int64
+		maxResponseSize     int64
+		expectedErr         error
+	}{
+		{name: "uncompressed"},
+		{name: "gzip", gzipped: true},
+		{name: "gzip exceeds max size", gzipped: true, maxDecompressedSize: 10, expectedErr: ErrResponseTooLarge},
+		{name: "uncompressed exceeds max response size", maxResponseSize: 10, expectedErr: ErrResponseTooLarge},
+		{name: "gzip exceeds max response size", gzipped: true, maxResponseSize: 10, expectedErr: ErrResponseTooLarge},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				assert.Contains(t, r.Header.Get("Accept-Encoding"), "gzip")
+				if !testCase.gzipped {
+					_, _ = w.Write([]byte(jsonResp))
+					return
+				}
+				w.Header().Set("Content-Encoding", "gzip")
+				gzipWriter := gzip.NewWriter(w)
+				_, _ = gzipWriter.Write([]byte(jsonResp))
+				_ = gzipWriter.Close()
+			}
+			router.HandleFunc("/blockchain-networks", handler).Methods("GET")
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			testCerts := SetupTestCerts()
+			sdn := realSDNHTTP{
+				sdnURL:              server.URL,
+				sslCerts:            &testCerts,
+				maxDecompressedSize: testCase.maxDecompressedSize,
+				maxResponseSize:     testCase.maxResponseSize,
+			}
+
+			// a too large gzip response may already fail when its header is read
+			var streamed []byte
+			respBody, streamErr := sdn.httpStream(server.URL+"/blockchain-networks", http.MethodGet, nil)
+			if streamErr == nil {
+				streamed, streamErr = io.ReadAll(respBody)
+				require.NoError(t, respBody.Close())
+			}
+
+			resp, err := sdn.http(server.URL+"/blockchain-networks", http.MethodGet, nil)
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+				assert.Nil(t, resp)
+				assert.ErrorIs(t, streamErr, testCase.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, jsonResp, string(resp))
+			require.NoError(t, streamErr)
+			assert.Equal(t, jsonResp, string(streamed))
+		})
+	}
+}
+
+func TestSDNHTTP_ErrorResponseExceedsMaxResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"message": "internal error", "details": "` + strings.Repeat("x", 1024) + `"}`))
+	}))
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithMaxResponseSize(100)).(*realSDNHTTP)
+	_, err := sdn.http(server.URL+"/blockchain-networks", http.MethodGet, nil)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+	_, err = sdn.Get("/blockchain-networks", nil)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestSDNHTTP_FetchAllBlockchainNetworks_Stream(t *testing.T) {
+	defer cleanupFiles()
+	networksJSON := `[{"network":"Mainnet","network_num":5,"protocol":"Ethereum"},{"network":"BSC-Mainnet","network_num":10,"protocol":"Ethereum"}]`
+	var unavailable atomic.Bool
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks", handler: func(w http.ResponseWriter, r *http.Request) {
+			if unavailable.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gzipWriter := gzip.NewWriter(w)
+			_, _ = gzipWriter.Write([]byte(networksJSON))
+			_ = gzipWriter.Close()
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{}, "").(*realSDNHTTP)
+	require.NoError(t, sdn.FetchAllBlockchainNetworks())
+	assert.Len(t, sdn.SnapshotNetworks(), 2)
+
+	// the response is stored in the cache file
+	cached, err := LoadCacheFile("", blockchainNetworksCacheFileName)
+	require.NoError(t, err)
+	assert.JSONEq(t, networksJSON, string(cached))
+
+	unavailable.Store(true)
+	sdn.SetNetworks(message.BlockchainNetworks{})
+	require.NoError(t, sdn.FetchAllBlockchainNetworks())
+	network, err := sdn.FindNetwork(10)
+	require.NoError(t, err)
+	assert.Equal(t, "BSC-Mainnet", network.Network)
+}
+
+func TestSDNHTTP_FetchAllBlockchainNetworks_InvalidResponse(t *testing.T) {
+	defer cleanupFiles()
+	invalidJSON := `[{"network":"Mainnet",` + strings.Repeat(" ", 2*maxLoggedBodySize)
+	server := mockRouter([]handlerArgs{
+		{method: "GET", pattern: "/blockchain-networks", handler: func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(invalidJSON))
+		}},
+	})
+	defer server.Close()
+
+	sslCerts := cert.SSLCerts{}
+	sdn := NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "").(*realSDNHTTP)
+	err := sdn.FetchAllBlockchainNetworks()
+	require.Error(t, err)
+	// the response is cut in the error
+	assert.Contains(t, err.Error(), fmt.Sprintf("... (%v bytes)", len(invalidJSON)))
+	assert.Less(t, len(err.Error()), len(invalidJSON))
+
+	// without the cache the response is decoded as it is read
+	sdn = NewSDNHTTP(&sslCerts, server.URL, message.NodeModel{ExternalIP: "172.0.0.1"}, "", WithCachePolicy(map[CacheEndpoint]bool{CacheEndpointBlockchainNetworks: false})).(*realSDNHTTP)
+	err = sdn.FetchAllBlockchainNetworks()
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "Mainnet")
+}
+
+func TestSDNHTTP_CompressedResponses(t *testing.T) {
+	jsonResp := `{"account_id": "34ff3406-cc74-4cc7-9d9a-9ef8bdda59b1", "quota_filled": 10, "quota_limit": 100}`
+
+	testTable := []struct {
+		name     string
+		encoding string
+	}{
+		{name: "gzip", encoding: "gzip"},
+		{name: "deflate", encoding: "deflate"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.HandleFunc("/accounts/quota-status", func(w http.ResponseWriter, r *http.Request) {
+				assert.Contains(t, r.Header.Get("Accept-Encoding"), testCase.encoding)
+				w.Header().Set("Content-Encoding", testCase.encoding)
+				var writer io.WriteCloser
+				if testCase.encoding == "gzip" {
+					writer = gzip.NewWriter(w)
+				} else {
+					writer = zlib.NewWriter(w)
+				}
+				_, _ = writer.Write([]byte(jsonResp))
+				_ = writer.Close()
+			}).Methods("GET")
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			testCerts := SetupTestCerts()
+			sdn := realSDNHTTP{
+				sdnURL:   server.URL,
+				sslCerts: &testCerts,
+			}
+
+			resp, err := sdn.Get("/accounts/quota-status", nil)
+			require.NoError(t, err)
+			assert.JSONEq(t, jsonResp, string(resp))
+
+			resp, err = sdn.http(server.URL+"/accounts/quota-status", http.MethodGet, nil)
+			require.NoError(t, err)
+			assert.JSONEq(t, jsonResp, string(resp))
+
+			quota, err := sdn.GetQuotaUsage("34ff3406-cc74-4cc7-9d9a-9ef8bdda59b1")
+			require.NoError(t, err)
+			assert.Equal(t, 10, quota.QuotaFilled)
+		})
+	}
+}
+
+func TestSDNHTTP_GetQuotaUsageBatch(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/accounts/quota-status/batch", func(w http.ResponseWriter, r *http.Request) {
+		var reqBody quotaBatchRequestBody
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+		assert.Equal(t, []string{"a", "b", "c"}, reqBody.AccountIDs)
+		// account c is unknown to the SDN
+		_, _ = w.Write([]byte(`[{"account_id": "a", "quota_filled": 1, "quota_limit": 10}, {"account_id": "b", "quota_filled": 2, "quota_limit": 20}]`))
+	}).Methods("GET")
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	testCerts := SetupTestCerts()
+	sdn := realSDNHTTP{
+		sdnURL:   server.URL,
+		sslCerts: &testCerts,
+	}
+
+	quotas, err := sdn.GetQuotaUsageBatch([]string{"a", "b", "c"})
+	assert.EqualError(t, err, "quota usage not returned for accounts c")
+	require.Len(t, quotas, 2)
+	assert.Equal(t, &QuotaResponseBody{AccountID: "a", QuotaFilled: 1, QuotaLimit: 10}, quotas["a"])
+	assert.Equal(t, &QuotaResponseBody{AccountID: "b", QuotaFilled: 2, QuotaLimit: 20}, quotas["b"])
+}
+
+func TestSDNHTTP_GetQuotaUsageBatch_Unsupported(t *testing.T) {
+	testTable := []struct {
+		name       string
+		statusCode int
+	}{
+		{name: "not found", statusCode: http.StatusNotFound},
+		{name: "method not allowed", statusCode: http.StatusMethodNotAllowed},
+		{name: "not implemented", statusCode: http.StatusNotImplemented},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			var batchRequests atomic.Int32
+			router := mux.NewRouter()
+			router.HandleFunc("/accounts/quota-status/batch", func(w http.ResponseWriter, r *http.Request) {
+				batchRequests.Add(1)
+				w.WriteHeader(testCase.statusCode)
+			})
+			router.HandleFunc("/accounts/quota-status", func(w http.ResponseWriter, r *http.Request) {
+				var reqBody quotaRequestBody
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&reqBody))
+				if reqBody.AccountID == "c" {
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{"details": "account c not found"}`))
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"account_id": %q, "quota_filled": 1, "quota_limit": 10}`, reqBody.AccountID)
+			}).Methods("GET")
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			testCerts := SetupTestCerts()
+			sdn := realSDNHTTP{
+				sdnURL:   server.URL,
+				sslCerts: &testCerts,
+			}
+
+			for range 2 {
+				quotas, err := sdn.GetQuotaUsageBatch([]string{"a", "b", "c"})
+				require.Error(t, err)
+				assert.EqualError(t, err, "quota usage not returned for accounts c")
+				require.Len(t, quotas, 2)
+				assert.Equal(t, &QuotaResponseBody{AccountID: "a", QuotaFilled: 1, QuotaLimit: 10}, quotas["a"])
+				assert.Equal(t, &QuotaResponseBody{AccountID: "b", QuotaFilled: 1, QuotaLimit: 10}, quotas["b"])
+			}
+			// the batch endpoint is not requested again once the SDN rejected it
+			assert.Equal(t, int32(1), batchRequests.Load())
+		})
+	}
+}
+
+func TestSDNHTTP_Ping(t *testing.T) {
+	testTable := []struct {
+		name        string
+		statusCode  int
+		expectedErr error
+		expectErr   bool
+	}{
+		{name: "available", statusCode: http.StatusOK},
+		{name: "unavailable", statusCode: http.StatusServiceUnavailable, expectedErr: ErrSDNUnavailable, expectErr: true},
+		{name: "unexpected status", statusCode: http.StatusInternalServerError, expectErr: true},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(testCase.statusCode)
+			}).Methods("HEAD")
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			testCerts := SetupTestCerts()
+			sdn := realSDNHTTP{
+				sdnURL:   server.URL + "/",
+				sslCerts: &testCerts,
+			}
+
+			err := sdn.Ping(context.Background())
+			if !testCase.expectErr {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			if testCase.expectedErr != nil {
+				assert.ErrorIs(t, err, testCase.expectedErr)
+			}
+		})
+	}
+
+	t.Run("canceled context", func(t *testing.T) {
+		testCerts := SetupTestCerts()
+		sdn := realSDNHTTP{
+			sdnURL:   "http://127.0.0.1:1",
+			sslCerts: &testCerts,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Error(t, sdn.Ping(ctx))
+	})
+}
+
 func TestSDNHTTP_HttpPostUnmarshallError(t *testing.T) {
 	testCase := struct {
 		nodeModel         message.NodeModel
@@ -1211,6 +3937,58 @@ func TestSDNHTTP_HttpPostUnmarshallError(t *testing.T) {
 	})
 }
 
+func TestSDNHTTP_MinTxAgeForNetwork(t *testing.T) {
+	s := testSDNHTTP()
+	s.networks = message.BlockchainNetworks{
+		5:  {NetworkNum: 5, MinTxAgeSeconds: 0.5},
+		10: {NetworkNum: 10, MinTxAgeSeconds: 3},
+	}
+	s.nodeModel.BlockchainNetworkNum = 10
+
+	minTxAge, err := s.MinTxAgeForNetwork(5)
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, minTxAge)
+
+	_, err = s.MinTxAgeForNetwork(7)
+	assert.Error(t, err)
+
+	assert.Equal(t, 3*time.Second, s.MinTxAge())
+	s.nodeModel.BlockchainNetworkNum = 7
+	assert.Equal(t, 2*time.Second, s.MinTxAge())
+}
+
+func TestSDNHTTP_SnapshotNetworks(t *testing.T) {
+	s := testSDNHTTP()
+	s.networks = message.BlockchainNetworks{
+		5: {NetworkNum: 5, Network: "Mainnet", MinTxAgeSeconds: 1, DefaultAttributes: message.BlockchainAttributes{BootstrapNodes: []string{"enode://a"}, ExecutionLayerForks: []string{"shanghai"}}},
+	}
+
+	snapshot := s.SnapshotNetworks()
+	require.Len(t, snapshot, 1)
+	assert.Equal(t, *s.networks[5], *snapshot[5])
+	assert.NotSame(t, s.networks[5], snapshot[5])
+
+	// mutating the original networks concurrently with reading the snapshot must not race
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			network := (*s.Networks())[5]
+			network.MinTxAgeSeconds = float64(i)
+			network.DefaultAttributes.BootstrapNodes[0] = fmt.Sprint(i)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			assert.Equal(t, 1.0, snapshot[5].MinTxAgeSeconds)
+			assert.Equal(t, "enode://a", snapshot[5].DefaultAttributes.BootstrapNodes[0])
+		}
+	}()
+	wg.Wait()
+}
+
 func TestSDNHTTP_FillInAccountDefaults(t *testing.T) {
 	now := time.Now().UTC()
 	targetAccount := message.GetDefaultEliteAccount(now)
@@ -1381,7 +4159,7 @@ func writeToFile(t *testing.T, data interface{}, fileName string) {
 		t.FailNow()
 	}
 
-	if cache.UpdateCacheFile("", fileName, value) != nil {
+	if UpdateCacheFile("", fileName, value) != nil {
 		t.FailNow()
 	}
 }
@@ -1459,3 +4237,123 @@ func writeCerts(folder, name, cert, key string) {
 func CleanupSSLCerts() {
 	_ = os.RemoveAll(SSLTestPath)
 }
+
+func TestBuildAuthHeader(t *testing.T) {
+	authHeader := BuildAuthHeader("e7ea2d3b-1f1a-4b43-8d0a-7c6d5a0b1c2d", "secret:hash")
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("e7ea2d3b-1f1a-4b43-8d0a-7c6d5a0b1c2d:secret:hash")), authHeader)
+
+	accountID, secretHash, err := GetAccountIDSecretHashFromHeader(authHeader)
+	require.NoError(t, err)
+	assert.Equal(t, types.AccountID("e7ea2d3b-1f1a-4b43-8d0a-7c6d5a0b1c2d"), accountID)
+	assert.Equal(t, "secret:hash", secretHash)
+
+	_, _, err = GetAccountIDSecretHashFromHeader("not base64!")
+	assert.ErrorIs(t, err, errAuthHeaderNotBase65)
+	_, _, err = GetAccountIDSecretHashFromHeader(base64.StdEncoding.EncodeToString([]byte("no-separator")))
+	assert.ErrorIs(t, err, errAuthHeaderWrongFormat)
+}
+
+func TestGetAccountIDSecretHashFromHeader_Validation(t *testing.T) {
+	testTable := []struct {
+		name          string
+		payload       string
+		expectedError error
+	}{
+		{name: "empty account id", payload: ":hash", expectedError: errAuthHeaderNoAccountID},
+		{name: "empty hash", payload: "e7ea2d3b-1f1a-4b43-8d0a-7c6d5a0b1c2d:", expectedError: errAuthHeaderNoHash},
+		{name: "empty account id and hash", payload: ":", expectedError: errAuthHeaderNoAccountID},
+		{name: "account id not a uuid", payload: "account:hash", expectedError: errAuthHeaderBadAccount},
+		{name: "uuid account id", payload: "e7ea2d3b-1f1a-4b43-8d0a-7c6d5a0b1c2d:hash"},
+		{name: "bloxroute account id", payload: types.BloxrouteAccountID + ":hash"},
+	}
+
+	for _, testCase := range testTable {
+		t.Run(testCase.name, func(t *testing.T) {
+			_, _, err := GetAccountIDSecretHashFromHeader(base64.StdEncoding.EncodeToString([]byte(testCase.payload)))
+			if testCase.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, testCase.expectedError)
+			}
+		})
+	}
+}
+
+func TestSDNHTTP_SwitchAutoRelays_PendingSwitch(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	mockClock.SetTime(time.Now())
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}, clock: mockClock}
+	latencies := []nodeLatencyInfo{{Latency: 5, IP: "2.2.2.2", Port: 1809}, {Latency: 50, IP: "1.1.1.1", Port: 1809}}
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	sdn.relayTracker(ignoredRelays).MarkAutoConnected("1.1.1.1", 1809)
+
+	relayInstructions := make(chan RelayInstruction, 3)
+	sdn.switchAutoRelays(context.Background(), relayInstructions, latencies, ignoredRelays)
+	require.Len(t, relayInstructions, 1)
+	instruction := <-relayInstructions
+	assert.Equal(t, Switch, instruction.Type)
+	assert.Equal(t, "1.1.1.1", instruction.IP)
+
+	// the gateway did not act on the Switch yet
+	sdn.switchAutoRelays(context.Background(), relayInstructions, latencies, ignoredRelays)
+	assert.Empty(t, relayInstructions)
+
+	// the Switch is sent again once it timed out
+	mockClock.IncTime(pendingSwitchTimeout)
+	sdn.switchAutoRelays(context.Background(), relayInstructions, latencies, ignoredRelays)
+	assert.Len(t, relayInstructions, 1)
+	<-relayInstructions
+
+	// or once the relay was connected again
+	mockClock.IncTime(time.Second)
+	sdn.relayTracker(ignoredRelays).MarkConnected("1.1.1.1", 1809, false)
+	sdn.switchAutoRelays(context.Background(), relayInstructions, latencies, ignoredRelays)
+	assert.Len(t, relayInstructions, 1)
+}
+
+func TestSDNHTTP_SwitchAutoRelays_ReconnectsDisconnectedRelays(t *testing.T) {
+	mockClock := clock.NewMockClock()
+	mockClock.SetTime(time.Now())
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}, clock: mockClock}
+	latencies := []nodeLatencyInfo{{Latency: 5, IP: "2.2.2.2", Port: 1809}, {Latency: 50, IP: "1.1.1.1", Port: 1809}}
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	tracker := sdn.relayTracker(ignoredRelays)
+	tracker.MarkAutoConnected("1.1.1.1", 1809)
+	tracker.MarkDisconnected("2.2.2.2", 1809)
+
+	// a relay disconnected recently is not suggested
+	relayInstructions := make(chan RelayInstruction, 1)
+	sdn.switchAutoRelays(context.Background(), relayInstructions, latencies, ignoredRelays)
+	assert.Empty(t, relayInstructions)
+
+	mockClock.IncTime(disconnectedRelayRetryDelay)
+	sdn.switchAutoRelays(context.Background(), relayInstructions, latencies, ignoredRelays)
+	require.Len(t, relayInstructions, 1)
+	instruction := <-relayInstructions
+	assert.Equal(t, Switch, instruction.Type)
+	require.NotEmpty(t, instruction.RelaysToSwitch)
+	assert.Equal(t, "2.2.2.2", instruction.RelaysToSwitch[0].IP)
+}
+
+func TestSDNHTTP_SwitchAutoRelays_ContextDone(t *testing.T) {
+	sdn := &realSDNHTTP{nodeModel: &message.NodeModel{}, slowRelayLatency: 10}
+	latencies := []nodeLatencyInfo{{Latency: 5, IP: "3.3.3.3", Port: 1809}, {Latency: 50, IP: "1.1.1.1", Port: 1809}, {Latency: 60, IP: "2.2.2.2", Port: 1809}}
+	ignoredRelays := syncmap.NewStringMapOf[types.RelayInfo]()
+	sdn.relayTracker(ignoredRelays).MarkAutoConnected("1.1.1.1", 1809)
+	sdn.relayTracker(ignoredRelays).MarkAutoConnected("2.2.2.2", 1809)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// nobody receives the instructions
+		sdn.switchAutoRelays(ctx, make(chan RelayInstruction), latencies, ignoredRelays)
+		sdn.connectAutoRelays(ctx, 1, make(chan RelayInstruction), latencies, syncmap.NewStringMapOf[types.RelayInfo]())
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sending relay instructions does not stop when the context is done")
+	}
+}
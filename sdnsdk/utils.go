@@ -1,65 +1,323 @@
 package sdnsdk
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"net"
 	"os"
 	"path"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/bloXroute-Labs/bxcommon-go/types"
 )
 
 const defaultBypass = time.Second * 10
 
-// UpdateCacheFile - update a cache file
+// DefaultDataDirMode is the permission mode used by UpdateCacheFile to create a missing data directory
+const DefaultDataDirMode os.FileMode = 0755
+
+// maxLoggedBodySize is how many bytes of a response body are included in an error message
+const maxLoggedBodySize = 512
+
+// truncatedBody returns body for an error message, cut to maxLoggedBodySize bytes
+func truncatedBody(body []byte) string {
+	if len(body) <= maxLoggedBodySize {
+		return string(body)
+	}
+	return fmt.Sprintf("%s... (%v bytes)", body[:maxLoggedBodySize], len(body))
+}
+
+// UpdateCacheFile - update a cache file, creating the data directory with DefaultDataDirMode if it does not exist.
+// The file holds value in a versioned envelope rather than value itself, see UpdateCacheFileFS,
+// so it must be read with LoadCacheFile.
 func UpdateCacheFile(dataDir string, fileName string, value []byte) error {
-	cacheFileName := path.Join(dataDir, fileName)
-	f, err := os.OpenFile(cacheFileName, os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
+	return UpdateCacheFileWithMode(dataDir, fileName, value, DefaultDataDirMode)
+}
+
+// UpdateCacheFileWithMode - update a cache file, creating the data directory with dirMode if it does not exist
+func UpdateCacheFileWithMode(dataDir string, fileName string, value []byte, dirMode os.FileMode) error {
+	return UpdateCacheFileFS(OSCacheFS, dataDir, fileName, value, dirMode)
+}
+
+// UpdateCacheFileFS - update a cache file in fsys, creating the data directory with dirMode if it does not exist.
+// The JSON value is stored in an envelope with the CacheFileVersion and the time it was saved.
+// The cache file is not rewritten if it already holds value, so polling an unchanged SDN response does not
+// wear out flash storage, and its saved time is when value was first saved.
+func UpdateCacheFileFS(fsys CacheFS, dataDir string, fileName string, value []byte, dirMode os.FileMode) error {
+	if !json.Valid(value) {
+		return fmt.Errorf("cache file %v value is not valid JSON", fileName)
+	}
+	if envelope, err := loadCacheFileEnvelope(fsys, dataDir, fileName); err == nil && bytes.Equal(envelope.Payload, value) {
+		return nil
 	}
-	defer f.Close()
-	writer := bufio.NewWriter(f)
-	_, err = writer.Write(value)
+	savedAt, err := json.Marshal(time.Now().UTC())
 	if err != nil {
 		return err
 	}
+	// the payload is written verbatim so it is loaded byte for byte
+	envelope := fmt.Appendf(nil, `{"version":%d,"saved_at":%s,"payload":%s}`, CacheFileVersion, savedAt, value)
+	return fsys.WriteFile(path.Join(dataDir, fileName), envelope, dirMode)
+}
+
+// CacheFileVersion is the version of the cache files written by UpdateCacheFile. It is increased when the cached
+// SDN responses change in a way older cache files would be misread, so those are not loaded.
+const CacheFileVersion = 1
+
+// cacheFileEnvelope is the content of a cache file
+type cacheFileEnvelope struct {
+	Version int             `json:"version"`
+	SavedAt time.Time       `json:"saved_at"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// networkCacheFileName returns the name of the cache file fileName of networkNum, e.g. potentialrelays_5.json,
+// so gateways of different networks sharing a data directory do not overwrite each other's cache files.
+// fileName is returned unchanged if networkNum is zero, i.e. not yet known.
+func networkCacheFileName(fileName string, networkNum types.NetworkNum) string {
+	if networkNum == 0 {
+		return fileName
+	}
+	ext := path.Ext(fileName)
+	return fmt.Sprintf("%v_%d%v", strings.TrimSuffix(fileName, ext), networkNum, ext)
+}
+
+// nodeModelCacheFile returns the name of the node model cache file of the protocol and network of a node,
+// e.g. nodemodel_ethereum_mainnet.json. Unlike the other cache files it is not keyed by the network number,
+// which is only known once the node registered. nodeModelCacheFileName is returned if both names are empty.
+func nodeModelCacheFile(protocol, network string) string {
+	if protocol == "" && network == "" {
+		return nodeModelCacheFileName
+	}
+	key := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(protocol+"_"+network))
+	ext := path.Ext(nodeModelCacheFileName)
+	return fmt.Sprintf("%v_%v%v", strings.TrimSuffix(nodeModelCacheFileName, ext), key, ext)
+}
 
-	return writer.Flush()
+// accountCacheFileName returns the name of the cache file of the account of accountID fetched from endpoint,
+// e.g. accountmodel_<id>.json, so the account of the node and the accounts of customers do not overwrite each other.
+// The cache file name of the endpoint is returned unchanged if accountID is empty.
+func accountCacheFileName(endpoint CacheEndpoint, accountID types.AccountID) string {
+	fileName := accountModelsFileName
+	if endpoint == CacheEndpointAccounts {
+		fileName = customerAccountModelsFileName
+	}
+	if accountID == "" {
+		return fileName
+	}
+	ext := path.Ext(fileName)
+	return fmt.Sprintf("%v_%v%v", strings.TrimSuffix(fileName, ext), accountID, ext)
 }
 
-// LoadCacheFile - load a cache file
+// LoadCacheFile - load a cache file written by UpdateCacheFile, returning the payload of its versioned envelope.
+// Cache files holding a bare value, as written before CacheFileVersion was introduced, are rejected
+// with ErrIncompatibleCacheFile.
 func LoadCacheFile(dataDir string, fileName string) ([]byte, error) {
-	cacheFileName := path.Join(dataDir, fileName)
-	f, err := os.Open(cacheFileName)
+	return LoadCacheFileFS(OSCacheFS, dataDir, fileName)
+}
+
+// LoadCacheFileFS - load a cache file from fsys, returning ErrCorruptCacheFile if its content is not valid JSON
+// or ErrIncompatibleCacheFile if it was not written with the CacheFileVersion
+func LoadCacheFileFS(fsys fs.FS, dataDir string, fileName string) ([]byte, error) {
+	envelope, err := loadCacheFileEnvelope(fsys, dataDir, fileName)
 	if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+	return envelope.Payload, nil
+}
+
+// loadCacheFileEnvelope loads the envelope of a cache file from fsys
+func loadCacheFileEnvelope(fsys fs.FS, dataDir string, fileName string) (cacheFileEnvelope, error) {
+	var envelope cacheFileEnvelope
+	cacheFileName := path.Join(dataDir, fileName)
+	data, err := fs.ReadFile(fsys, cacheFileName)
+	if err != nil {
+		return envelope, err
+	}
+	if !json.Valid(data) {
+		return envelope, fmt.Errorf("%w: %v", ErrCorruptCacheFile, cacheFileName)
+	}
+	// cache files written before the envelope was introduced have no version
+	if json.Unmarshal(data, &envelope) != nil || envelope.Version != CacheFileVersion || envelope.Payload == nil {
+		return envelope, fmt.Errorf("%w: %v has version %v instead of %v", ErrIncompatibleCacheFile, cacheFileName, envelope.Version, CacheFileVersion)
+	}
+	return envelope, nil
+}
+
+// ErrCorruptCacheFile is returned when loading a cache file which does not contain valid JSON,
+// e.g. because it was truncated by a crash while it was written
+var ErrCorruptCacheFile = errors.New("cache file is not valid JSON")
+
+// ErrIncompatibleCacheFile is returned when loading a cache file which was written with another CacheFileVersion,
+// e.g. by an older gateway version
+var ErrIncompatibleCacheFile = errors.New("cache file has an incompatible version")
+
+// LoadJSONCacheFile - load a cache file holding JSON, returning ErrCorruptCacheFile if its content is not valid JSON
+//
+// Deprecated: all cache files hold JSON, use LoadCacheFile.
+func LoadJSONCacheFile(dataDir string, fileName string) ([]byte, error) {
+	return LoadJSONCacheFileFS(OSCacheFS, dataDir, fileName)
+}
+
+// LoadJSONCacheFileFS - load a cache file holding JSON from fsys, returning ErrCorruptCacheFile if its content is not valid JSON
+//
+// Deprecated: all cache files hold JSON, use LoadCacheFileFS.
+func LoadJSONCacheFileFS(fsys fs.FS, dataDir string, fileName string) ([]byte, error) {
+	return LoadCacheFileFS(fsys, dataDir, fileName)
+}
+
+// IPResolutionPolicy selects which address is used when a host name resolves to multiple addresses
+type IPResolutionPolicy int
+
+// IPResolutionPolicy types
+const (
+	// IPResolutionFirst uses the first address returned by the resolver
+	IPResolutionFirst IPResolutionPolicy = iota
+	// IPResolutionPreferIPv4 uses the first IPv4 address, falling back to the first address
+	IPResolutionPreferIPv4
+	// IPResolutionPreferIPv6 uses the first IPv6 address, falling back to the first address
+	IPResolutionPreferIPv6
+)
+
+// dnsCacheTTL is how long resolved host names are cached
+const dnsCacheTTL = 30 * time.Second
+
+// lookupHost is used to resolve host names, replaced in tests
+var lookupHost = net.LookupHost
+
+type dnsCacheEntry struct {
+	ips     []string
+	expires time.Time
+}
+
+// dnsCache caches the addresses of resolved host names, so relay host names are not resolved
+// again for every ping result within a polling cycle
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+}
+
+var resolvedHosts = &dnsCache{entries: make(map[string]dnsCacheEntry)}
+
+// lookup returns the cached addresses of host, resolving it if they are missing or expired
+func (c *dnsCache) lookup(host string) ([]string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.ips, nil
+	}
 
-	return io.ReadAll(bufio.NewReader(f))
+	ips, err := lookupHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("host provided %s is not valid - %v", host, err)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("host provided %s has no IPs behind the domain name", host)
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsCacheEntry{ips: ips, expires: time.Now().Add(dnsCacheTTL)}
+	c.mu.Unlock()
+	return ips, nil
+}
+
+func (c *dnsCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]dnsCacheEntry)
+}
+
+// ResolveHost returns the IP address for a host name, which is cached for a short time
+func ResolveHost(host string) (net.IP, error) {
+	return ResolveHostWithPolicy(host, IPResolutionFirst)
+}
+
+// ResolveHostWithPolicy returns the IP address for a host name, which is cached for a short time,
+// using policy to pick the address if the host name resolves to multiple addresses
+func ResolveHostWithPolicy(host string, policy IPResolutionPolicy) (net.IP, error) {
+	if addr := net.ParseIP(host); addr != nil {
+		return addr, nil
+	}
+	// If domain name provided instead of IP, convert it to an IP address
+	ips, err := resolvedHosts.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	ip := selectIP(ips, policy)
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("host provided %s resolved to an invalid IP %s", host, ip)
+	}
+	return addr, nil
 }
 
 // GetIP checks the existence of and returns the IP address for a host name
 func GetIP(host string) (string, error) {
-	addr := net.ParseIP(host)
-	if addr == nil {
-		// If domain name provided instead of IP, convert it to an IP address
-		ips, err := net.LookupHost(host)
-		if err != nil {
-			return "", fmt.Errorf("host provided %s is not valid - %v", host, err)
-		}
-		if len(ips) == 0 {
-			return "", fmt.Errorf("host provided %s has no IPs behind the domain name", host)
-		}
+	return GetIPWithPolicy(host, IPResolutionFirst)
+}
+
+// GetIPWithPolicy checks the existence of and returns the IP address for a host name,
+// using policy to pick the address if the host name resolves to multiple addresses
+func GetIPWithPolicy(host string, policy IPResolutionPolicy) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+	addr, err := ResolveHostWithPolicy(host, policy)
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
 
-		_, err = net.LookupIP(ips[0])
-		if err != nil {
-			return "", fmt.Errorf("host provided %s is not valid - %v", host, err)
+// GetIPsWithPolicy returns all the IP addresses of a host name, ordered so the addresses preferred by policy come first
+func GetIPsWithPolicy(host string, policy IPResolutionPolicy) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	ips, err := resolvedHosts.lookup(host)
+	if err != nil {
+		return nil, err
+	}
+	if policy == IPResolutionFirst {
+		return ips, nil
+	}
+
+	ordered := make([]string, 0, len(ips))
+	var others []string
+	for _, ip := range ips {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP != nil && (parsedIP.To4() != nil) == (policy == IPResolutionPreferIPv4) {
+			ordered = append(ordered, ip)
+		} else {
+			others = append(others, ip)
 		}
+	}
+	return append(ordered, others...), nil
+}
 
-		return ips[0], nil
+func selectIP(ips []string, policy IPResolutionPolicy) string {
+	if policy == IPResolutionFirst {
+		return ips[0]
+	}
+	for _, ip := range ips {
+		parsedIP := net.ParseIP(ip)
+		if parsedIP == nil {
+			continue
+		}
+		isIPv4 := parsedIP.To4() != nil
+		if isIPv4 == (policy == IPResolutionPreferIPv4) {
+			return ip
+		}
 	}
-	return host, nil
+	return ips[0]
 }
@@ -0,0 +1,76 @@
+package syncmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"hash/maphash"
+	"reflect"
+
+	"github.com/puzpuzpuz/xsync/v2"
+)
+
+// jsonEntry is the JSON form of a key and value of a map with non string keys
+type jsonEntry[K comparable, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+// hasStringKeys returns whether the keys of the map have an underlying string type
+func (m *SyncMap[K, V]) hasStringKeys() bool {
+	return reflect.TypeFor[K]().Kind() == reflect.String
+}
+
+// MarshalJSON encodes the map as a JSON object if its keys have an underlying string type,
+// or as an array of {"key": ..., "value": ...} entries otherwise
+func (m *SyncMap[K, V]) MarshalJSON() ([]byte, error) {
+	if m.hasStringKeys() {
+		entries := make(map[K]V)
+		if m.m != nil {
+			m.Range(func(key K, value V) bool {
+				entries[key] = value
+				return true
+			})
+		}
+		return json.Marshal(entries)
+	}
+
+	entries := make([]jsonEntry[K, V], 0)
+	if m.m != nil {
+		m.Range(func(key K, value V) bool {
+			entries = append(entries, jsonEntry[K, V]{Key: key, Value: value})
+			return true
+		})
+	}
+	return json.Marshal(entries)
+}
+
+// UnmarshalJSON stores the keys and values encoded by MarshalJSON in the map.
+// Like a regular map, existing entries that are not in data are kept.
+// A zero value SyncMap is initialized with a hasher for its key type.
+func (m *SyncMap[K, V]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+
+	var pairs []jsonEntry[K, V]
+	if m.hasStringKeys() {
+		var entries map[K]V
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+		pairs = make([]jsonEntry[K, V], 0, len(entries))
+		for key, value := range entries {
+			pairs = append(pairs, jsonEntry[K, V]{Key: key, Value: value})
+		}
+	} else if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+
+	if m.m == nil {
+		m.m = xsync.NewTypedMapOf[K, V](maphash.Comparable[K])
+	}
+	for _, pair := range pairs {
+		m.Store(pair.Key, pair.Value)
+	}
+	return nil
+}
@@ -4,6 +4,13 @@ import (
 	"github.com/puzpuzpuz/xsync/v2"
 )
 
+// Number is a constraint for the value types supported by Add
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
 // SyncMap is concurrent safe map with generics / arbitrarily typed keys
 // Documentation: https://pkg.go.dev/github.com/puzpuzpuz/xsync
 type SyncMap[K comparable, V any] struct {
@@ -87,7 +94,9 @@ func (m *SyncMap[K, V]) Keys() (keys []K) {
 }
 
 // Compute either sets the computed new value for the key or deletes the value for the key.
-func (m *SyncMap[K, V]) Compute(key K, valueFn func(oldValue V, loaded bool) (newValue V, delete bool)) (actual V, loaded bool) {
+// valueFn runs under the lock of the key's bucket, so the read-modify-write is atomic.
+// The ok result reports whether a value is present for the key after the call.
+func (m *SyncMap[K, V]) Compute(key K, valueFn func(oldValue V, loaded bool) (newValue V, delete bool)) (actual V, ok bool) {
 	return m.m.Compute(key, valueFn)
 }
 
@@ -96,3 +105,13 @@ func (m *SyncMap[K, V]) Has(key K) (exists bool) {
 	_, exists = m.m.Load(key)
 	return
 }
+
+// Add atomically adds delta to the value stored by key and returns the new value.
+// A missing key is treated as zero. Go does not allow methods with extra type constraints,
+// so Add is a function rather than a SyncMap method.
+func Add[K comparable, V Number](m *SyncMap[K, V], key K, delta V) V {
+	actual, _ := m.Compute(key, func(oldValue V, loaded bool) (V, bool) {
+		return oldValue + delta, false
+	})
+	return actual
+}
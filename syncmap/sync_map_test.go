@@ -1,12 +1,14 @@
 package syncmap
 
 import (
+	"encoding/json"
 	"strconv"
 	"sync"
 	"testing"
 
 	"github.com/bloXroute-Labs/bxcommon-go/sdnsdk/message"
 	"github.com/bloXroute-Labs/bxcommon-go/types"
+	"github.com/stretchr/testify/require"
 )
 
 const goroutineCount = 100
@@ -244,3 +246,164 @@ func BenchmarkSyncMapReadWithConversion(b *testing.B) {
 		}
 	})
 }
+
+func TestAdd(t *testing.T) {
+	sm := NewStringMapOf[int64]()
+
+	require.Equal(t, int64(5), Add(sm, "key", 5))
+	require.Equal(t, int64(3), Add(sm, "key", -2))
+
+	val, exists := sm.Load("key")
+	require.True(t, exists)
+	require.Equal(t, int64(3), val)
+}
+
+func TestAddConcurrent(t *testing.T) {
+	const increments = 1000
+
+	sm := NewTypedMapOf[types.AccountID, uint64](AccountIDHasher)
+	var wg sync.WaitGroup
+	for i := 0; i < goroutineCount; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				Add(sm, "account", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	val, exists := sm.Load("account")
+	require.True(t, exists)
+	require.Equal(t, uint64(goroutineCount*increments), val)
+}
+
+func TestCompute(t *testing.T) {
+	sm := NewStringMapOf[types.RelayInfo]()
+
+	// update: a missing key is stored
+	actual, ok := sm.Compute("relay", func(oldValue types.RelayInfo, loaded bool) (types.RelayInfo, bool) {
+		require.False(t, loaded)
+		return types.RelayInfo{IsConnected: true, Port: 1809}, false
+	})
+	require.True(t, ok)
+	require.Equal(t, types.RelayInfo{IsConnected: true, Port: 1809}, actual)
+
+	// no-op: the existing value is kept
+	actual, ok = sm.Compute("relay", func(oldValue types.RelayInfo, loaded bool) (types.RelayInfo, bool) {
+		require.True(t, loaded)
+		return oldValue, false
+	})
+	require.True(t, ok)
+	require.Equal(t, types.RelayInfo{IsConnected: true, Port: 1809}, actual)
+
+	// delete: the value is removed
+	_, ok = sm.Compute("relay", func(oldValue types.RelayInfo, loaded bool) (types.RelayInfo, bool) {
+		return oldValue, true
+	})
+	require.False(t, ok)
+	require.False(t, sm.Has("relay"))
+
+	// delete of a missing key does not store anything
+	_, ok = sm.Compute("missing", func(oldValue types.RelayInfo, loaded bool) (types.RelayInfo, bool) {
+		return oldValue, true
+	})
+	require.False(t, ok)
+	require.Equal(t, 0, sm.Size())
+}
+
+func TestComputeConcurrent(t *testing.T) {
+	const keys = 10
+
+	sm := NewIntegerMapOf[int, int]()
+	var wg sync.WaitGroup
+	for i := 0; i < goroutineCount; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			key := id % keys
+			// update
+			sm.Compute(key, func(oldValue int, loaded bool) (int, bool) {
+				return oldValue + 1, false
+			})
+			// no-op
+			sm.Compute(key, func(oldValue int, loaded bool) (int, bool) {
+				return oldValue, false
+			})
+			// conditional delete of the keys that would otherwise go above the limit
+			sm.Compute(keys+key, func(oldValue int, loaded bool) (int, bool) {
+				return oldValue + 1, oldValue+1 >= goroutineCount/keys
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for key := 0; key < keys; key++ {
+		val, exists := sm.Load(key)
+		require.True(t, exists)
+		require.Equal(t, goroutineCount/keys, val)
+
+		require.False(t, sm.Has(keys+key))
+	}
+}
+
+func TestJSONStringKeys(t *testing.T) {
+	sm := NewStringMapOf[types.RelayInfo]()
+	sm.Store("1.1.1.1", types.RelayInfo{IsConnected: true, Port: 1809, Latency: 12.5})
+	sm.Store("2.2.2.2", types.RelayInfo{IsStatic: true, Port: 1810})
+
+	data, err := json.Marshal(sm)
+	require.NoError(t, err)
+
+	var object map[string]types.RelayInfo
+	require.NoError(t, json.Unmarshal(data, &object))
+	require.Len(t, object, 2)
+
+	restored := NewStringMapOf[types.RelayInfo]()
+	require.NoError(t, json.Unmarshal(data, restored))
+	require.Equal(t, 2, restored.Size())
+	sm.Range(func(key string, value types.RelayInfo) bool {
+		actual, exists := restored.Load(key)
+		require.True(t, exists)
+		require.Equal(t, value.Port, actual.Port)
+		require.Equal(t, value.IsConnected, actual.IsConnected)
+		require.Equal(t, value.IsStatic, actual.IsStatic)
+		require.Equal(t, value.Latency, actual.Latency)
+		return true
+	})
+
+	// a zero value map is initialized
+	var zero SyncMap[types.AccountID, int]
+	require.NoError(t, json.Unmarshal([]byte(`{"account":1}`), &zero))
+	val, exists := zero.Load("account")
+	require.True(t, exists)
+	require.Equal(t, 1, val)
+}
+
+func TestJSONArbitraryKeys(t *testing.T) {
+	sm := NewIntegerMapOf[int, string]()
+	sm.Store(1, "one")
+	sm.Store(2, "two")
+
+	data, err := json.Marshal(sm)
+	require.NoError(t, err)
+
+	var pairs []struct {
+		Key   int    `json:"key"`
+		Value string `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal(data, &pairs))
+	require.Len(t, pairs, 2)
+
+	var restored SyncMap[int, string]
+	require.NoError(t, json.Unmarshal(data, &restored))
+	require.Equal(t, 2, restored.Size())
+	val, exists := restored.Load(2)
+	require.True(t, exists)
+	require.Equal(t, "two", val)
+
+	empty, err := json.Marshal(NewIntegerMapOf[int, string]())
+	require.NoError(t, err)
+	require.JSONEq(t, `[]`, string(empty))
+}
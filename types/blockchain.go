@@ -1,6 +1,10 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"strings"
+	"time"
+)
 
 // EthereumProtocol - string representation for the EthereumProtocol protocol
 const EthereumProtocol = "Ethereum"
@@ -55,6 +59,28 @@ var BlockchainNetworkToNetworkNum = map[string]NetworkNum{
 	Holesky:    HoleskyNum,
 }
 
+// networkNameAliases maps normalized blockchain network names and their aliases to network numbers
+var networkNameAliases = map[string]NetworkNum{
+	"MAINNET":    MainnetNum,
+	"ETH":        MainnetNum,
+	"ETHEREUM":   MainnetNum,
+	"BSCMAINNET": BSCMainnetNum,
+	"BSC":        BSCMainnetNum,
+	"BSCTESTNET": BSCTestnetNum,
+	"HOLESKY":    HoleskyNum,
+}
+
+// FromStringToNetworkNum returns the network number of a blockchain network name or alias (e.g. "eth").
+// Names are matched case-insensitively, ignoring dashes.
+func FromStringToNetworkNum(name string) (NetworkNum, error) {
+	normalized := strings.ToUpper(strings.Replace(name, "-", "", -1))
+	networkNum, ok := networkNameAliases[normalized]
+	if ok {
+		return networkNum, nil
+	}
+	return 0, fmt.Errorf("could not parse unknown blockchain network %v", name)
+}
+
 // NetworkNumToChainID - Mapping from networkNum to chainID
 var NetworkNumToChainID = map[NetworkNum]NetworkID{
 	MainnetNum:    EthChainID,
@@ -70,6 +96,36 @@ var NetworkNumToBlockchainNetwork = map[NetworkNum]string{
 	HoleskyNum:    Holesky,
 }
 
+// StringName returns the blockchain network name of the network number, or "UNKNOWN" if it is not known
+func (n NetworkNum) StringName() string {
+	if name, ok := NetworkNumToBlockchainNetwork[n]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// String returns the network number with its blockchain network name for display, e.g. "Mainnet (5)".
+// The JSON wire format stays numeric.
+func (n NetworkNum) String() string {
+	return fmt.Sprintf("%s (%d)", n.StringName(), uint32(n))
+}
+
+// StringName returns the blockchain network name of the chain ID, or "UNKNOWN" if it is not known
+func (n NetworkID) StringName() string {
+	for networkNum, chainID := range NetworkNumToChainID {
+		if chainID == n {
+			return networkNum.StringName()
+		}
+	}
+	return "UNKNOWN"
+}
+
+// String returns the chain ID with its blockchain network name for display, e.g. "Mainnet (1)".
+// The JSON wire format stays numeric.
+func (n NetworkID) String() string {
+	return fmt.Sprintf("%s (%d)", n.StringName(), int64(n))
+}
+
 var (
 	BSCMainnetLorentzTime = time.Date(2025, 4, 29, 5, 5, 0, 0, time.UTC)
 	BSCTestnetLorentzTime = time.Date(2025, 4, 8, 5, 5, 0, 0, time.UTC)
@@ -101,3 +157,12 @@ func NetworkToBlockDuration(network string) time.Duration {
 		return 0
 	}
 }
+
+// NetworkNumToBlockDuration returns the block interval of the network number, or 0 if it is not known
+func NetworkNumToBlockDuration(num NetworkNum) time.Duration {
+	network, ok := NetworkNumToBlockchainNetwork[num]
+	if !ok {
+		return 0
+	}
+	return NetworkToBlockDuration(network)
+}
@@ -0,0 +1,64 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkNumString(t *testing.T) {
+	require.Equal(t, "Mainnet (5)", MainnetNum.String())
+	require.Equal(t, "BSC-Mainnet", BSCMainnetNum.StringName())
+	require.Equal(t, "UNKNOWN (1234)", NetworkNum(1234).String())
+	require.Equal(t, "UNKNOWN", NetworkNum(1234).StringName())
+}
+
+func TestNetworkIDString(t *testing.T) {
+	require.Equal(t, "Mainnet (1)", EthChainID.String())
+	require.Equal(t, "BSC-Mainnet (56)", NetworkID(BSCChainID).String())
+	require.Equal(t, "UNKNOWN (1234)", NetworkID(1234).String())
+}
+
+func TestNetworkNumJSON(t *testing.T) {
+	b, err := json.Marshal(map[string]any{"network_num": MainnetNum, "chain_id": EthChainID})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"network_num":5,"chain_id":1}`, string(b))
+}
+
+func TestFromStringToNetworkNum(t *testing.T) {
+	testCases := map[string]NetworkNum{
+		Mainnet:       MainnetNum,
+		"mainnet":     MainnetNum,
+		"eth":         MainnetNum,
+		"Ethereum":    MainnetNum,
+		BSCMainnet:    BSCMainnetNum,
+		"bscmainnet":  BSCMainnetNum,
+		"bsc":         BSCMainnetNum,
+		"bsc-testnet": BSCTestnetNum,
+		Holesky:       HoleskyNum,
+	}
+	for name, expected := range testCases {
+		networkNum, err := FromStringToNetworkNum(name)
+		require.NoError(t, err, name)
+		require.Equal(t, expected, networkNum, name)
+	}
+
+	// every known network name is parsed
+	for name, expected := range BlockchainNetworkToNetworkNum {
+		networkNum, err := FromStringToNetworkNum(name)
+		require.NoError(t, err, name)
+		require.Equal(t, expected, networkNum, name)
+	}
+
+	_, err := FromStringToNetworkNum("unknown-net")
+	require.ErrorContains(t, err, "unknown-net")
+}
+
+func TestNetworkNumToBlockDuration(t *testing.T) {
+	require.Equal(t, 12*time.Second, NetworkNumToBlockDuration(MainnetNum))
+	require.Equal(t, NetworkToBlockDuration(BSCMainnet), NetworkNumToBlockDuration(BSCMainnetNum))
+	require.Equal(t, NetworkToBlockDuration(BSCTestnet), NetworkNumToBlockDuration(BSCTestnetNum))
+	require.Equal(t, time.Duration(0), NetworkNumToBlockDuration(NetworkNum(1234)))
+}
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// NetworkNumSet is a set of blockchain network numbers, e.g. the networks served by a relay proxy.
+// It is encoded to JSON as a sorted array. A nil set is empty, Add allocates it.
+type NetworkNumSet map[NetworkNum]struct{}
+
+// NewNetworkNumSet returns a set of networkNums
+func NewNetworkNumSet(networkNums ...NetworkNum) NetworkNumSet {
+	set := make(NetworkNumSet, len(networkNums))
+	for _, networkNum := range networkNums {
+		set[networkNum] = struct{}{}
+	}
+	return set
+}
+
+// Add adds networkNum to the set
+func (s *NetworkNumSet) Add(networkNum NetworkNum) {
+	if *s == nil {
+		*s = make(NetworkNumSet)
+	}
+	(*s)[networkNum] = struct{}{}
+}
+
+// Contains returns whether networkNum is in the set
+func (s NetworkNumSet) Contains(networkNum NetworkNum) bool {
+	_, ok := s[networkNum]
+	return ok
+}
+
+// Remove removes networkNum from the set
+func (s NetworkNumSet) Remove(networkNum NetworkNum) {
+	delete(s, networkNum)
+}
+
+// Len returns the number of networks in the set
+func (s NetworkNumSet) Len() int {
+	return len(s)
+}
+
+// Slice returns the networks in the set in ascending order
+func (s NetworkNumSet) Slice() []NetworkNum {
+	networkNums := make([]NetworkNum, 0, len(s))
+	for networkNum := range s {
+		networkNums = append(networkNums, networkNum)
+	}
+	slices.Sort(networkNums)
+	return networkNums
+}
+
+// MarshalJSON encodes the set as a sorted array of network numbers
+func (s NetworkNumSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Slice())
+}
+
+// UnmarshalJSON decodes an array of network numbers, replacing the content of the set
+func (s *NetworkNumSet) UnmarshalJSON(data []byte) error {
+	var networkNums []NetworkNum
+	if err := json.Unmarshal(data, &networkNums); err != nil {
+		return err
+	}
+	*s = NewNetworkNumSet(networkNums...)
+	return nil
+}
@@ -0,0 +1,40 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkNumSet(t *testing.T) {
+	var set NetworkNumSet
+	require.False(t, set.Contains(MainnetNum))
+	require.Empty(t, set.Slice())
+
+	set.Add(BSCMainnetNum)
+	set.Add(MainnetNum)
+	set.Add(BSCMainnetNum)
+	require.True(t, set.Contains(MainnetNum))
+	require.Equal(t, 2, set.Len())
+	require.Equal(t, []NetworkNum{MainnetNum, BSCMainnetNum}, set.Slice())
+
+	set.Remove(MainnetNum)
+	require.False(t, set.Contains(MainnetNum))
+	require.Equal(t, []NetworkNum{BSCMainnetNum}, set.Slice())
+}
+
+func TestNetworkNumSetJSON(t *testing.T) {
+	set := NewNetworkNumSet(BaseMainnetNum, MainnetNum, BSCMainnetNum)
+	b, err := json.Marshal(map[string]NetworkNumSet{"networks": set})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"networks":[5,10,456]}`, string(b))
+
+	var decoded struct {
+		Networks NetworkNumSet `json:"networks"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"networks":[456,5,5]}`), &decoded))
+	require.Equal(t, NewNetworkNumSet(MainnetNum, BaseMainnetNum), decoded.Networks)
+
+	require.Error(t, json.Unmarshal([]byte(`{"networks":"5"}`), &decoded))
+}
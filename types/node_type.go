@@ -1,8 +1,11 @@
 package types
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // TimeDateLayoutISO - used to parse ISO time date format string
@@ -11,6 +14,19 @@ const TimeDateLayoutISO = "2006-01-02"
 // ExpiredDate - constant for an expired date
 const ExpiredDate = "1970-01-01"
 
+// IsExpired returns whether the date in TimeDateLayoutISO format, e.g. the expire date of an account limit,
+// has passed at now. The date itself is still valid. ExpiredDate and an empty date are always expired.
+func IsExpired(dateStr string, now time.Time) (bool, error) {
+	if dateStr == "" || dateStr == ExpiredDate {
+		return true, nil
+	}
+	date, err := time.Parse(TimeDateLayoutISO, dateStr)
+	if err != nil {
+		return false, fmt.Errorf("invalid date %v: %v", dateStr, err)
+	}
+	return !now.Before(date.AddDate(0, 0, 1)), nil
+}
+
 // NodeID represents a node's assigned ID. This field is a UUID.
 type NodeID string
 
@@ -104,6 +120,43 @@ func (n NodeType) String() string {
 	return "UNKNOWN"
 }
 
+// MarshalJSON encodes the node type as its name, e.g. "EXTERNAL_GATEWAY", or as an integer if it has none,
+// e.g. a combination of flags, so it decodes to the same node type
+func (n NodeType) MarshalJSON() ([]byte, error) {
+	if name, ok := nodeTypeNames[n]; ok {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int(n))
+}
+
+// UnmarshalJSON decodes a node type from its name as accepted by FromStringToNodeType,
+// or from the integer form. "UNKNOWN" decodes to the zero node type.
+func (n *NodeType) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var value int
+		if json.Unmarshal(data, &value) != nil {
+			return fmt.Errorf("node type must be a name or an integer: %s", data)
+		}
+		*n = NodeType(value)
+		return nil
+	}
+	if name == NodeType(0).String() {
+		*n = 0
+		return nil
+	}
+	nodeType, err := FromStringToNodeType(name)
+	if err != nil {
+		return err
+	}
+	*n = nodeType
+	return nil
+}
+
 // DeserializeNodeType parses the node type from a serialized form.
 // Placeholder function, since this node type is not currently used.
 func DeserializeNodeType(b []byte) (NodeType, error) {
@@ -125,12 +178,28 @@ func FromStringToNodeType(s string) (NodeType, error) {
 	return 0, fmt.Errorf("could not deserialize unknown node value %v", cs)
 }
 
+// Is returns whether the node type has any of the flags of other, so a single type matches the composite
+// types including it, e.g. InternalGateway.Is(Gateway), and a composite type matches each of its flags
+func (n NodeType) Is(other NodeType) bool {
+	return n&other != 0
+}
+
+// Any returns whether the node type is any of the others
+func (n NodeType) Any(others ...NodeType) bool {
+	for _, other := range others {
+		if n.Is(other) {
+			return true
+		}
+	}
+	return false
+}
+
 // FormatShortNodeType returns the short string representation of a node type
 func (n NodeType) FormatShortNodeType() string {
-	if n&Gateway != 0 {
+	if n.Is(Gateway) {
 		return "G"
 	}
-	if n&RelayProxy != 0 {
+	if n.Is(RelayProxy) {
 		return "R"
 	}
 	return n.String()
@@ -0,0 +1,94 @@
+package types
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeTypeIs(t *testing.T) {
+	// single flags
+	require.True(t, InternalGateway.Is(InternalGateway))
+	require.False(t, InternalGateway.Is(ExternalGateway))
+	require.False(t, RelayProxy.Is(API))
+
+	// composite types
+	require.True(t, InternalGateway.Is(Gateway))
+	require.True(t, ExternalGateway.Is(Gateway))
+	require.True(t, Gateway.Is(InternalGateway))
+	require.True(t, Gateway.Is(Gateway))
+	require.False(t, RelayProxy.Is(Gateway))
+	require.False(t, Gateway.Is(RelayProxy))
+
+	require.False(t, NodeType(0).Is(Gateway))
+	require.False(t, Gateway.Is(0))
+}
+
+func TestNodeTypeAny(t *testing.T) {
+	require.True(t, ExternalGateway.Any(RelayProxy, Gateway))
+	require.True(t, (Websocket | GRPC).Any(GRPC))
+	require.False(t, API.Any(Gateway, RelayProxy))
+	require.False(t, API.Any())
+}
+
+func TestFormatShortNodeType(t *testing.T) {
+	require.Equal(t, "G", InternalGateway.FormatShortNodeType())
+	require.Equal(t, "G", Gateway.FormatShortNodeType())
+	require.Equal(t, "R", RelayProxy.FormatShortNodeType())
+	require.Equal(t, "API", API.FormatShortNodeType())
+}
+
+func TestNodeTypeJSON(t *testing.T) {
+	for nodeType, name := range nodeTypeNames {
+		b, err := json.Marshal(nodeType)
+		require.NoError(t, err)
+		require.Equal(t, `"`+name+`"`, string(b))
+
+		var decoded NodeType
+		require.NoError(t, json.Unmarshal(b, &decoded))
+		require.Equal(t, nodeType, decoded)
+	}
+
+	// node types without a name are encoded as integers
+	for _, nodeType := range []NodeType{0, 1 << 20, InternalGateway | RelayProxy} {
+		b, err := json.Marshal(nodeType)
+		require.NoError(t, err)
+		require.Equal(t, strconv.Itoa(int(nodeType)), string(b))
+		var decoded NodeType
+		require.NoError(t, json.Unmarshal(b, &decoded))
+		require.Equal(t, nodeType, decoded)
+	}
+	decoded := Gateway
+	require.NoError(t, json.Unmarshal([]byte(`"UNKNOWN"`), &decoded))
+	require.Equal(t, NodeType(0), decoded)
+
+	// legacy integer form and names accepted by FromStringToNodeType
+	require.NoError(t, json.Unmarshal([]byte(`2`), &decoded))
+	require.Equal(t, ExternalGateway, decoded)
+	require.NoError(t, json.Unmarshal([]byte(`"relay_proxy"`), &decoded))
+	require.Equal(t, RelayProxy, decoded)
+
+	require.Error(t, json.Unmarshal([]byte(`"RELAY"`), &decoded))
+	require.Error(t, json.Unmarshal([]byte(`true`), &decoded))
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	for dateStr, expected := range map[string]bool{
+		"":           true,
+		ExpiredDate:  true,
+		"2025-03-09": true,
+		"2025-03-10": false,
+		"2025-03-11": false,
+	} {
+		expired, err := IsExpired(dateStr, now)
+		require.NoError(t, err)
+		require.Equal(t, expected, expired, dateStr)
+	}
+
+	_, err := IsExpired("03/10/2025", now)
+	require.Error(t, err)
+}
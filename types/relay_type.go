@@ -3,19 +3,65 @@ package types
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 )
 
 // RelayMonitorInterval is interval for relay monitor
 const RelayMonitorInterval = time.Minute
 
+// RelayLatencyHistorySize is the number of recent latency samples kept by RelayInfo
+const RelayLatencyHistorySize = 5
+
 // RelayInfo - represent connected relays info
 type RelayInfo struct {
 	TimeAdded   time.Time
 	IsConnected bool
 	IsStatic    bool
 	Latency     float64
-	Port        int64
+	// LatencyHistory holds the LatencySamples recent latency samples, oldest first. It is an array,
+	// so RelayInfo stays comparable.
+	LatencyHistory [RelayLatencyHistorySize]float64 `json:",omitzero"`
+	LatencySamples int                              `json:",omitempty"`
+	Port           int64
+}
+
+// AddLatency records a latency sample as the latest latency, keeping the RelayLatencyHistorySize most recent samples
+func (r *RelayInfo) AddLatency(latency float64) {
+	samples := r.latencySampleCount()
+	if samples == RelayLatencyHistorySize {
+		copy(r.LatencyHistory[:], r.LatencyHistory[1:])
+		samples--
+	}
+	r.LatencyHistory[samples] = latency
+	r.LatencySamples = samples + 1
+	r.Latency = latency
+}
+
+// Latencies returns the recent latency samples, oldest first
+func (r RelayInfo) Latencies() []float64 {
+	return slices.Clone(r.LatencyHistory[:r.latencySampleCount()])
+}
+
+// MedianLatency returns the median of the recent latency samples, or Latency if there are none,
+// so a single latency spike does not change it
+func (r RelayInfo) MedianLatency() float64 {
+	// r is a copy, so its history can be sorted in place
+	samples := r.LatencyHistory[:r.latencySampleCount()]
+	if len(samples) == 0 {
+		return r.Latency
+	}
+	slices.Sort(samples)
+	middle := len(samples) / 2
+	if len(samples)%2 == 0 {
+		return (samples[middle-1] + samples[middle]) / 2
+	}
+	return samples[middle]
+}
+
+// latencySampleCount returns LatencySamples bounded to the size of the latency history
+func (r *RelayInfo) latencySampleCount() int {
+	return min(max(r.LatencySamples, 0), RelayLatencyHistorySize)
 }
 
 // RelayType describes enum for existing relay types
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -60,3 +61,33 @@ func TestRelayTypeJSON(t *testing.T) {
 
 	require.Equal(t, `{"type":"backbone"}`, string(b))
 }
+
+func TestRelayInfo_LatencyHistory(t *testing.T) {
+	var relayInfo RelayInfo
+	relayInfo.Latency = 7
+	assert.Equal(t, float64(7), relayInfo.MedianLatency())
+
+	for _, latency := range []float64{10, 12, 11, 90, 13, 12} {
+		relayInfo.AddLatency(latency)
+	}
+	// only the most recent samples are kept
+	assert.Equal(t, []float64{12, 11, 90, 13, 12}, relayInfo.Latencies())
+	assert.Equal(t, float64(12), relayInfo.Latency)
+	// the latency spike does not change the median
+	assert.Equal(t, float64(12), relayInfo.MedianLatency())
+
+	previous := relayInfo
+	relayInfo.AddLatency(14)
+	assert.Equal(t, []float64{12, 11, 90, 13, 12}, previous.Latencies())
+	assert.Equal(t, []float64{11, 90, 13, 12, 14}, relayInfo.Latencies())
+	assert.Equal(t, float64(12.5), RelayInfo{LatencyHistory: [RelayLatencyHistorySize]float64{12, 13}, LatencySamples: 2}.MedianLatency())
+	// the median does not reorder the history
+	assert.Equal(t, []float64{11, 90, 13, 12, 14}, relayInfo.Latencies())
+
+	data, err := json.Marshal(relayInfo)
+	require.NoError(t, err)
+	var decoded RelayInfo
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	// RelayInfo is comparable
+	assert.True(t, relayInfo == decoded)
+}